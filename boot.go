@@ -0,0 +1,42 @@
+package operator
+
+import (
+	"database/sql"
+	"net"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/mistifyio/mistify-operator-admin/models"
+)
+
+// RegisterBootRoutes registers the boot routes and handlers
+func RegisterBootRoutes(prefix string, router *mux.Router) {
+	sub := router.PathPrefix(prefix).Subrouter()
+	RegisterOneRoute(sub, RouteInfo{"/{mac}", GetBootScript, []string{"GET"}, "boot.get"})
+}
+
+// GetBootScript renders the iPXE boot script for the hypervisor with a MAC, or
+// a script asking for the machine to be registered if no hypervisor has it
+func GetBootScript(w http.ResponseWriter, r *http.Request) {
+	hr := HTTPResponse{w}
+	vars := mux.Vars(r)
+	mac, err := net.ParseMAC(vars["mac"])
+	if err != nil {
+		hr.JSONMsg(http.StatusBadRequest, models.ErrBadMAC.Error())
+		return
+	}
+
+	var script []byte
+	hypervisor, err := models.FetchHypervisorByMAC(mac)
+	switch {
+	case err == sql.ErrNoRows:
+		script, err = models.RegisterBootScript(mac)
+	case err == nil:
+		script, err = hypervisor.BootScript(mac)
+	}
+	if err != nil {
+		hr.JSONError(http.StatusInternalServerError, err)
+		return
+	}
+	hr.Text(http.StatusOK, script)
+}
@@ -0,0 +1,125 @@
+package operator
+
+import (
+	"database/sql"
+	"net/http"
+
+	"code.google.com/p/go-uuid/uuid"
+	"github.com/gorilla/mux"
+	"github.com/mistifyio/mistify-operator-admin/models"
+)
+
+// RegisterBootstrapTokenRoutes registers the bootstrap token routes and
+// handlers
+func RegisterBootstrapTokenRoutes(prefix string, router *mux.Router) {
+	RegisterOneRoute(router, RouteInfo{prefix, ListBootstrapTokens, []string{"GET"}, "bootstraptokens.list"})
+	RegisterOneRoute(router, RouteInfo{prefix, CreateBootstrapToken, []string{"POST"}, "bootstraptokens.create"})
+	sub := router.PathPrefix(prefix).Subrouter()
+	RegisterOneRoute(sub, RouteInfo{"/{tokenID}", GetBootstrapToken, []string{"GET"}, "bootstraptokens.get"})
+	RegisterOneRoute(sub, RouteInfo{"/{tokenID}", DeleteBootstrapToken, []string{"DELETE"}, "bootstraptokens.delete"})
+}
+
+// ListBootstrapTokens gets a list of all bootstrap tokens
+func ListBootstrapTokens(w http.ResponseWriter, r *http.Request) {
+	hr := HTTPResponse{w}
+	tokens, err := models.ListBootstrapTokens()
+	if err != nil {
+		hr.JSONError(http.StatusInternalServerError, err)
+		return
+	}
+	hr.JSON(http.StatusOK, tokens)
+}
+
+// GetBootstrapToken gets a particular bootstrap token
+func GetBootstrapToken(w http.ResponseWriter, r *http.Request) {
+	hr := HTTPResponse{w}
+	token, ok := getBootstrapTokenHelper(hr, r)
+	if !ok {
+		return
+	}
+	hr.JSON(http.StatusOK, token)
+}
+
+// CreateBootstrapToken mints a new bootstrap token. The response is the only
+// time the secret token is given out.
+func CreateBootstrapToken(w http.ResponseWriter, r *http.Request) {
+	hr := HTTPResponse{w}
+
+	// Parse Request
+	token, err := models.NewBootstrapToken()
+	if err != nil {
+		hr.JSONError(http.StatusInternalServerError, err)
+		return
+	}
+	secret := token.Token
+	if err := token.Decode(r.Body); err != nil {
+		hr.JSONMsg(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// Assign an ID
+	if token.ID != "" {
+		hr.JSONMsg(http.StatusBadRequest, "id must not be defined")
+		return
+	}
+	token.NewID()
+
+	if err := token.Validate(); err != nil {
+		hr.JSONMsg(http.StatusBadRequest, err.Error())
+		return
+	}
+	if err := token.Save(); err != nil {
+		if err == models.ErrIPRangeNotFound {
+			hr.JSONMsg(http.StatusBadRequest, err.Error())
+			return
+		}
+		hr.JSONError(http.StatusInternalServerError, err)
+		return
+	}
+	if err := token.Load(); err != nil {
+		hr.JSONError(http.StatusInternalServerError, err)
+		return
+	}
+	token.Token = secret
+	hr.JSON(http.StatusCreated, token)
+}
+
+// DeleteBootstrapToken revokes an existing bootstrap token
+func DeleteBootstrapToken(w http.ResponseWriter, r *http.Request) {
+	hr := HTTPResponse{w}
+	token, ok := getBootstrapTokenHelper(hr, r)
+	if !ok {
+		return
+	}
+
+	if err := token.Delete(); err != nil {
+		hr.JSONError(http.StatusInternalServerError, err)
+		return
+	}
+	hr.JSON(http.StatusOK, token)
+}
+
+// getBootstrapTokenHelper gets the bootstrap token object and handles sending
+// a response in case of error
+func getBootstrapTokenHelper(hr HTTPResponse, r *http.Request) (*models.BootstrapToken, bool) {
+	vars := mux.Vars(r)
+	tokenID, ok := vars["tokenID"]
+	if !ok {
+		hr.JSONMsg(http.StatusBadRequest, "missing token id")
+		return nil, false
+	}
+	if uuid.Parse(tokenID) == nil {
+		hr.JSONMsg(http.StatusBadRequest, "invalid token id")
+		return nil, false
+	}
+	token, err := models.FetchBootstrapToken(tokenID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			hr.JSONMsg(http.StatusNotFound, "not found")
+			return nil, false
+		}
+		hr.JSONError(http.StatusInternalServerError, err)
+		return nil, false
+	}
+	return token, true
+}
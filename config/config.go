@@ -13,6 +13,7 @@ type (
 	Config struct {
 		DB      DB                           `json:"db"`
 		Metrics Metrics                      `json:"metrics"`
+		Secrets Secrets                      `json:"secrets"`
 		Mistify map[string]map[string]string `json:"mistify"`
 	}
 )
@@ -34,6 +35,10 @@ func Load(path string) error {
 		return err
 	}
 
+	if err := newConfig.Secrets.Validate(); err != nil {
+		return err
+	}
+
 	conf = newConfig
 
 	return nil
@@ -22,3 +22,14 @@ var ErrMetricsNoServiceName = errors.New("missing service name")
 
 // ErrMetricsBadStatsdAddress is for a bad statsd address in the config
 var ErrMetricsBadStatsdAddress = errors.New("invalid address for statsd")
+
+// ErrSecretsNoKey is for storing secrets without a key in the config
+var ErrSecretsNoKey = errors.New("missing secrets key")
+
+// ErrSecretsBadKey is for a secrets key in the config that is not a base64
+// encoded 32 byte key
+var ErrSecretsBadKey = errors.New("secrets key must be a base64 encoded 32 byte key")
+
+// ErrSecretsNoRevealToken is for enabling revealing secrets without a reveal
+// token in the config
+var ErrSecretsNoRevealToken = errors.New("missing secrets reveal token")
@@ -0,0 +1,56 @@
+package config
+
+import (
+	"crypto/subtle"
+	"encoding/base64"
+
+	"github.com/hashicorp/go-multierror"
+)
+
+// secretsKeySize is the size of the AES-256 key secrets are encrypted with
+const secretsKeySize = 32
+
+// Secrets is the JSON structure and validation for the configuration of secrets,
+// such as BMC passwords, that are stored encrypted in the database
+type Secrets struct {
+	Key         string `json:"key"`          // Base64 encoded 32 byte key
+	Reveal      bool   `json:"reveal"`       // Whether stored secrets may be revealed
+	RevealToken string `json:"reveal_token"` // Required to reveal stored secrets
+}
+
+// Validate ensures that the secrets configuration is reasonable. The key may be
+// left out if no secrets are stored.
+func (s *Secrets) Validate() error {
+	var result *multierror.Error
+	if s.Key != "" {
+		if _, err := s.KeyBytes(); err != nil {
+			result = multierror.Append(result, err)
+		}
+	}
+	if s.Reveal && s.RevealToken == "" {
+		result = multierror.Append(result, ErrSecretsNoRevealToken)
+	}
+	return result.ErrorOrNil()
+}
+
+// RevealAllowed checks whether stored secrets may be revealed to a caller
+// presenting the token. Revealing is refused unless it is enabled and the token
+// matches the configured reveal token.
+func (s *Secrets) RevealAllowed(token string) bool {
+	if !s.Reveal || s.RevealToken == "" || token == "" {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(token), []byte(s.RevealToken)) == 1
+}
+
+// KeyBytes decodes the configured key
+func (s *Secrets) KeyBytes() ([]byte, error) {
+	if s.Key == "" {
+		return nil, ErrSecretsNoKey
+	}
+	key, err := base64.StdEncoding.DecodeString(s.Key)
+	if err != nil || len(key) != secretsKeySize {
+		return nil, ErrSecretsBadKey
+	}
+	return key, nil
+}
@@ -0,0 +1,52 @@
+package config_test
+
+import (
+	"testing"
+
+	h "github.com/bakins/test-helpers"
+	"github.com/mistifyio/mistify-operator-admin/config"
+)
+
+func TestSecretsValidate(t *testing.T) {
+	secrets := &config.Secrets{}
+	var err error
+
+	h.Ok(t, secrets.Validate())
+	_, err = secrets.KeyBytes()
+	h.Equals(t, config.ErrSecretsNoKey, err)
+
+	secrets.Key = "foobar"
+	err = secrets.Validate()
+	h.Assert(t, errContains(config.ErrSecretsBadKey, err), "expected 'bad key' error")
+
+	// Too short
+	secrets.Key = "Zm9vYmFy"
+	err = secrets.Validate()
+	h.Assert(t, errContains(config.ErrSecretsBadKey, err), "expected 'bad key' error")
+
+	secrets.Key = "qoyprFyydajH+6dZWKbeD0+8LQILrDnE3QsjG9PBZBk="
+	h.Ok(t, secrets.Validate())
+	key, err := secrets.KeyBytes()
+	h.Ok(t, err)
+	h.Equals(t, 32, len(key))
+}
+
+func TestSecretsRevealAllowed(t *testing.T) {
+	secrets := &config.Secrets{}
+	h.Assert(t, !secrets.RevealAllowed(""), "expected reveal to be disabled by default")
+	h.Assert(t, !secrets.RevealAllowed("foobar"), "expected reveal to be disabled by default")
+
+	secrets.RevealToken = "foobar"
+	h.Assert(t, !secrets.RevealAllowed("foobar"), "expected reveal to be disabled unless enabled")
+
+	secrets.Reveal = true
+	h.Ok(t, secrets.Validate())
+	h.Assert(t, !secrets.RevealAllowed(""), "expected missing token to be refused")
+	h.Assert(t, !secrets.RevealAllowed("foobaz"), "expected wrong token to be refused")
+	h.Assert(t, secrets.RevealAllowed("foobar"), "expected matching token to be allowed")
+
+	secrets.RevealToken = ""
+	err := secrets.Validate()
+	h.Assert(t, errContains(config.ErrSecretsNoRevealToken, err), "expected 'no reveal token' error")
+	h.Assert(t, !secrets.RevealAllowed(""), "expected reveal without a token to be refused")
+}
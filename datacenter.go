@@ -0,0 +1,160 @@
+package operator
+
+import (
+	"database/sql"
+	"net/http"
+
+	"code.google.com/p/go-uuid/uuid"
+	"github.com/gorilla/mux"
+	"github.com/mistifyio/mistify-operator-admin/models"
+)
+
+// RegisterDatacenterRoutes registers the datacenter routes and handlers
+func RegisterDatacenterRoutes(prefix string, router *mux.Router) {
+	RegisterOneRoute(router, RouteInfo{prefix, ListDatacenters, []string{"GET"}, "datacenters.list"})
+	RegisterOneRoute(router, RouteInfo{prefix, CreateDatacenter, []string{"POST"}, "datacenters.create"})
+	sub := router.PathPrefix(prefix).Subrouter()
+	RegisterOneRoute(sub, RouteInfo{"/{datacenterID}", GetDatacenter, []string{"GET"}, "datacenters.get"})
+	RegisterOneRoute(sub, RouteInfo{"/{datacenterID}", UpdateDatacenter, []string{"PATCH"}, "datacenters.update"})
+	RegisterOneRoute(sub, RouteInfo{"/{datacenterID}", DeleteDatacenter, []string{"DELETE"}, "datacenters.delete"})
+	RegisterOneRoute(sub, RouteInfo{"/{datacenterID}/zones", GetDatacenterZones, []string{"GET"}, "datacenters.zones.get"})
+}
+
+// ListDatacenters gets a list of all datacenters
+func ListDatacenters(w http.ResponseWriter, r *http.Request) {
+	hr := HTTPResponse{w}
+	datacenters, err := models.ListDatacenters()
+	if err != nil {
+		hr.JSONError(http.StatusInternalServerError, err)
+		return
+	}
+	hr.JSON(http.StatusOK, datacenters)
+}
+
+// GetDatacenter gets a particular datacenter
+func GetDatacenter(w http.ResponseWriter, r *http.Request) {
+	hr := HTTPResponse{w}
+	datacenter, ok := getDatacenterHelper(hr, r)
+	if !ok {
+		return
+	}
+	hr.JSON(http.StatusOK, datacenter)
+}
+
+// CreateDatacenter creates a new datacenter
+func CreateDatacenter(w http.ResponseWriter, r *http.Request) {
+	hr := HTTPResponse{w}
+
+	// Parse Request
+	datacenter := &models.Datacenter{}
+	if err := datacenter.Decode(r.Body); err != nil {
+		hr.JSONMsg(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// Assign an ID
+	if datacenter.ID != "" {
+		hr.JSONMsg(http.StatusBadRequest, "id must not be defined")
+		return
+	}
+	datacenter.NewID()
+
+	if !saveDatacenterHelper(hr, datacenter) {
+		return
+	}
+	hr.JSON(http.StatusCreated, datacenter)
+}
+
+// UpdateDatacenter updates an existing datacenter
+func UpdateDatacenter(w http.ResponseWriter, r *http.Request) {
+	hr := HTTPResponse{w}
+	datacenter, ok := getDatacenterHelper(hr, r)
+	if !ok {
+		return // Specific response handled by getDatacenterHelper
+	}
+
+	// Parse Request
+	if err := datacenter.Decode(r.Body); err != nil {
+		hr.JSONMsg(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if !saveDatacenterHelper(hr, datacenter) {
+		return
+	}
+	hr.JSON(http.StatusOK, datacenter)
+}
+
+// DeleteDatacenter deletes an existing datacenter that has no zones
+func DeleteDatacenter(w http.ResponseWriter, r *http.Request) {
+	hr := HTTPResponse{w}
+	datacenter, ok := getDatacenterHelper(hr, r)
+	if !ok {
+		return
+	}
+
+	if err := datacenter.Delete(); err != nil {
+		if err == models.ErrLocationInUse {
+			hr.JSONMsg(http.StatusConflict, err.Error())
+			return
+		}
+		hr.JSONError(http.StatusInternalServerError, err)
+		return
+	}
+	hr.JSON(http.StatusOK, datacenter)
+}
+
+// GetDatacenterZones gets a list of zones in the datacenter
+func GetDatacenterZones(w http.ResponseWriter, r *http.Request) {
+	hr := HTTPResponse{w}
+	datacenter, ok := getDatacenterHelper(hr, r)
+	if !ok {
+		return
+	}
+	zones, err := models.ZonesByDatacenter(datacenter)
+	if err != nil {
+		hr.JSONError(http.StatusInternalServerError, err)
+		return
+	}
+	hr.JSON(http.StatusOK, zones)
+}
+
+// getDatacenterHelper gets the datacenter object and handles sending a
+// response in case of error
+func getDatacenterHelper(hr HTTPResponse, r *http.Request) (*models.Datacenter, bool) {
+	vars := mux.Vars(r)
+	datacenterID, ok := vars["datacenterID"]
+	if !ok {
+		hr.JSONMsg(http.StatusBadRequest, "missing datacenter id")
+		return nil, false
+	}
+	if uuid.Parse(datacenterID) == nil {
+		hr.JSONMsg(http.StatusBadRequest, "invalid datacenter id")
+		return nil, false
+	}
+	datacenter, err := models.FetchDatacenter(datacenterID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			hr.JSONMsg(http.StatusNotFound, "not found")
+			return nil, false
+		}
+		hr.JSONError(http.StatusInternalServerError, err)
+		return nil, false
+	}
+	return datacenter, true
+}
+
+// saveDatacenterHelper saves the datacenter object and handles sending a
+// response in case of error
+func saveDatacenterHelper(hr HTTPResponse, datacenter *models.Datacenter) bool {
+	if err := datacenter.Validate(); err != nil {
+		hr.JSONMsg(http.StatusBadRequest, err.Error())
+		return false
+	}
+	// Save
+	if err := datacenter.Save(); err != nil {
+		hr.JSONError(http.StatusInternalServerError, err)
+		return false
+	}
+	return true
+}
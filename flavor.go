@@ -2,6 +2,7 @@ package operator
 
 import (
 	"database/sql"
+	"encoding/json"
 	"net/http"
 
 	"code.google.com/p/go-uuid/uuid"
@@ -14,9 +15,16 @@ func RegisterFlavorRoutes(prefix string, router *mux.Router) {
 	RegisterOneRoute(router, RouteInfo{prefix, ListFlavors, []string{"GET"}, "flavors.list"})
 	RegisterOneRoute(router, RouteInfo{prefix, CreateFlavor, []string{"POST"}, "flavors.create"})
 	sub := router.PathPrefix(prefix).Subrouter()
+	RegisterOneRoute(sub, RouteInfo{"/specs", ListFlavorSpecs, []string{"GET"}, "flavors.specs.list"})
+	RegisterOneRoute(sub, RouteInfo{"/by-name/{name}", GetFlavorByName, []string{"GET"}, "flavors.byname.get"})
 	RegisterOneRoute(sub, RouteInfo{"/{flavorID}", GetFlavor, []string{"GET"}, "flavors.get"})
 	RegisterOneRoute(sub, RouteInfo{"/{flavorID}", UpdateFlavor, []string{"PATCH"}, "flavors.update"})
 	RegisterOneRoute(sub, RouteInfo{"/{flavorID}", DeleteFlavor, []string{"DELETE"}, "flavors.delete"})
+	RegisterOneRoute(sub, RouteInfo{"/{flavorID}/capacity", GetFlavorCapacity, []string{"GET"}, "flavors.capacity.get"})
+	RegisterOneRoute(sub, RouteInfo{"/{flavorID}/projects", GetFlavorProjects, []string{"GET"}, "flavors.projects.get"})
+	RegisterOneRoute(sub, RouteInfo{"/{flavorID}/projects", SetFlavorProjects, []string{"PUT"}, "flavors.projects.set"})
+	RegisterOneRoute(sub, RouteInfo{"/{flavorID}/projects/{projectID}", AddFlavorProject, []string{"PUT"}, "flavors.projects.add"})
+	RegisterOneRoute(sub, RouteInfo{"/{flavorID}/projects/{projectID}", RemoveFlavorProject, []string{"DELETE"}, "flavors.projects.remove"})
 }
 
 // ListFlavors get a list of all flavors
@@ -30,6 +38,12 @@ func ListFlavors(w http.ResponseWriter, r *http.Request) {
 	hr.JSON(http.StatusOK, flavors)
 }
 
+// ListFlavorSpecs gets the registry of known flavor extra specs
+func ListFlavorSpecs(w http.ResponseWriter, r *http.Request) {
+	hr := HTTPResponse{w}
+	hr.JSON(http.StatusOK, models.FlavorSpecs)
+}
+
 // GetFlavor gets a paritcular flavor
 func GetFlavor(w http.ResponseWriter, r *http.Request) {
 	hr := HTTPResponse{w}
@@ -40,6 +54,22 @@ func GetFlavor(w http.ResponseWriter, r *http.Request) {
 	hr.JSON(http.StatusOK, flavor)
 }
 
+// GetFlavorByName gets a particular flavor by name
+func GetFlavorByName(w http.ResponseWriter, r *http.Request) {
+	hr := HTTPResponse{w}
+	vars := mux.Vars(r)
+	flavor, err := models.FetchFlavorByName(vars["name"])
+	if err != nil {
+		if err == sql.ErrNoRows {
+			hr.JSONMsg(http.StatusNotFound, "not found")
+			return
+		}
+		hr.JSONError(http.StatusInternalServerError, err)
+		return
+	}
+	hr.JSON(http.StatusOK, flavor)
+}
+
 // CreateFlavor creates a new flavor
 func CreateFlavor(w http.ResponseWriter, r *http.Request) {
 	hr := HTTPResponse{w}
@@ -99,6 +129,99 @@ func DeleteFlavor(w http.ResponseWriter, r *http.Request) {
 	hr.JSON(http.StatusOK, flavor)
 }
 
+// GetFlavorCapacity gets how many instances of the flavor fit on each
+// hypervisor and in total
+func GetFlavorCapacity(w http.ResponseWriter, r *http.Request) {
+	hr := HTTPResponse{w}
+	flavor, ok := getFlavorHelper(hr, r)
+	if !ok {
+		return
+	}
+	capacity, err := flavor.Capacity()
+	if err != nil {
+		hr.JSONError(http.StatusInternalServerError, err)
+		return
+	}
+	hr.JSON(http.StatusOK, capacity)
+}
+
+// GetFlavorProjects gets a list of projects associated with the flavor
+func GetFlavorProjects(w http.ResponseWriter, r *http.Request) {
+	hr := HTTPResponse{w}
+	flavor, ok := getFlavorHelper(hr, r)
+	if !ok {
+		return
+	}
+	if err := flavor.LoadProjects(); err != nil {
+		hr.JSONError(http.StatusInternalServerError, err)
+		return
+	}
+	hr.JSON(http.StatusOK, flavor.Projects)
+}
+
+// SetFlavorProjects sets the list of projects associated with the flavor
+func SetFlavorProjects(w http.ResponseWriter, r *http.Request) {
+	hr := HTTPResponse{w}
+	flavor, ok := getFlavorHelper(hr, r)
+	if !ok {
+		return
+	}
+
+	var projectIDs []string
+	decoder := json.NewDecoder(r.Body)
+	if err := decoder.Decode(&projectIDs); err != nil {
+		hr.JSONMsg(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	projects := make([]*models.Project, len(projectIDs))
+	for i, v := range projectIDs {
+		projects[i] = &models.Project{ID: v}
+	}
+
+	if err := flavor.SetProjects(projects); err != nil {
+		hr.JSONError(http.StatusInternalServerError, err)
+		return
+	}
+	hr.JSON(http.StatusOK, flavor.Projects)
+}
+
+// AddFlavorProject associates a project with the flavor
+func AddFlavorProject(w http.ResponseWriter, r *http.Request) {
+	hr := HTTPResponse{w}
+	flavor, ok := getFlavorHelper(hr, r)
+	if !ok {
+		return
+	}
+
+	vars := mux.Vars(r)
+	projectID := vars["projectID"]
+
+	if err := flavor.AddProject(&models.Project{ID: projectID}); err != nil {
+		hr.JSONError(http.StatusInternalServerError, err)
+		return
+	}
+	hr.JSON(http.StatusOK, &struct{}{})
+}
+
+// RemoveFlavorProject disassociates a project with the flavor
+func RemoveFlavorProject(w http.ResponseWriter, r *http.Request) {
+	hr := HTTPResponse{w}
+	flavor, ok := getFlavorHelper(hr, r)
+	if !ok {
+		return
+	}
+
+	vars := mux.Vars(r)
+	projectID := vars["projectID"]
+
+	if err := flavor.RemoveProject(&models.Project{ID: projectID}); err != nil {
+		hr.JSONError(http.StatusInternalServerError, err)
+		return
+	}
+	hr.JSON(http.StatusOK, &struct{}{})
+}
+
 // getFlavorHelper gets the flavor object and handles sending a response in case
 // of error
 func getFlavorHelper(hr HTTPResponse, r *http.Request) (*models.Flavor, bool) {
@@ -133,6 +256,10 @@ func saveFlavorHelper(hr HTTPResponse, flavor *models.Flavor) bool {
 	}
 	// Save
 	if err := flavor.Save(); err != nil {
+		if err == models.ErrFlavorNameInUse {
+			hr.JSONMsg(http.StatusConflict, err.Error())
+			return false
+		}
 		hr.JSONError(http.StatusInternalServerError, err)
 		return false
 	}
@@ -63,7 +63,14 @@ func Run(port uint) error {
 	RegisterPermissionRoutes("/permissions", router)
 	RegisterNetworkRoutes("/networks", router)
 	RegisterIPRangeRoutes("/ipranges", router)
+	RegisterPoolRoutes("/pools", router)
 	RegisterHypervisorRoutes("/hypervisors", router)
+	RegisterBootstrapTokenRoutes("/bootstraptokens", router)
+	RegisterBootRoutes("/boot", router)
+	RegisterDatacenterRoutes("/datacenters", router)
+	RegisterZoneRoutes("/zones", router)
+	RegisterRackRoutes("/racks", router)
+	RegisterPlacementRoutes("/placement", router)
 	RegisterProjectRoutes("/projects", router)
 	RegisterUserRoutes("/users", router)
 	RegisterFlavorRoutes("/flavors", router)
@@ -136,3 +143,10 @@ func (hr *HTTPResponse) JSONMsg(code int, msg string) {
 	}
 	hr.JSON(code, msgObj)
 }
+
+// Text writes appropriate headers and a plain text body to the http response
+func (hr *HTTPResponse) Text(code int, body []byte) {
+	hr.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	hr.WriteHeader(code)
+	_, _ = hr.Write(body)
+}
@@ -1,12 +1,20 @@
 package operator
 
 import (
+	"bytes"
 	"database/sql"
 	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
 	"code.google.com/p/go-uuid/uuid"
 	"github.com/gorilla/mux"
+	conf "github.com/mistifyio/mistify-operator-admin/config"
 	"github.com/mistifyio/mistify-operator-admin/models"
 )
 
@@ -15,6 +23,7 @@ func RegisterHypervisorRoutes(prefix string, router *mux.Router) {
 	RegisterOneRoute(router, RouteInfo{prefix, ListHypervisors, []string{"GET"}, "hypervisors.list"})
 	RegisterOneRoute(router, RouteInfo{prefix, CreateHypervisor, []string{"POST"}, "hypervisors.create"})
 	sub := router.PathPrefix(prefix).Subrouter()
+	RegisterOneRoute(sub, RouteInfo{"/register", RegisterHypervisor, []string{"POST"}, "hypervisors.register"})
 	RegisterOneRoute(sub, RouteInfo{"/{hypervisorID}", GetHypervisor, []string{"GET"}, "hypervisors.get"})
 	RegisterOneRoute(sub, RouteInfo{"/{hypervisorID}", UpdateHypervisor, []string{"PATCH"}, "hypervisors.update"})
 	RegisterOneRoute(sub, RouteInfo{"/{hypervisorID}", DeleteHypervisor, []string{"DELETE"}, "hypervisors.delete"})
@@ -22,26 +31,110 @@ func RegisterHypervisorRoutes(prefix string, router *mux.Router) {
 	RegisterOneRoute(sub, RouteInfo{"/{hypervisorID}/ipranges", SetHypervisorIPRanges, []string{"PUT"}, "hypervisors.ipranges.set"})
 	RegisterOneRoute(sub, RouteInfo{"/{hypervisorID}/ipranges/{iprangeID}", AddHypervisorIPRange, []string{"PUT"}, "hypervisors.ipranges.add"})
 	RegisterOneRoute(sub, RouteInfo{"/{hypervisorID}/ipranges/{iprangeID}", RemoveHypervisorIPRange, []string{"DELETE"}, "hypervisors.ipranges.remove"})
+	RegisterOneRoute(sub, RouteInfo{"/{hypervisorID}/dhcp", GetHypervisorDHCP, []string{"GET"}, "hypervisors.dhcp.get"})
+	RegisterOneRoute(sub, RouteInfo{"/{hypervisorID}/transition", TransitionHypervisor, []string{"POST"}, "hypervisors.transition"})
+	RegisterOneRoute(sub, RouteInfo{"/{hypervisorID}/fit", GetHypervisorFit, []string{"GET"}, "hypervisors.fit.get"})
+	RegisterOneRoute(sub, RouteInfo{"/{hypervisorID}/heartbeat", HeartbeatHypervisor, []string{"POST"}, "hypervisors.heartbeat"})
+	RegisterOneRoute(sub, RouteInfo{"/{hypervisorID}/config", GetHypervisorConfig, []string{"GET"}, "hypervisors.config.get"})
+	RegisterOneRoute(sub, RouteInfo{"/{hypervisorID}/interfaces", GetHypervisorInterfaces, []string{"GET"}, "hypervisors.interfaces.list"})
+	RegisterOneRoute(sub, RouteInfo{"/{hypervisorID}/interfaces", CreateHypervisorInterface, []string{"POST"}, "hypervisors.interfaces.create"})
+	RegisterOneRoute(sub, RouteInfo{"/{hypervisorID}/interfaces/{interfaceID}", GetHypervisorInterface, []string{"GET"}, "hypervisors.interfaces.get"})
+	RegisterOneRoute(sub, RouteInfo{"/{hypervisorID}/interfaces/{interfaceID}", UpdateHypervisorInterface, []string{"PATCH"}, "hypervisors.interfaces.update"})
+	RegisterOneRoute(sub, RouteInfo{"/{hypervisorID}/interfaces/{interfaceID}", DeleteHypervisorInterface, []string{"DELETE"}, "hypervisors.interfaces.delete"})
+	RegisterOneRoute(sub, RouteInfo{"/{hypervisorID}/bmc", GetHypervisorBMC, []string{"GET"}, "hypervisors.bmc.get"})
+	RegisterOneRoute(sub, RouteInfo{"/{hypervisorID}/bmc", SetHypervisorBMC, []string{"PUT"}, "hypervisors.bmc.set"})
+	RegisterOneRoute(sub, RouteInfo{"/{hypervisorID}/bmc", DeleteHypervisorBMC, []string{"DELETE"}, "hypervisors.bmc.delete"})
+	RegisterOneRoute(sub, RouteInfo{"/{hypervisorID}/bmc/reveal", RevealHypervisorBMC, []string{"POST"}, "hypervisors.bmc.reveal"})
+	RegisterOneRoute(sub, RouteInfo{"/{hypervisorID}/facts", GetHypervisorFacts, []string{"GET"}, "hypervisors.facts.get"})
+	RegisterOneRoute(sub, RouteInfo{"/{hypervisorID}/facts", ReportHypervisorFacts, []string{"PUT"}, "hypervisors.facts.report"})
+	RegisterOneRoute(sub, RouteInfo{"/{hypervisorID}/facts/history", GetHypervisorFactsHistory, []string{"GET"}, "hypervisors.facts.history"})
+	RegisterOneRoute(sub, RouteInfo{"/{hypervisorID}/facts/diff", DiffHypervisorFacts, []string{"GET"}, "hypervisors.facts.diff"})
+	RegisterOneRoute(sub, RouteInfo{"/{hypervisorID}/facts/{version:[0-9]+}", GetHypervisorFacts, []string{"GET"}, "hypervisors.facts.version.get"})
 }
 
-// ListHypervisors gets a list of all hypervisors
+// ListHypervisors gets a list of all hypervisors, along with the heartbeat
+// status of each. The list is narrowed down to the hypervisors matching every
+// one of the mac, ip, state, rack, zone, and datacenter query parameters given,
+// along with any facts.{path} parameters matching their latest hardware facts.
 func ListHypervisors(w http.ResponseWriter, r *http.Request) {
 	hr := HTTPResponse{w}
-	hypervisors, err := models.ListHypervisors()
+	query := r.URL.Query()
+	filter := &models.HypervisorFilter{
+		State:        query.Get("state"),
+		RackID:       query.Get("rack"),
+		ZoneID:       query.Get("zone"),
+		DatacenterID: query.Get("datacenter"),
+	}
+	if value := query.Get("mac"); value != "" {
+		mac, err := net.ParseMAC(value)
+		if err != nil {
+			hr.JSONMsg(http.StatusBadRequest, models.ErrBadMAC.Error())
+			return
+		}
+		filter.MAC = mac
+	}
+	if value := query.Get("ip"); value != "" {
+		ip := net.ParseIP(value)
+		if ip == nil {
+			hr.JSONMsg(http.StatusBadRequest, models.ErrBadIP.Error())
+			return
+		}
+		filter.IP = ip
+	}
+	if filter.State != "" && !models.ValidHypervisorState(filter.State) {
+		hr.JSONMsg(http.StatusBadRequest, models.ErrBadHypervisorState.Error())
+		return
+	}
+	if filter.RackID != "" && uuid.Parse(filter.RackID) == nil {
+		hr.JSONMsg(http.StatusBadRequest, models.ErrBadRackID.Error())
+		return
+	}
+	if filter.ZoneID != "" && uuid.Parse(filter.ZoneID) == nil {
+		hr.JSONMsg(http.StatusBadRequest, models.ErrBadZoneID.Error())
+		return
+	}
+	if filter.DatacenterID != "" && uuid.Parse(filter.DatacenterID) == nil {
+		hr.JSONMsg(http.StatusBadRequest, models.ErrBadDatacenterID.Error())
+		return
+	}
+	for key := range query {
+		if !strings.HasPrefix(key, "facts.") {
+			continue
+		}
+		path := strings.TrimPrefix(key, "facts.")
+		if _, err := models.ParseFactPath(path); err != nil {
+			hr.JSONMsg(http.StatusBadRequest, err.Error())
+			return
+		}
+		if filter.Facts == nil {
+			filter.Facts = make(map[string]string)
+		}
+		filter.Facts[path] = query.Get(key)
+	}
+
+	hypervisors, err := models.FilterHypervisors(filter)
 	if err != nil {
 		hr.JSONError(http.StatusInternalServerError, err)
 		return
 	}
+	if err := models.SetHypervisorStatuses(hypervisors); err != nil {
+		hr.JSONError(http.StatusInternalServerError, err)
+		return
+	}
 	hr.JSON(http.StatusOK, hypervisors)
 }
 
-// GetHypervisor gets a particular hypervisor
+// GetHypervisor gets a particular hypervisor, along with its heartbeat status
 func GetHypervisor(w http.ResponseWriter, r *http.Request) {
 	hr := HTTPResponse{w}
 	hypervisor, ok := getHypervisorHelper(hr, r)
 	if !ok {
 		return
 	}
+	if err := models.SetHypervisorStatuses([]*models.Hypervisor{hypervisor}); err != nil {
+		hr.JSONError(http.StatusInternalServerError, err)
+		return
+	}
 	hr.JSON(http.StatusOK, hypervisor)
 }
 
@@ -63,12 +156,106 @@ func CreateHypervisor(w http.ResponseWriter, r *http.Request) {
 	}
 	hypervisor.NewID()
 
+	// New hypervisors always start out registered
+	if hypervisor.State != "" && hypervisor.State != models.HypervisorStateRegistered {
+		hr.JSONMsg(http.StatusBadRequest, "state must be registered")
+		return
+	}
+
+	// New hypervisors have not been heard from yet
+	hypervisor.LastSeen = time.Time{}
+	hypervisor.AgentFacts = make(map[string]string)
+	hypervisor.Status = models.HypervisorStatusUnknown
+
 	if !saveHypervisorHelper(hr, hypervisor) {
 		return
 	}
 	hr.JSON(http.StatusCreated, hypervisor)
 }
 
+// RegisterHypervisor lets a machine register itself as a hypervisor with a
+// bootstrap token, or find the hypervisor it already registered as
+func RegisterHypervisor(w http.ResponseWriter, r *http.Request) {
+	hr := HTTPResponse{w}
+
+	// Parse Request. The token and agent facts are given alongside the
+	// hypervisor properties
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		hr.JSONMsg(http.StatusBadRequest, err.Error())
+		return
+	}
+	var params struct {
+		Token string            `json:"token"`
+		Facts map[string]string `json:"facts"`
+	}
+	if err := json.Unmarshal(body, &params); err != nil {
+		hr.JSONMsg(http.StatusBadRequest, err.Error())
+		return
+	}
+	if params.Token == "" {
+		hr.JSONMsg(http.StatusBadRequest, models.ErrNoToken.Error())
+		return
+	}
+	hypervisor := &models.Hypervisor{}
+	if err := hypervisor.Decode(bytes.NewReader(body)); err != nil {
+		hr.JSONMsg(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// Assign an ID
+	if hypervisor.ID != "" {
+		hr.JSONMsg(http.StatusBadRequest, "id must not be defined")
+		return
+	}
+	hypervisor.NewID()
+
+	// New hypervisors always start out registered
+	if hypervisor.State != "" && hypervisor.State != models.HypervisorStateRegistered {
+		hr.JSONMsg(http.StatusBadRequest, "state must be registered")
+		return
+	}
+	// Only operators may place a hypervisor in a rack or override its config
+	hypervisor.RackID = ""
+	hypervisor.Config = nil
+	if err := hypervisor.Validate(); err != nil {
+		hr.JSONMsg(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	created, err := models.RegisterHypervisor(params.Token, hypervisor)
+	if err != nil {
+		if err == models.ErrBadToken {
+			hr.JSONMsg(http.StatusForbidden, err.Error())
+			return
+		}
+		if err == models.ErrHypervisorExists {
+			hr.JSONMsg(http.StatusConflict, err.Error())
+			return
+		}
+		if hypervisorConflictHelper(hr, err) {
+			return
+		}
+		hr.JSONError(http.StatusInternalServerError, err)
+		return
+	}
+
+	// A registering machine is alive
+	if err := hypervisor.Heartbeat(params.Facts); err != nil {
+		hr.JSONError(http.StatusInternalServerError, err)
+		return
+	}
+	if err := models.SetHypervisorStatuses([]*models.Hypervisor{hypervisor}); err != nil {
+		hr.JSONError(http.StatusInternalServerError, err)
+		return
+	}
+	if created {
+		hr.JSON(http.StatusCreated, hypervisor)
+		return
+	}
+	hr.JSON(http.StatusOK, hypervisor)
+}
+
 // UpdateHypervisor updates an existing hypervisor
 func UpdateHypervisor(w http.ResponseWriter, r *http.Request) {
 	hr := HTTPResponse{w}
@@ -76,6 +263,8 @@ func UpdateHypervisor(w http.ResponseWriter, r *http.Request) {
 	if !ok {
 		return // Specific response handled by getHypervisorHelper
 	}
+	state := hypervisor.State
+	lastSeen, agentFacts := hypervisor.LastSeen, hypervisor.AgentFacts
 
 	// Parse Request
 	if err := hypervisor.Decode(r.Body); err != nil {
@@ -83,9 +272,23 @@ func UpdateHypervisor(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// State only changes through transitions
+	if hypervisor.State != "" && hypervisor.State != state {
+		hr.JSONMsg(http.StatusBadRequest, "state must be changed with a transition")
+		return
+	}
+	hypervisor.State = state
+
+	// Heartbeat data only changes through heartbeats
+	hypervisor.LastSeen, hypervisor.AgentFacts = lastSeen, agentFacts
+
 	if !saveHypervisorHelper(hr, hypervisor) {
 		return
 	}
+	if err := models.SetHypervisorStatuses([]*models.Hypervisor{hypervisor}); err != nil {
+		hr.JSONError(http.StatusInternalServerError, err)
+		return
+	}
 	hr.JSON(http.StatusOK, hypervisor)
 }
 
@@ -104,6 +307,66 @@ func DeleteHypervisor(w http.ResponseWriter, r *http.Request) {
 	hr.JSON(http.StatusOK, hypervisor)
 }
 
+// TransitionHypervisor moves the hypervisor to a new state
+func TransitionHypervisor(w http.ResponseWriter, r *http.Request) {
+	hr := HTTPResponse{w}
+	hypervisor, ok := getHypervisorHelper(hr, r)
+	if !ok {
+		return
+	}
+
+	// Parse Request
+	var params struct {
+		State string `json:"state"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		hr.JSONMsg(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err := hypervisor.Transition(params.State); err != nil {
+		switch err {
+		case models.ErrBadHypervisorState:
+			hr.JSONMsg(http.StatusBadRequest, err.Error())
+		case models.ErrIllegalTransition:
+			hr.JSONMsg(http.StatusConflict, err.Error())
+		default:
+			hr.JSONError(http.StatusInternalServerError, err)
+		}
+		return
+	}
+	hr.JSON(http.StatusOK, hypervisor)
+}
+
+// HeartbeatHypervisor records that the hypervisor is alive, along with any
+// facts reported by its agent
+func HeartbeatHypervisor(w http.ResponseWriter, r *http.Request) {
+	hr := HTTPResponse{w}
+	hypervisor, ok := getHypervisorHelper(hr, r)
+	if !ok {
+		return
+	}
+
+	// Parse Request. An empty body is a heartbeat without facts
+	var params struct {
+		Facts map[string]string `json:"facts"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil && err != io.EOF {
+		hr.JSONMsg(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err := hypervisor.Heartbeat(params.Facts); err != nil {
+		hr.JSONError(http.StatusInternalServerError, err)
+		return
+	}
+	if err := models.SetHypervisorStatuses([]*models.Hypervisor{hypervisor}); err != nil {
+		hr.JSONError(http.StatusInternalServerError, err)
+		return
+	}
+	hr.JSON(http.StatusOK, hypervisor)
+}
+
 // GetHypervisorIPRanges gets a list of ipranges associated with the hypervisor
 func GetHypervisorIPRanges(w http.ResponseWriter, r *http.Request) {
 	hr := HTTPResponse{w}
@@ -183,6 +446,375 @@ func RemoveHypervisorIPRange(w http.ResponseWriter, r *http.Request) {
 	hr.JSON(http.StatusOK, &struct{}{})
 }
 
+// GetHypervisorDHCP renders DHCP server configuration for the hypervisor's
+// ipranges
+func GetHypervisorDHCP(w http.ResponseWriter, r *http.Request) {
+	hr := HTTPResponse{w}
+	hypervisor, ok := getHypervisorHelper(hr, r)
+	if !ok {
+		return
+	}
+
+	query := r.URL.Query()
+	format := query.Get("format")
+	if format == "" {
+		format = models.DHCPFormatDnsmasq
+	}
+	family := 0
+	if value := query.Get("family"); value != "" {
+		var err error
+		if family, err = strconv.Atoi(value); err != nil {
+			hr.JSONMsg(http.StatusBadRequest, models.ErrBadIPFamily.Error())
+			return
+		}
+	}
+
+	config, err := hypervisor.DHCPConfig(format, family)
+	if err != nil {
+		if err == models.ErrBadDHCPFormat || err == models.ErrBadIPFamily {
+			hr.JSONMsg(http.StatusBadRequest, err.Error())
+			return
+		}
+		hr.JSONError(http.StatusInternalServerError, err)
+		return
+	}
+	hr.Text(http.StatusOK, config)
+}
+
+// GetHypervisorFit gets how many instances of a flavor fit on the hypervisor,
+// or of each flavor if none is given
+func GetHypervisorFit(w http.ResponseWriter, r *http.Request) {
+	hr := HTTPResponse{w}
+	hypervisor, ok := getHypervisorHelper(hr, r)
+	if !ok {
+		return
+	}
+
+	flavorID := r.URL.Query().Get("flavor")
+	if flavorID == "" {
+		fits, err := hypervisor.Fits()
+		if err != nil {
+			hr.JSONError(http.StatusInternalServerError, err)
+			return
+		}
+		hr.JSON(http.StatusOK, fits)
+		return
+	}
+	if uuid.Parse(flavorID) == nil {
+		hr.JSONMsg(http.StatusBadRequest, "invalid flavor id")
+		return
+	}
+	flavor, err := models.FetchFlavor(flavorID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			hr.JSONMsg(http.StatusBadRequest, "flavor not found")
+			return
+		}
+		hr.JSONError(http.StatusInternalServerError, err)
+		return
+	}
+	hr.JSON(http.StatusOK, hypervisor.Fit(flavor))
+}
+
+// GetHypervisorConfig gets the config that applies to the hypervisor, with the
+// source of each value
+func GetHypervisorConfig(w http.ResponseWriter, r *http.Request) {
+	hr := HTTPResponse{w}
+	hypervisor, ok := getHypervisorHelper(hr, r)
+	if !ok {
+		return
+	}
+	config, err := hypervisor.EffectiveConfig()
+	if err != nil {
+		hr.JSONError(http.StatusInternalServerError, err)
+		return
+	}
+	hr.JSON(http.StatusOK, config)
+}
+
+// GetHypervisorInterfaces gets a list of the hypervisor's interfaces beyond its
+// management interface
+func GetHypervisorInterfaces(w http.ResponseWriter, r *http.Request) {
+	hr := HTTPResponse{w}
+	hypervisor, ok := getHypervisorHelper(hr, r)
+	if !ok {
+		return
+	}
+	if err := hypervisor.LoadInterfaces(); err != nil {
+		hr.JSONError(http.StatusInternalServerError, err)
+		return
+	}
+	hr.JSON(http.StatusOK, hypervisor.Interfaces)
+}
+
+// CreateHypervisorInterface adds an interface to the hypervisor
+func CreateHypervisorInterface(w http.ResponseWriter, r *http.Request) {
+	hr := HTTPResponse{w}
+	hypervisor, ok := getHypervisorHelper(hr, r)
+	if !ok {
+		return
+	}
+
+	// Parse Request
+	iface := &models.HypervisorInterface{}
+	if err := iface.Decode(r.Body); err != nil {
+		hr.JSONMsg(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// Assign an ID
+	if iface.ID != "" {
+		hr.JSONMsg(http.StatusBadRequest, "id must not be defined")
+		return
+	}
+	iface.NewID()
+	iface.HypervisorID = hypervisor.ID
+
+	if !saveHypervisorInterfaceHelper(hr, iface) {
+		return
+	}
+	hr.JSON(http.StatusCreated, iface)
+}
+
+// GetHypervisorInterface gets a particular interface of the hypervisor
+func GetHypervisorInterface(w http.ResponseWriter, r *http.Request) {
+	hr := HTTPResponse{w}
+	iface, ok := getHypervisorInterfaceHelper(hr, r)
+	if !ok {
+		return
+	}
+	hr.JSON(http.StatusOK, iface)
+}
+
+// UpdateHypervisorInterface updates an existing interface of the hypervisor
+func UpdateHypervisorInterface(w http.ResponseWriter, r *http.Request) {
+	hr := HTTPResponse{w}
+	iface, ok := getHypervisorInterfaceHelper(hr, r)
+	if !ok {
+		return // Specific response handled by getHypervisorInterfaceHelper
+	}
+	id, hypervisorID := iface.ID, iface.HypervisorID
+
+	// Parse Request
+	if err := iface.Decode(r.Body); err != nil {
+		hr.JSONMsg(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// Interfaces stay with their hypervisor
+	iface.ID, iface.HypervisorID = id, hypervisorID
+
+	if !saveHypervisorInterfaceHelper(hr, iface) {
+		return
+	}
+	hr.JSON(http.StatusOK, iface)
+}
+
+// DeleteHypervisorInterface removes an interface from the hypervisor
+func DeleteHypervisorInterface(w http.ResponseWriter, r *http.Request) {
+	hr := HTTPResponse{w}
+	iface, ok := getHypervisorInterfaceHelper(hr, r)
+	if !ok {
+		return
+	}
+
+	if err := iface.Delete(); err != nil {
+		hr.JSONError(http.StatusInternalServerError, err)
+		return
+	}
+	hr.JSON(http.StatusOK, iface)
+}
+
+// GetHypervisorBMC gets the hypervisor's BMC, without its password
+func GetHypervisorBMC(w http.ResponseWriter, r *http.Request) {
+	hr := HTTPResponse{w}
+	bmc, ok := getHypervisorBMCHelper(hr, r)
+	if !ok {
+		return
+	}
+	hr.JSON(http.StatusOK, bmc)
+}
+
+// SetHypervisorBMC sets the hypervisor's BMC. The stored password is kept
+// unless a new one is given.
+func SetHypervisorBMC(w http.ResponseWriter, r *http.Request) {
+	hr := HTTPResponse{w}
+	hypervisor, ok := getHypervisorHelper(hr, r)
+	if !ok {
+		return
+	}
+	bmc, err := models.FetchBMC(hypervisor)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			hr.JSONError(http.StatusInternalServerError, err)
+			return
+		}
+		bmc = models.NewBMC(hypervisor)
+	}
+
+	// Parse Request
+	if err := bmc.Decode(r.Body); err != nil {
+		hr.JSONMsg(http.StatusBadRequest, err.Error())
+		return
+	}
+	bmc.HypervisorID = hypervisor.ID
+
+	if err := bmc.Validate(); err != nil {
+		hr.JSONMsg(http.StatusBadRequest, err.Error())
+		return
+	}
+	if err := bmc.Save(); err != nil {
+		hr.JSONError(http.StatusInternalServerError, err)
+		return
+	}
+	hr.JSON(http.StatusOK, bmc)
+}
+
+// DeleteHypervisorBMC removes the hypervisor's BMC
+func DeleteHypervisorBMC(w http.ResponseWriter, r *http.Request) {
+	hr := HTTPResponse{w}
+	bmc, ok := getHypervisorBMCHelper(hr, r)
+	if !ok {
+		return
+	}
+
+	if err := bmc.Delete(); err != nil {
+		hr.JSONError(http.StatusInternalServerError, err)
+		return
+	}
+	hr.JSON(http.StatusOK, bmc)
+}
+
+// RevealHypervisorBMC gets the decrypted credentials of the hypervisor's BMC.
+// This is the only way the password is ever returned, so it is refused unless
+// revealing is enabled in the secrets config and the request carries the
+// configured reveal token in the X-Reveal-Token header.
+func RevealHypervisorBMC(w http.ResponseWriter, r *http.Request) {
+	hr := HTTPResponse{w}
+	secrets := conf.Get().Secrets
+	if !secrets.RevealAllowed(r.Header.Get("X-Reveal-Token")) {
+		hr.JSONMsg(http.StatusForbidden, "revealing BMC credentials is not allowed")
+		return
+	}
+	bmc, ok := getHypervisorBMCHelper(hr, r)
+	if !ok {
+		return
+	}
+	credentials, err := bmc.Credentials()
+	if err != nil {
+		hr.JSONError(http.StatusInternalServerError, err)
+		return
+	}
+	hr.JSON(http.StatusOK, credentials)
+}
+
+// GetHypervisorFacts gets the latest hardware facts reported for the
+// hypervisor, or a particular version of them
+func GetHypervisorFacts(w http.ResponseWriter, r *http.Request) {
+	hr := HTTPResponse{w}
+	hypervisor, ok := getHypervisorHelper(hr, r)
+	if !ok {
+		return
+	}
+	version, ok := factsVersionHelper(hr, mux.Vars(r)["version"])
+	if !ok {
+		return
+	}
+	report, ok := getHardwareFactsReportHelper(hr, hypervisor, version)
+	if !ok {
+		return
+	}
+	hr.JSON(http.StatusOK, report)
+}
+
+// ReportHypervisorFacts stores a new version of the hypervisor's hardware facts
+func ReportHypervisorFacts(w http.ResponseWriter, r *http.Request) {
+	hr := HTTPResponse{w}
+	hypervisor, ok := getHypervisorHelper(hr, r)
+	if !ok {
+		return
+	}
+
+	// Parse Request
+	var facts models.HardwareFacts
+	if err := facts.Decode(r.Body); err != nil {
+		hr.JSONMsg(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	report, err := hypervisor.ReportHardwareFacts(facts)
+	if err != nil {
+		if err == models.ErrNilFacts {
+			hr.JSONMsg(http.StatusBadRequest, err.Error())
+			return
+		}
+		hr.JSONError(http.StatusInternalServerError, err)
+		return
+	}
+	hr.JSON(http.StatusCreated, report)
+}
+
+// GetHypervisorFactsHistory gets every version of the hardware facts reported
+// for the hypervisor, oldest first
+func GetHypervisorFactsHistory(w http.ResponseWriter, r *http.Request) {
+	hr := HTTPResponse{w}
+	hypervisor, ok := getHypervisorHelper(hr, r)
+	if !ok {
+		return
+	}
+	reports, err := models.HardwareFactsReportsByHypervisor(hypervisor)
+	if err != nil {
+		hr.JSONError(http.StatusInternalServerError, err)
+		return
+	}
+	hr.JSON(http.StatusOK, reports)
+}
+
+// DiffHypervisorFacts gets the differences between two versions of the
+// hardware facts reported for the hypervisor. The to version defaults to the
+// latest and the from version to the one before it.
+func DiffHypervisorFacts(w http.ResponseWriter, r *http.Request) {
+	hr := HTTPResponse{w}
+	hypervisor, ok := getHypervisorHelper(hr, r)
+	if !ok {
+		return
+	}
+
+	query := r.URL.Query()
+	from, ok := factsVersionHelper(hr, query.Get("from"))
+	if !ok {
+		return
+	}
+	to, ok := factsVersionHelper(hr, query.Get("to"))
+	if !ok {
+		return
+	}
+
+	toReport, ok := getHardwareFactsReportHelper(hr, hypervisor, to)
+	if !ok {
+		return
+	}
+	if from == 0 {
+		from = toReport.Version - 1
+	}
+	// The first report is compared against no facts at all
+	fromReport := &models.HardwareFactsReport{
+		HypervisorID: hypervisor.ID,
+		Facts:        models.HardwareFacts{},
+	}
+	if from > 0 {
+		if fromReport, ok = getHardwareFactsReportHelper(hr, hypervisor, from); !ok {
+			return
+		}
+	}
+
+	hr.JSON(http.StatusOK, map[string]interface{}{
+		"from":    fromReport.Version,
+		"to":      toReport.Version,
+		"changes": models.DiffHardwareFacts(fromReport, toReport),
+	})
+}
+
 // getHypervisorHelper gets the hypervisor object and handles sending a response
 // in case of error
 func getHypervisorHelper(hr HTTPResponse, r *http.Request) (*models.Hypervisor, bool) {
@@ -217,8 +849,133 @@ func saveHypervisorHelper(hr HTTPResponse, hypervisor *models.Hypervisor) bool {
 	}
 	// Save
 	if err := hypervisor.Save(); err != nil {
+		if hypervisorConflictHelper(hr, err) {
+			return false
+		}
+		if err == models.ErrRackNotFound {
+			hr.JSONMsg(http.StatusBadRequest, err.Error())
+			return false
+		}
+		hr.JSONError(http.StatusInternalServerError, err)
+		return false
+	}
+	return true
+}
+
+// getHypervisorInterfaceHelper gets the interface object, making sure it
+// belongs to the hypervisor, and handles sending a response in case of error
+func getHypervisorInterfaceHelper(hr HTTPResponse, r *http.Request) (*models.HypervisorInterface, bool) {
+	hypervisor, ok := getHypervisorHelper(hr, r)
+	if !ok {
+		return nil, false
+	}
+	vars := mux.Vars(r)
+	interfaceID := vars["interfaceID"]
+	if uuid.Parse(interfaceID) == nil {
+		hr.JSONMsg(http.StatusBadRequest, "invalid interface id")
+		return nil, false
+	}
+	iface, err := models.FetchHypervisorInterface(interfaceID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			hr.JSONMsg(http.StatusNotFound, "not found")
+			return nil, false
+		}
 		hr.JSONError(http.StatusInternalServerError, err)
+		return nil, false
+	}
+	if iface.HypervisorID != hypervisor.ID {
+		hr.JSONMsg(http.StatusNotFound, "not found")
+		return nil, false
+	}
+	return iface, true
+}
+
+// saveHypervisorInterfaceHelper saves the interface object and handles sending
+// a response in case of error
+func saveHypervisorInterfaceHelper(hr HTTPResponse, iface *models.HypervisorInterface) bool {
+	if err := iface.Validate(); err != nil {
+		hr.JSONMsg(http.StatusBadRequest, err.Error())
+		return false
+	}
+	// Save
+	if err := iface.Save(); err != nil {
+		if hypervisorConflictHelper(hr, err) {
+			return false
+		}
+		switch err {
+		case models.ErrInterfaceNameInUse:
+			hr.JSONMsg(http.StatusConflict, err.Error())
+		case models.ErrNetworkNotFound, models.ErrBondNotFound, models.ErrBondCycle:
+			hr.JSONMsg(http.StatusBadRequest, err.Error())
+		default:
+			hr.JSONError(http.StatusInternalServerError, err)
+		}
+		return false
+	}
+	return true
+}
+
+// getHypervisorBMCHelper gets the hypervisor's BMC object and handles sending
+// a response in case of error
+func getHypervisorBMCHelper(hr HTTPResponse, r *http.Request) (*models.BMC, bool) {
+	hypervisor, ok := getHypervisorHelper(hr, r)
+	if !ok {
+		return nil, false
+	}
+	bmc, err := models.FetchBMC(hypervisor)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			hr.JSONMsg(http.StatusNotFound, "not found")
+			return nil, false
+		}
+		hr.JSONError(http.StatusInternalServerError, err)
+		return nil, false
+	}
+	return bmc, true
+}
+
+// factsVersionHelper parses a hardware facts version, treating none as 0 for
+// the latest, and handles sending a response in case of error
+func factsVersionHelper(hr HTTPResponse, value string) (int, bool) {
+	if value == "" {
+		return 0, true
+	}
+	version, err := strconv.Atoi(value)
+	if err != nil || version < 1 {
+		hr.JSONMsg(http.StatusBadRequest, "invalid version")
+		return 0, false
+	}
+	return version, true
+}
+
+// getHardwareFactsReportHelper gets a version of the hypervisor's hardware
+// facts, the latest for version 0, and handles sending a response in case of
+// error
+func getHardwareFactsReportHelper(hr HTTPResponse, hypervisor *models.Hypervisor, version int) (*models.HardwareFactsReport, bool) {
+	report, err := models.FetchHardwareFactsReport(hypervisor, version)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			hr.JSONMsg(http.StatusNotFound, "not found")
+			return nil, false
+		}
+		hr.JSONError(http.StatusInternalServerError, err)
+		return nil, false
+	}
+	return report, true
+}
+
+// hypervisorConflictHelper sends a response naming the conflicting hypervisor
+// if the error is a HypervisorConflictError, returning whether it did
+func hypervisorConflictHelper(hr HTTPResponse, err error) bool {
+	conflict, ok := err.(*models.HypervisorConflictError)
+	if !ok {
 		return false
 	}
+	hr.JSON(http.StatusConflict, map[string]string{
+		"message": conflict.Error(),
+		"field":   conflict.Field,
+		"id":      conflict.ID,
+	})
 	return true
 }
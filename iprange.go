@@ -3,6 +3,7 @@ package operator
 import (
 	"database/sql"
 	"encoding/json"
+	"net"
 	"net/http"
 
 	"code.google.com/p/go-uuid/uuid"
@@ -25,11 +26,23 @@ func RegisterIPRangeRoutes(prefix string, router *mux.Router) {
 	RegisterOneRoute(sub, RouteInfo{"/{iprangeID}/network", GetIPRangeNetwork, []string{"GET"}, "ipranges.hypervisors.getnetwork"})
 	RegisterOneRoute(sub, RouteInfo{"/{iprangeID}/network/{networkID}", SetIPRangeNetwork, []string{"PUT"}, "ipranges.hypervisors.setnetwork"})
 	RegisterOneRoute(sub, RouteInfo{"/{iprangeID}/network/{networkID}", RemoveIPRangeNetwork, []string{"DELETE"}, "ipranges.hypervisors.removenetwork"})
+	RegisterOneRoute(sub, RouteInfo{"/{iprangeID}/allocations", GetIPRangeAllocations, []string{"GET"}, "ipranges.allocations.get"})
+	RegisterOneRoute(sub, RouteInfo{"/{iprangeID}/allocations", CreateIPRangeAllocation, []string{"POST"}, "ipranges.allocations.create"})
+	RegisterOneRoute(sub, RouteInfo{"/{iprangeID}/allocations/{ip}", DeleteIPRangeAllocation, []string{"DELETE"}, "ipranges.allocations.delete"})
+	RegisterOneRoute(sub, RouteInfo{"/{iprangeID}/usage", GetIPRangeUsage, []string{"GET"}, "ipranges.usage.get"})
+	RegisterOneRoute(sub, RouteInfo{"/{iprangeID}/exclusions", GetIPRangeExclusions, []string{"GET"}, "ipranges.exclusions.get"})
+	RegisterOneRoute(sub, RouteInfo{"/{iprangeID}/exclusions", CreateIPRangeExclusion, []string{"POST"}, "ipranges.exclusions.create"})
+	RegisterOneRoute(sub, RouteInfo{"/{iprangeID}/exclusions/{exclusionID}", DeleteIPRangeExclusion, []string{"DELETE"}, "ipranges.exclusions.delete"})
 }
 
-// ListIPRanges gets a list of all ipranges
+// ListIPRanges gets a list of all ipranges, or looks up the owners of an
+// address if one is given with the contains query parameter
 func ListIPRanges(w http.ResponseWriter, r *http.Request) {
 	hr := HTTPResponse{w}
+	if contains := r.URL.Query().Get("contains"); contains != "" {
+		lookupIPRanges(hr, contains)
+		return
+	}
 	ipranges, err := models.ListIPRanges()
 	if err != nil {
 		hr.JSONError(http.StatusInternalServerError, err)
@@ -38,6 +51,49 @@ func ListIPRanges(w http.ResponseWriter, r *http.Request) {
 	hr.JSON(http.StatusOK, ipranges)
 }
 
+// lookupIPRanges finds the ipranges, with their networks and hypervisors, as
+// well as any hypervisors that own an address
+func lookupIPRanges(hr HTTPResponse, address string) {
+	ip := net.ParseIP(address)
+	if ip == nil {
+		hr.JSONMsg(http.StatusBadRequest, "invalid ip")
+		return
+	}
+	ipranges, err := models.IPRangesContaining(ip)
+	if err != nil {
+		hr.JSONError(http.StatusInternalServerError, err)
+		return
+	}
+	hypervisors, err := models.HypervisorsByIP(ip)
+	if err != nil {
+		hr.JSONError(http.StatusInternalServerError, err)
+		return
+	}
+
+	type owner struct {
+		IPRange     *models.IPRange      `json:"iprange"`
+		Network     *models.Network      `json:"network"`
+		Hypervisors []*models.Hypervisor `json:"hypervisors"`
+	}
+	owners := make([]*owner, len(ipranges))
+	for i, iprange := range ipranges {
+		owners[i] = &owner{
+			IPRange:     iprange,
+			Network:     iprange.Network,
+			Hypervisors: iprange.Hypervisors,
+		}
+	}
+	hr.JSON(http.StatusOK, &struct {
+		IP          string               `json:"ip"`
+		IPRanges    []*owner             `json:"ipranges"`
+		Hypervisors []*models.Hypervisor `json:"hypervisors"`
+	}{
+		IP:          ip.String(),
+		IPRanges:    owners,
+		Hypervisors: hypervisors,
+	})
+}
+
 // GetIPRange gets a particular iprange
 func GetIPRange(w http.ResponseWriter, r *http.Request) {
 	hr := HTTPResponse{w}
@@ -212,6 +268,10 @@ func SetIPRangeNetwork(w http.ResponseWriter, r *http.Request) {
 	networkID, ok := vars["networkID"]
 
 	if err := iprange.SetNetwork(&models.Network{ID: networkID}); err != nil {
+		if _, ok := err.(*models.OverlapError); ok || err == models.ErrSegmentInUse || err == models.ErrExclusionOutsidePool || err == models.ErrIPAllocated {
+			hr.JSONMsg(http.StatusConflict, err.Error())
+			return
+		}
 		hr.JSONMsg(http.StatusInternalServerError, err.Error())
 		return
 	}
@@ -236,6 +296,185 @@ func RemoveIPRangeNetwork(w http.ResponseWriter, r *http.Request) {
 	hr.JSON(http.StatusOK, &struct{}{})
 }
 
+// GetIPRangeAllocations gets a list of addresses allocated from the iprange
+func GetIPRangeAllocations(w http.ResponseWriter, r *http.Request) {
+	hr := HTTPResponse{w}
+	iprange, ok := getIPRangeHelper(hr, r)
+	if !ok {
+		return
+	}
+	if err := iprange.LoadAllocations(); err != nil {
+		hr.JSONError(http.StatusInternalServerError, err)
+		return
+	}
+	hr.JSON(http.StatusOK, iprange.Allocations)
+}
+
+// CreateIPRangeAllocation allocates either a requested address or the next
+// free address from the iprange
+func CreateIPRangeAllocation(w http.ResponseWriter, r *http.Request) {
+	hr := HTTPResponse{w}
+	iprange, ok := getIPRangeHelper(hr, r)
+	if !ok {
+		return
+	}
+
+	// Parse Request
+	allocation := models.NewIPAllocation()
+	if err := allocation.Decode(r.Body); err != nil {
+		hr.JSONMsg(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err := iprange.Allocate(allocation); err != nil {
+		switch err {
+		case models.ErrIPNotInPool, models.ErrBadHypervisorID, models.ErrHypervisorNotFound, models.ErrHypervisorNotInIPRange,
+			models.ErrNoMAC, models.ErrBadMAC, models.ErrIPNotSLAAC:
+			hr.JSONMsg(http.StatusBadRequest, err.Error())
+		case models.ErrIPAllocated, models.ErrIPReserved, models.ErrIPRangeExhausted:
+			hr.JSONMsg(http.StatusConflict, err.Error())
+		default:
+			hr.JSONError(http.StatusInternalServerError, err)
+		}
+		return
+	}
+	hr.JSON(http.StatusCreated, allocation)
+}
+
+// DeleteIPRangeAllocation releases an allocated address back to the iprange
+func DeleteIPRangeAllocation(w http.ResponseWriter, r *http.Request) {
+	hr := HTTPResponse{w}
+	iprange, ok := getIPRangeHelper(hr, r)
+	if !ok {
+		return
+	}
+
+	vars := mux.Vars(r)
+	ip := net.ParseIP(vars["ip"])
+	if ip == nil {
+		hr.JSONMsg(http.StatusBadRequest, "invalid ip")
+		return
+	}
+
+	if err := iprange.Release(ip); err != nil {
+		if err == models.ErrIPNotAllocated {
+			hr.JSONMsg(http.StatusNotFound, err.Error())
+			return
+		}
+		hr.JSONError(http.StatusInternalServerError, err)
+		return
+	}
+	hr.JSON(http.StatusOK, &struct{}{})
+}
+
+// GetIPRangeUsage gets the counts of allocated, reserved, and free addresses in
+// the iprange
+func GetIPRangeUsage(w http.ResponseWriter, r *http.Request) {
+	hr := HTTPResponse{w}
+	iprange, ok := getIPRangeHelper(hr, r)
+	if !ok {
+		return
+	}
+	usage, err := iprange.Usage()
+	if err != nil {
+		hr.JSONError(http.StatusInternalServerError, err)
+		return
+	}
+	hr.JSON(http.StatusOK, usage)
+}
+
+// GetIPRangeExclusions gets a list of addresses excluded from allocation in
+// the iprange
+func GetIPRangeExclusions(w http.ResponseWriter, r *http.Request) {
+	hr := HTTPResponse{w}
+	iprange, ok := getIPRangeHelper(hr, r)
+	if !ok {
+		return
+	}
+	if err := iprange.LoadExclusions(); err != nil {
+		hr.JSONError(http.StatusInternalServerError, err)
+		return
+	}
+	hr.JSON(http.StatusOK, iprange.Exclusions)
+}
+
+// CreateIPRangeExclusion excludes an address or span of addresses in the
+// iprange from allocation
+func CreateIPRangeExclusion(w http.ResponseWriter, r *http.Request) {
+	hr := HTTPResponse{w}
+	iprange, ok := getIPRangeHelper(hr, r)
+	if !ok {
+		return
+	}
+
+	// Parse Request
+	exclusion := &models.IPExclusion{}
+	if err := exclusion.Decode(r.Body); err != nil {
+		hr.JSONMsg(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// Assign an ID
+	if exclusion.ID != "" {
+		hr.JSONMsg(http.StatusBadRequest, "id must not be defined")
+		return
+	}
+	exclusion.NewID()
+	exclusion.IPRangeID = iprange.ID
+
+	if err := exclusion.Validate(); err != nil {
+		hr.JSONMsg(http.StatusBadRequest, err.Error())
+		return
+	}
+	if err := exclusion.Save(); err != nil {
+		switch err {
+		case models.ErrExclusionNotInPool:
+			hr.JSONMsg(http.StatusBadRequest, err.Error())
+		case models.ErrExclusionOverlap, models.ErrIPAllocated:
+			hr.JSONMsg(http.StatusConflict, err.Error())
+		default:
+			hr.JSONError(http.StatusInternalServerError, err)
+		}
+		return
+	}
+	hr.JSON(http.StatusCreated, exclusion)
+}
+
+// DeleteIPRangeExclusion removes an exclusion from the iprange
+func DeleteIPRangeExclusion(w http.ResponseWriter, r *http.Request) {
+	hr := HTTPResponse{w}
+	iprange, ok := getIPRangeHelper(hr, r)
+	if !ok {
+		return
+	}
+
+	vars := mux.Vars(r)
+	exclusionID := vars["exclusionID"]
+	if uuid.Parse(exclusionID) == nil {
+		hr.JSONMsg(http.StatusBadRequest, "invalid exclusion id")
+		return
+	}
+	exclusion, err := models.FetchIPExclusion(exclusionID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			hr.JSONMsg(http.StatusNotFound, "not found")
+			return
+		}
+		hr.JSONError(http.StatusInternalServerError, err)
+		return
+	}
+	if exclusion.IPRangeID != iprange.ID {
+		hr.JSONMsg(http.StatusNotFound, "not found")
+		return
+	}
+
+	if err := exclusion.Delete(); err != nil {
+		hr.JSONError(http.StatusInternalServerError, err)
+		return
+	}
+	hr.JSON(http.StatusOK, exclusion)
+}
+
 // getIPRangeHelper gets the iprange object and handles sending a response in
 // case of error
 func getIPRangeHelper(hr HTTPResponse, r *http.Request) (*models.IPRange, bool) {
@@ -270,6 +509,10 @@ func saveIPRangeHelper(hr HTTPResponse, iprange *models.IPRange) bool {
 	}
 	// Save
 	if err := iprange.Save(); err != nil {
+		if _, ok := err.(*models.OverlapError); ok || err == models.ErrSegmentInUse || err == models.ErrExclusionOutsidePool || err == models.ErrIPAllocated {
+			hr.JSONMsg(http.StatusConflict, err.Error())
+			return false
+		}
 		hr.JSONError(http.StatusInternalServerError, err)
 		return false
 	}
@@ -0,0 +1,272 @@
+package models
+
+import (
+	"database/sql"
+	"encoding/json"
+	"io"
+
+	"code.google.com/p/go-uuid/uuid"
+	"github.com/hashicorp/go-multierror"
+	"github.com/mistifyio/mistify-operator-admin/db"
+)
+
+const (
+	// BMCProtocolIPMI is for a BMC managed over IPMI
+	BMCProtocolIPMI = "ipmi"
+	// BMCProtocolRedfish is for a BMC managed over Redfish
+	BMCProtocolRedfish = "redfish"
+)
+
+type (
+	// BMC describes the out-of-band management controller of a hypervisor. The
+	// password is stored encrypted and is never marshalled into JSON; it is only
+	// set when changing it and is otherwise revealed through Credentials.
+	BMC struct {
+		HypervisorID string            `json:"hypervisor"`
+		Address      string            `json:"address"`
+		Protocol     string            `json:"protocol"`
+		Username     string            `json:"username"`
+		Password     string            `json:"password"`
+		PasswordSet  bool              `json:"password_set"`
+		Metadata     map[string]string `json:"metadata"`
+		password     string            // Encrypted, as stored
+	}
+
+	// bmcData is a middle-man for JSON (un)marshalling
+	bmcData struct {
+		HypervisorID string            `json:"hypervisor"`
+		Address      string            `json:"address"`
+		Protocol     string            `json:"protocol"`
+		Username     string            `json:"username"`
+		Password     string            `json:"password,omitempty"`
+		PasswordSet  bool              `json:"password_set"`
+		Metadata     map[string]string `json:"metadata"`
+	}
+
+	// BMCCredentials are the revealed credentials of a BMC
+	BMCCredentials struct {
+		Username string `json:"username"`
+		Password string `json:"password"`
+	}
+)
+
+// UnmarshalJSON unmarshals JSON into a BMC object. Whether a password is set
+// only comes from the database.
+func (bmc *BMC) UnmarshalJSON(b []byte) error {
+	data := &bmcData{}
+	if err := json.Unmarshal(b, data); err != nil {
+		return err
+	}
+	bmc.HypervisorID = data.HypervisorID
+	bmc.Address = data.Address
+	bmc.Protocol = data.Protocol
+	bmc.Username = data.Username
+	bmc.Password = data.Password
+	bmc.Metadata = data.Metadata
+	return nil
+}
+
+// MarshalJSON marshals a BMC object into JSON, leaving out the password
+func (bmc BMC) MarshalJSON() ([]byte, error) {
+	return json.Marshal(&bmcData{
+		HypervisorID: bmc.HypervisorID,
+		Address:      bmc.Address,
+		Protocol:     bmc.Protocol,
+		Username:     bmc.Username,
+		PasswordSet:  bmc.PasswordSet,
+		Metadata:     bmc.Metadata,
+	})
+}
+
+// secretContext returns the context the password is encrypted with, tying it to
+// the hypervisor
+func (bmc *BMC) secretContext() string {
+	return "bmc:" + bmc.HypervisorID
+}
+
+// Validate ensures the BMC properties are set correctly
+func (bmc *BMC) Validate() error {
+	var results *multierror.Error
+	if uuid.Parse(bmc.HypervisorID) == nil {
+		results = multierror.Append(results, ErrBadHypervisorID)
+	}
+	if bmc.Address == "" {
+		results = multierror.Append(results, ErrNoAddress)
+	}
+	if bmc.Protocol != BMCProtocolIPMI && bmc.Protocol != BMCProtocolRedfish {
+		results = multierror.Append(results, ErrBadBMCProtocol)
+	}
+	if bmc.Metadata == nil {
+		results = multierror.Append(results, ErrNilMetadata)
+	}
+	return results.ErrorOrNil()
+}
+
+// Save persists a BMC to the database. The password is encrypted and replaced
+// only if one is given; otherwise the stored password is kept.
+func (bmc *BMC) Save() error {
+	if err := bmc.Validate(); err != nil {
+		return err
+	}
+	var password string
+	if bmc.Password != "" {
+		var err error
+		if password, err = encryptSecret(bmc.Password, bmc.secretContext()); err != nil {
+			return err
+		}
+	}
+	d, err := db.Connect(nil)
+	if err != nil {
+		return err
+	}
+	// Writable CTE for an Upsert
+	// See: http://stackoverflow.com/a/8702291
+	// And: http://dba.stackexchange.com/a/78535
+	sql := `
+	WITH new_values (hypervisor_id, address, protocol, username, password, metadata) as (
+		VALUES ($1::uuid, $2, $3, $4, $5::text, $6::json)
+	),
+	upsert as (
+		UPDATE hypervisor_bmcs b SET
+			address = nv.address,
+			protocol = nv.protocol,
+			username = nv.username,
+			password = COALESCE(nv.password, b.password),
+			metadata = nv.metadata
+		FROM new_values nv
+		WHERE b.hypervisor_id = nv.hypervisor_id
+		RETURNING b.hypervisor_id
+	)
+	INSERT INTO hypervisor_bmcs
+		(hypervisor_id, address, protocol, username, password, metadata)
+	SELECT hypervisor_id, address, protocol, username, COALESCE(password, ''), metadata
+	FROM new_values nv
+	WHERE NOT EXISTS (SELECT 1 FROM upsert u WHERE nv.hypervisor_id = u.hypervisor_id)
+	`
+	metadata, err := json.Marshal(bmc.Metadata)
+	if err != nil {
+		return err
+	}
+	_, err = d.Exec(sql,
+		bmc.HypervisorID,
+		bmc.Address,
+		bmc.Protocol,
+		bmc.Username,
+		nullString(password),
+		string(metadata),
+	)
+	if err != nil {
+		return err
+	}
+	if password != "" {
+		bmc.password = password
+		bmc.PasswordSet = true
+	}
+	bmc.Password = ""
+	return nil
+}
+
+// Delete removes a BMC from the database
+func (bmc *BMC) Delete() error {
+	d, err := db.Connect(nil)
+	if err != nil {
+		return err
+	}
+	sql := "DELETE FROM hypervisor_bmcs WHERE hypervisor_id = $1"
+	_, err = d.Exec(sql, bmc.HypervisorID)
+	return err
+}
+
+// Load retrieves a BMC from the database
+func (bmc *BMC) Load() error {
+	d, err := db.Connect(nil)
+	if err != nil {
+		return err
+	}
+	sql := `
+	SELECT hypervisor_id, address, protocol, username, password, metadata
+	FROM hypervisor_bmcs
+	WHERE hypervisor_id = $1
+	`
+	rows, err := d.Query(sql, bmc.HypervisorID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	rows.Next()
+	if err := bmc.fromRows(rows); err != nil {
+		return err
+	}
+	return rows.Err()
+}
+
+// fromRows unmarshals a database query result row into the BMC object
+func (bmc *BMC) fromRows(rows *sql.Rows) error {
+	var metadata string
+	err := rows.Scan(
+		&bmc.HypervisorID,
+		&bmc.Address,
+		&bmc.Protocol,
+		&bmc.Username,
+		&bmc.password,
+		&metadata,
+	)
+	if err != nil {
+		return err
+	}
+	bmc.Password = ""
+	bmc.PasswordSet = bmc.password != ""
+	return json.Unmarshal([]byte(metadata), &bmc.Metadata)
+}
+
+// Decode unmarshals JSON into the BMC object
+func (bmc *BMC) Decode(data io.Reader) error {
+	if err := json.NewDecoder(data).Decode(bmc); err != nil {
+		return err
+	}
+	if bmc.Metadata == nil {
+		bmc.Metadata = make(map[string]string)
+	} else {
+		for key, value := range bmc.Metadata {
+			if value == "" {
+				delete(bmc.Metadata, key)
+			}
+		}
+	}
+	return nil
+}
+
+// Credentials decrypts and reveals the BMC's username and password
+func (bmc *BMC) Credentials() (*BMCCredentials, error) {
+	credentials := &BMCCredentials{
+		Username: bmc.Username,
+	}
+	if bmc.password != "" {
+		password, err := decryptSecret(bmc.password, bmc.secretContext())
+		if err != nil {
+			return nil, err
+		}
+		credentials.Password = password
+	}
+	return credentials, nil
+}
+
+// NewBMC creates and initializes a new BMC object for a hypervisor
+func NewBMC(hypervisor *Hypervisor) *BMC {
+	bmc := &BMC{
+		HypervisorID: hypervisor.ID,
+		Metadata:     make(map[string]string),
+	}
+	return bmc
+}
+
+// FetchBMC retrieves the BMC of a hypervisor from the database
+func FetchBMC(hypervisor *Hypervisor) (*BMC, error) {
+	bmc := &BMC{
+		HypervisorID: hypervisor.ID,
+	}
+	if err := bmc.Load(); err != nil {
+		return nil, err
+	}
+	return bmc, nil
+}
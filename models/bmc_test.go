@@ -0,0 +1,127 @@
+package models_test
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	h "github.com/bakins/test-helpers"
+	"github.com/mistifyio/mistify-operator-admin/config"
+	"github.com/mistifyio/mistify-operator-admin/models"
+)
+
+var bmcJSON = `{
+	"hypervisor": "ebf3bfd5-9915-4ed1-bcb3-117bb48b155d",
+	"address": "10.0.0.20",
+	"protocol": "ipmi",
+	"username": "admin",
+	"password": "secret",
+	"password_set": true,
+	"metadata": {
+		"foo": "bar"
+	}
+}`
+
+func createBMC(t *testing.T) *models.BMC {
+	r := strings.NewReader(bmcJSON)
+	bmc := &models.BMC{}
+	h.Ok(t, bmc.Decode(r))
+	return bmc
+}
+
+func checkBMCValues(t *testing.T, bmc *models.BMC) {
+	h.Equals(t, "ebf3bfd5-9915-4ed1-bcb3-117bb48b155d", bmc.HypervisorID)
+	h.Equals(t, "10.0.0.20", bmc.Address)
+	h.Equals(t, models.BMCProtocolIPMI, bmc.Protocol)
+	h.Equals(t, "admin", bmc.Username)
+	h.Equals(t, map[string]string{"foo": "bar"}, bmc.Metadata)
+}
+
+func TestNewBMC(t *testing.T) {
+	hypervisor := createHypervisor(t)
+	bmc := models.NewBMC(hypervisor)
+	h.Equals(t, hypervisor.ID, bmc.HypervisorID)
+	h.Assert(t, bmc.Metadata != nil, "uninitialized metadata")
+}
+
+func TestBMCDecode(t *testing.T) {
+	bmc := createBMC(t)
+	checkBMCValues(t, bmc)
+	h.Equals(t, "secret", bmc.Password)
+	h.Assert(t, !bmc.PasswordSet, "password set should only come from the database")
+}
+
+func TestBMCMarshalJSON(t *testing.T) {
+	bmc := createBMC(t)
+	b, err := json.Marshal(bmc)
+	h.Ok(t, err)
+	h.Assert(t, !strings.Contains(string(b), "secret"), "password should not be marshalled")
+
+	var data map[string]interface{}
+	h.Ok(t, json.Unmarshal(b, &data))
+	_, ok := data["password"]
+	h.Assert(t, !ok, "password should not be marshalled")
+	h.Equals(t, false, data["password_set"])
+}
+
+func TestBMCValidate(t *testing.T) {
+	bmc := &models.BMC{}
+	var err error
+
+	err = bmc.Validate()
+	h.Assert(t, errContains(models.ErrBadHypervisorID, err), "expected ErrBadHypervisorID")
+	h.Assert(t, errContains(models.ErrNoAddress, err), "expected ErrNoAddress")
+	h.Assert(t, errContains(models.ErrBadBMCProtocol, err), "expected ErrBadBMCProtocol")
+	h.Assert(t, errContains(models.ErrNilMetadata, err), "expected ErrNilMetadata")
+
+	bmc = createBMC(t)
+	h.Ok(t, bmc.Validate())
+
+	bmc.Protocol = models.BMCProtocolRedfish
+	h.Ok(t, bmc.Validate())
+
+	bmc.Protocol = "foobar"
+	h.Assert(t, errContains(models.ErrBadBMCProtocol, bmc.Validate()), "expected ErrBadBMCProtocol")
+}
+
+func TestBMCSave(t *testing.T) {
+	h.Ok(t, config.Load(configFileName))
+
+	// Prep
+	hypervisor := createHypervisor(t)
+	h.Ok(t, hypervisor.Save())
+
+	bmc := createBMC(t)
+	h.Ok(t, bmc.Save())
+	h.Equals(t, "", bmc.Password)
+	h.Assert(t, bmc.PasswordSet, "expected password set")
+
+	bmc2, err := models.FetchBMC(hypervisor)
+	h.Ok(t, err)
+	checkBMCValues(t, bmc2)
+	h.Equals(t, "", bmc2.Password)
+	h.Assert(t, bmc2.PasswordSet, "expected password set")
+
+	credentials, err := bmc2.Credentials()
+	h.Ok(t, err)
+	h.Equals(t, "admin", credentials.Username)
+	h.Equals(t, "secret", credentials.Password)
+
+	// Saving without a password keeps the stored one
+	h.Ok(t, bmc2.Decode(strings.NewReader(`{"address": "10.0.0.21", "protocol": "redfish", "username": "root"}`)))
+	bmc2.HypervisorID = hypervisor.ID
+	h.Ok(t, bmc2.Save())
+	bmc2, err = models.FetchBMC(hypervisor)
+	h.Ok(t, err)
+	h.Equals(t, "10.0.0.21", bmc2.Address)
+	credentials, err = bmc2.Credentials()
+	h.Ok(t, err)
+	h.Equals(t, "root", credentials.Username)
+	h.Equals(t, "secret", credentials.Password)
+
+	// Cleanup
+	h.Ok(t, bmc.Delete())
+	_, err = models.FetchBMC(hypervisor)
+	h.Assert(t, err != nil, "expected BMC to be deleted")
+	h.Ok(t, hypervisor.Delete())
+}
@@ -0,0 +1,190 @@
+package models
+
+import (
+	"bytes"
+	"net"
+	"strconv"
+	"text/template"
+)
+
+// Config namespace and keys holding the iPXE boot script templates, as Go
+// text/template templates. The boot template is taken from the hypervisor's
+// effective config, so it may be overridden per location or hypervisor, while
+// the register template is taken from the global config.
+const (
+	BootConfigNamespace     = "boot"
+	BootTemplateKey         = "template"
+	BootRegisterTemplateKey = "register_template"
+)
+
+// DefaultBootTemplate is the boot script template used for known hypervisors
+// when none is configured. It boots the kernel and initrd given by the kernel
+// and initrd keys of the boot config namespace, passing the cmdline key along
+// with the hypervisor's management address.
+const DefaultBootTemplate = `#!ipxe
+kernel {{.Config.boot.kernel}} {{.Config.boot.cmdline}} ip={{.Hypervisor.IP}}::{{with .IPRange}}{{.Gateway}}:{{netmask .CIDR}}{{else}}:{{end}}:::off mistify.hypervisor={{.Hypervisor.ID}}
+initrd {{.Config.boot.initrd}}
+boot
+`
+
+// DefaultRegisterTemplate is the boot script template used for unknown MACs
+// when none is configured
+const DefaultRegisterTemplate = `#!ipxe
+echo {{.MAC}} is not a registered hypervisor
+echo Register it with the operator admin service, then reboot
+prompt --timeout 60000 Press any key to reboot ||
+reboot
+`
+
+// BootParams are the variables available to boot script templates. They only
+// hold plain values, so templates can not call methods of the models. Hypervisor
+// is nil for unknown MACs. IPRange is the hypervisor's iprange containing its
+// management IP, if any. Config is the hypervisor's effective config, or the
+// global config for unknown MACs.
+type BootParams struct {
+	MAC        string
+	Hypervisor *BootHypervisor
+	IPRanges   []*BootIPRange
+	IPRange    *BootIPRange
+	Config     map[string]map[string]string
+}
+
+// BootHypervisor is the hypervisor as seen by boot script templates
+type BootHypervisor struct {
+	ID       string
+	MAC      string
+	IP       string
+	State    string
+	CPU      int
+	Memory   int
+	Disk     int
+	RackID   string
+	Metadata map[string]string
+}
+
+// BootIPRange is an iprange as seen by boot script templates
+type BootIPRange struct {
+	ID           string
+	CIDR         string
+	Gateway      string
+	Start        string
+	End          string
+	Mode         string
+	Segment      string
+	DNSServers   []string
+	SearchDomain string
+	MTU          int
+	Metadata     map[string]string
+}
+
+// NewBootParams creates the boot script template variables for a hypervisor
+// booting from the MAC, using its loaded ipranges and the given config
+func NewBootParams(mac net.HardwareAddr, hypervisor *Hypervisor, config map[string]map[string]string) *BootParams {
+	data := hypervisor.exportData()
+	params := &BootParams{
+		MAC: mac.String(),
+		Hypervisor: &BootHypervisor{
+			ID:       data.ID,
+			MAC:      data.MAC,
+			IP:       data.IP,
+			State:    data.State,
+			CPU:      data.CPU,
+			Memory:   data.Memory,
+			Disk:     data.Disk,
+			RackID:   data.RackID,
+			Metadata: data.Metadata,
+		},
+		IPRanges: make([]*BootIPRange, len(hypervisor.IPRanges)),
+		Config:   config,
+	}
+	for i, iprange := range hypervisor.IPRanges {
+		data := iprange.exportData()
+		params.IPRanges[i] = &BootIPRange{
+			ID:           data.ID,
+			CIDR:         data.CIDR,
+			Gateway:      data.Gateway,
+			Start:        data.Start,
+			End:          data.End,
+			Mode:         data.Mode,
+			Segment:      data.Segment,
+			DNSServers:   data.DNSServers,
+			SearchDomain: data.SearchDomain,
+			MTU:          data.MTU,
+			Metadata:     data.Metadata,
+		}
+		if params.IPRange == nil && iprange.CIDR != nil && iprange.CIDR.Contains(hypervisor.IP) {
+			params.IPRange = params.IPRanges[i]
+		}
+	}
+	return params
+}
+
+// bootTemplateFuncs are the functions available to boot script templates
+var bootTemplateFuncs = template.FuncMap{
+	"netmask": func(cidr string) string {
+		_, ipnet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return ""
+		}
+		if len(ipnet.Mask) == net.IPv4len {
+			return net.IP(ipnet.Mask).String()
+		}
+		ones, _ := ipnet.Mask.Size()
+		return strconv.Itoa(ones)
+	},
+}
+
+// RenderBootScript renders a boot script template with the given params.
+// Missing config keys render as empty strings.
+func RenderBootScript(text string, params *BootParams) ([]byte, error) {
+	tmpl, err := template.New("boot").Funcs(bootTemplateFuncs).Option("missingkey=zero").Parse(text)
+	if err != nil {
+		return nil, &BootTemplateError{err}
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, params); err != nil {
+		return nil, &BootTemplateError{err}
+	}
+	return buf.Bytes(), nil
+}
+
+// BootScript renders the iPXE boot script for the hypervisor from the boot
+// template in its effective config, falling back to DefaultBootTemplate. The
+// MAC is the one the hypervisor booted from, which may be one of its
+// interfaces rather than its management MAC.
+func (hypervisor *Hypervisor) BootScript(mac net.HardwareAddr) ([]byte, error) {
+	effective, err := hypervisor.EffectiveConfig()
+	if err != nil {
+		return nil, err
+	}
+	config := effective.Values()
+	if err := hypervisor.LoadIPRanges(); err != nil {
+		return nil, err
+	}
+	params := NewBootParams(mac, hypervisor, config)
+	text := config[BootConfigNamespace][BootTemplateKey]
+	if text == "" {
+		text = DefaultBootTemplate
+	}
+	return RenderBootScript(text, params)
+}
+
+// RegisterBootScript renders the iPXE boot script for a MAC that does not
+// belong to any hypervisor from the register template in the global config,
+// falling back to DefaultRegisterTemplate
+func RegisterBootScript(mac net.HardwareAddr) ([]byte, error) {
+	global := NewConfig()
+	if err := global.Load(); err != nil {
+		return nil, err
+	}
+	params := &BootParams{
+		MAC:      mac.String(),
+		IPRanges: []*BootIPRange{},
+		Config:   global.Get(),
+	}
+	text, _ := global.GetValue(BootConfigNamespace, BootRegisterTemplateKey)
+	if text == "" {
+		text = DefaultRegisterTemplate
+	}
+	return RenderBootScript(text, params)
+}
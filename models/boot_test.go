@@ -0,0 +1,88 @@
+package models_test
+
+import (
+	"net"
+	"testing"
+
+	h "github.com/bakins/test-helpers"
+	"github.com/mistifyio/mistify-operator-admin/config"
+	"github.com/mistifyio/mistify-operator-admin/models"
+)
+
+func TestRenderBootScript(t *testing.T) {
+	hypervisor := createHypervisor(t)
+	hypervisor.IPRanges = []*models.IPRange{createIPRange(t)}
+	params := models.NewBootParams(hypervisor.MAC, hypervisor, map[string]map[string]string{
+		"boot": {
+			"kernel":  "http://boot.example.com/vmlinuz",
+			"initrd":  "http://boot.example.com/initrd",
+			"cmdline": "console=ttyS0",
+		},
+	})
+	h.Equals(t, "192.168.1.0/24", params.IPRange.CIDR)
+
+	script, err := models.RenderBootScript(models.DefaultBootTemplate, params)
+	h.Ok(t, err)
+	h.Equals(t, `#!ipxe
+kernel http://boot.example.com/vmlinuz console=ttyS0 ip=192.168.1.20::192.168.1.1:255.255.255.0:::off mistify.hypervisor=ebf3bfd5-9915-4ed1-bcb3-117bb48b155d
+initrd http://boot.example.com/initrd
+boot
+`, string(script))
+
+	// Without an iprange or config
+	params.IPRange = nil
+	params.Config = map[string]map[string]string{}
+	script, err = models.RenderBootScript(models.DefaultBootTemplate, params)
+	h.Ok(t, err)
+	h.Equals(t, `#!ipxe
+kernel   ip=192.168.1.20::::::off mistify.hypervisor=ebf3bfd5-9915-4ed1-bcb3-117bb48b155d
+initrd 
+boot
+`, string(script))
+
+	// Templates only get values, not the models
+	_, err = models.RenderBootScript("{{.Hypervisor.Delete}}", params)
+	_, ok := err.(*models.BootTemplateError)
+	h.Assert(t, ok, "expected BootTemplateError")
+	_, err = models.RenderBootScript(`{{.Hypervisor.Transition "decommissioned"}}`, params)
+	_, ok = err.(*models.BootTemplateError)
+	h.Assert(t, ok, "expected BootTemplateError")
+
+	// Unknown MAC
+	params = &models.BootParams{MAC: "01:23:45:67:89:cd"}
+	script, err = models.RenderBootScript(models.DefaultRegisterTemplate, params)
+	h.Ok(t, err)
+	h.Assert(t, len(script) > 0, "expected a register script")
+
+	// Bad templates
+	_, err = models.RenderBootScript("{{.Foo", params)
+	_, ok = err.(*models.BootTemplateError)
+	h.Assert(t, ok, "expected BootTemplateError")
+	_, err = models.RenderBootScript("{{.Hypervisor.ID}}", params)
+	_, ok = err.(*models.BootTemplateError)
+	h.Assert(t, ok, "expected BootTemplateError")
+}
+
+func TestHypervisorBootScript(t *testing.T) {
+	config.Load(configFileName)
+
+	// Prep
+	hypervisor := createHypervisor(t)
+	h.Ok(t, hypervisor.Save())
+	hypervisor.Config = models.ConfigOverrides{
+		"boot": {"template": "{{.Hypervisor.ID}} {{.MAC}} {{len .IPRanges}}"},
+	}
+	h.Ok(t, hypervisor.Save())
+
+	script, err := hypervisor.BootScript(hypervisor.MAC)
+	h.Ok(t, err)
+	h.Equals(t, hypervisor.ID+" "+hypervisor.MAC.String()+" 0", string(script))
+
+	mac, _ := net.ParseMAC("01:23:45:67:89:cd")
+	script, err = models.RegisterBootScript(mac)
+	h.Ok(t, err)
+	h.Assert(t, len(script) > 0, "expected a register script")
+
+	// Cleanup
+	h.Ok(t, hypervisor.Delete())
+}
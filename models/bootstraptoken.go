@@ -0,0 +1,498 @@
+package models
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"time"
+
+	"code.google.com/p/go-uuid/uuid"
+	"github.com/hashicorp/go-multierror"
+	"github.com/lib/pq"
+	"github.com/mistifyio/mistify-operator-admin/db"
+)
+
+type (
+	// BootstrapToken allows a freshly booted hypervisor to register itself.
+	// The secret Token is only known when the token is created; afterwards
+	// only its hash is kept.
+	BootstrapToken struct {
+		ID         string            `json:"id"`
+		Token      string            `json:"token,omitempty"`
+		SingleUse  bool              `json:"single_use"`
+		Expires    time.Time         `json:"expires"`
+		Uses       int               `json:"uses"`
+		IPRangeIDs []string          `json:"ipranges"`
+		Metadata   map[string]string `json:"metadata"`
+		Created    time.Time         `json:"created"`
+		tokenHash  string
+	}
+
+	// bootstrapTokenData is a middle-man for JSON and database (un)marshalling
+	bootstrapTokenData struct {
+		ID         string            `json:"id"`
+		Token      string            `json:"token,omitempty"`
+		SingleUse  bool              `json:"single_use"`
+		Expires    *time.Time        `json:"expires"`
+		Uses       int               `json:"uses"`
+		IPRangeIDs []string          `json:"ipranges"`
+		Metadata   map[string]string `json:"metadata"`
+		Created    time.Time         `json:"created"`
+	}
+)
+
+// id returns the id, required by the relatable interface
+func (token *BootstrapToken) id() string {
+	return token.ID
+}
+
+// pkeyName returns the database primary key name, required by the relatable
+// interface
+func (token *BootstrapToken) pkeyName() string {
+	return "bootstrap_token_id"
+}
+
+// importData unmarshals the middle-man structure into a token object
+func (token *BootstrapToken) importData(data *bootstrapTokenData) {
+	token.ID = data.ID
+	token.Token = data.Token
+	token.SingleUse = data.SingleUse
+	token.Expires = time.Time{}
+	if data.Expires != nil {
+		token.Expires = *data.Expires
+	}
+	token.Uses = data.Uses
+	token.IPRangeIDs = data.IPRangeIDs
+	token.Metadata = data.Metadata
+	token.Created = data.Created
+}
+
+// exportData marshals the token object into the middle-man structure
+func (token *BootstrapToken) exportData() *bootstrapTokenData {
+	var expires *time.Time
+	if !token.Expires.IsZero() {
+		expires = &token.Expires
+	}
+	iprangeIDs := token.IPRangeIDs
+	if iprangeIDs == nil {
+		iprangeIDs = make([]string, 0)
+	}
+	return &bootstrapTokenData{
+		ID:         token.ID,
+		Token:      token.Token,
+		SingleUse:  token.SingleUse,
+		Expires:    expires,
+		Uses:       token.Uses,
+		IPRangeIDs: iprangeIDs,
+		Metadata:   token.Metadata,
+		Created:    token.Created,
+	}
+}
+
+// UnmarshalJSON unmarshals JSON into a token object
+func (token *BootstrapToken) UnmarshalJSON(b []byte) error {
+	data := &bootstrapTokenData{}
+	if err := json.Unmarshal(b, data); err != nil {
+		return err
+	}
+	token.importData(data)
+	return nil
+}
+
+// MarshalJSON marshals a token object into JSON
+func (token BootstrapToken) MarshalJSON() ([]byte, error) {
+	return json.Marshal(token.exportData())
+}
+
+// Validate ensures the token properties are set correctly
+func (token *BootstrapToken) Validate() error {
+	var results *multierror.Error
+	if token.ID == "" {
+		results = multierror.Append(results, ErrNoID)
+	}
+	if uuid.Parse(token.ID) == nil {
+		results = multierror.Append(results, ErrBadID)
+	}
+	if token.tokenHash == "" {
+		results = multierror.Append(results, ErrNoToken)
+	}
+	if !token.SingleUse && token.Expires.IsZero() {
+		results = multierror.Append(results, ErrUnlimitedToken)
+	}
+	for _, iprangeID := range token.IPRangeIDs {
+		if uuid.Parse(iprangeID) == nil {
+			results = multierror.Append(results, ErrBadIPRangeID)
+			break
+		}
+	}
+	if token.Metadata == nil {
+		results = multierror.Append(results, ErrNilMetadata)
+	}
+	return results.ErrorOrNil()
+}
+
+// Usable checks whether the token may still be used to register a new
+// hypervisor at a point in time
+func (token *BootstrapToken) Usable(now time.Time) bool {
+	if !token.Expires.IsZero() && !now.Before(token.Expires) {
+		return false
+	}
+	return !token.SingleUse || token.Uses == 0
+}
+
+// Save persists a token, along with the ipranges to attach to hypervisors
+// registered with it, to the database in a single transaction. Uses are only
+// counted by RegisterHypervisor.
+func (token *BootstrapToken) Save() error {
+	if err := token.Validate(); err != nil {
+		return err
+	}
+	d, err := db.Connect(nil)
+	if err != nil {
+		return err
+	}
+	// Writable CTE for an Upsert
+	// See: http://stackoverflow.com/a/8702291
+	// And: http://dba.stackexchange.com/a/78535
+	sql := `
+	WITH new_values (bootstrap_token_id, token_hash, single_use, expires, metadata) as (
+		VALUES ($1::uuid, $2, $3::boolean, $4::timestamp with time zone, $5::json)
+	),
+	upsert as (
+		UPDATE bootstrap_tokens t SET
+			single_use = nv.single_use,
+			expires = nv.expires,
+			metadata = nv.metadata
+		FROM new_values nv
+		WHERE t.bootstrap_token_id = nv.bootstrap_token_id
+		RETURNING t.bootstrap_token_id
+	)
+	INSERT INTO bootstrap_tokens
+		(bootstrap_token_id, token_hash, single_use, expires, metadata)
+	SELECT bootstrap_token_id, token_hash, single_use, expires, metadata
+	FROM new_values nv
+	WHERE NOT EXISTS (SELECT 1 FROM upsert u WHERE nv.bootstrap_token_id = u.bootstrap_token_id)
+	`
+	data := token.exportData()
+	metadata, err := json.Marshal(data.Metadata)
+	if err != nil {
+		return err
+	}
+	var expires pq.NullTime
+	if data.Expires != nil {
+		expires = pq.NullTime{Time: *data.Expires, Valid: true}
+	}
+	txn, err := d.Begin()
+	if err != nil {
+		return err
+	}
+	_, err = txn.Exec(sql,
+		data.ID,
+		token.tokenHash,
+		data.SingleUse,
+		expires,
+		string(metadata),
+	)
+	if err != nil {
+		_ = txn.Rollback()
+		return err
+	}
+	relatables := make([]relatable, len(token.IPRangeIDs))
+	for i, iprangeID := range token.IPRangeIDs {
+		relatables[i] = relatable(&IPRange{ID: iprangeID})
+	}
+	if err := setRelations(txn, "bootstrap_tokens_ipranges", token, relatables); err != nil {
+		_ = txn.Rollback()
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Constraint == "bootstrap_tokens_ipranges_iprange_id_fkey" {
+			return ErrIPRangeNotFound
+		}
+		return err
+	}
+	return txn.Commit()
+}
+
+// Delete removes a token from the database, revoking it
+func (token *BootstrapToken) Delete() error {
+	d, err := db.Connect(nil)
+	if err != nil {
+		return err
+	}
+	sql := "DELETE FROM bootstrap_tokens WHERE bootstrap_token_id = $1"
+	_, err = d.Exec(sql, token.ID)
+	return err
+}
+
+// Load retrieves a token from the database
+func (token *BootstrapToken) Load() error {
+	d, err := db.Connect(nil)
+	if err != nil {
+		return err
+	}
+	sql := `
+	SELECT t.bootstrap_token_id, t.token_hash, t.single_use, t.expires, t.metadata, t.created,
+		(SELECT count(*) FROM bootstrap_token_registrations r WHERE r.bootstrap_token_id = t.bootstrap_token_id),
+		(SELECT COALESCE(json_agg(ti.iprange_id ORDER BY ti.iprange_id), '[]'::json) FROM bootstrap_tokens_ipranges ti WHERE ti.bootstrap_token_id = t.bootstrap_token_id)
+	FROM bootstrap_tokens t
+	WHERE t.bootstrap_token_id = $1
+	`
+	rows, err := d.Query(sql, token.ID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	rows.Next()
+	if err := token.fromRows(rows); err != nil {
+		return err
+	}
+	return rows.Err()
+}
+
+// fromRows unmarshals a database query result row into the token object
+func (token *BootstrapToken) fromRows(rows *sql.Rows) error {
+	var metadata, iprangeIDs string
+	var expires pq.NullTime
+	data := &bootstrapTokenData{}
+	err := rows.Scan(
+		&data.ID,
+		&token.tokenHash,
+		&data.SingleUse,
+		&expires,
+		&metadata,
+		&data.Created,
+		&data.Uses,
+		&iprangeIDs,
+	)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal([]byte(metadata), &data.Metadata); err != nil {
+		return err
+	}
+	if err := json.Unmarshal([]byte(iprangeIDs), &data.IPRangeIDs); err != nil {
+		return err
+	}
+	if expires.Valid {
+		data.Expires = &expires.Time
+	}
+	token.importData(data)
+	return nil
+}
+
+// Decode unmarshals JSON into the token object. The secret token itself can
+// not be set this way.
+func (token *BootstrapToken) Decode(data io.Reader) error {
+	if err := json.NewDecoder(data).Decode(token); err != nil {
+		return err
+	}
+	token.Token = ""
+	if token.Metadata == nil {
+		token.Metadata = make(map[string]string)
+	} else {
+		for key, value := range token.Metadata {
+			if value == "" {
+				delete(token.Metadata, key)
+			}
+		}
+	}
+	return nil
+}
+
+// NewID generates a new uuid ID
+func (token *BootstrapToken) NewID() string {
+	token.ID = uuid.New()
+	return token.ID
+}
+
+// NewSecret generates a new random secret for the token, keeping only its
+// hash for persisting
+func (token *BootstrapToken) NewSecret() (string, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+	token.Token = hex.EncodeToString(secret)
+	token.tokenHash = hashBootstrapToken(token.Token)
+	return token.Token, nil
+}
+
+// hashBootstrapToken hashes a secret token for storage and lookup
+func hashBootstrapToken(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// NewBootstrapToken creates and initializes a new token object with a new
+// secret
+func NewBootstrapToken() (*BootstrapToken, error) {
+	token := &BootstrapToken{
+		ID:         uuid.New(),
+		IPRangeIDs: make([]string, 0),
+		Metadata:   make(map[string]string),
+	}
+	if _, err := token.NewSecret(); err != nil {
+		return nil, err
+	}
+	return token, nil
+}
+
+// FetchBootstrapToken retrieves a token object from the database by ID
+func FetchBootstrapToken(id string) (*BootstrapToken, error) {
+	token := &BootstrapToken{
+		ID: id,
+	}
+	if err := token.Load(); err != nil {
+		return nil, err
+	}
+	return token, nil
+}
+
+// ListBootstrapTokens retrieves an array of all token objects from the
+// database
+func ListBootstrapTokens() ([]*BootstrapToken, error) {
+	d, err := db.Connect(nil)
+	if err != nil {
+		return nil, err
+	}
+	sql := `
+	SELECT t.bootstrap_token_id, t.token_hash, t.single_use, t.expires, t.metadata, t.created,
+		(SELECT count(*) FROM bootstrap_token_registrations r WHERE r.bootstrap_token_id = t.bootstrap_token_id),
+		(SELECT COALESCE(json_agg(ti.iprange_id ORDER BY ti.iprange_id), '[]'::json) FROM bootstrap_tokens_ipranges ti WHERE ti.bootstrap_token_id = t.bootstrap_token_id)
+	FROM bootstrap_tokens t
+	ORDER BY t.created asc
+	`
+	rows, err := d.Query(sql)
+	if err != nil {
+		return nil, err
+	}
+	tokens := make([]*BootstrapToken, 0, 1)
+	for rows.Next() {
+		token := &BootstrapToken{}
+		if err := token.fromRows(rows); err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, token)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return tokens, nil
+}
+
+// RegisterHypervisor creates a hypervisor on behalf of the machine itself,
+// using a bootstrap token in place of an operator. If the token already
+// registered a hypervisor with the MAC, it is returned as is rather than
+// created, so a machine may safely retry, even once the token has expired or
+// been used up. A hypervisor with the MAC that the token did not register is
+// never returned; ErrHypervisorExists is instead. A new hypervisor is attached
+// to the token's ipranges and counts as a use of the token; finding the
+// hypervisor a token already registered does not. Returns whether the
+// hypervisor was created.
+func RegisterHypervisor(secret string, hypervisor *Hypervisor) (bool, error) {
+	d, err := db.Connect(nil)
+	if err != nil {
+		return false, err
+	}
+	txn, err := d.Begin()
+	if err != nil {
+		return false, err
+	}
+
+	// Lock the token to serialize its uses
+	lockSQL := `
+	SELECT t.bootstrap_token_id, t.token_hash, t.single_use, t.expires, t.metadata, t.created,
+		(SELECT count(*) FROM bootstrap_token_registrations r WHERE r.bootstrap_token_id = t.bootstrap_token_id),
+		(SELECT COALESCE(json_agg(ti.iprange_id ORDER BY ti.iprange_id), '[]'::json) FROM bootstrap_tokens_ipranges ti WHERE ti.bootstrap_token_id = t.bootstrap_token_id)
+	FROM bootstrap_tokens t
+	WHERE t.token_hash = $1
+	FOR UPDATE OF t
+	`
+	rows, err := txn.Query(lockSQL, hashBootstrapToken(secret))
+	if err != nil {
+		_ = txn.Rollback()
+		return false, err
+	}
+	if !rows.Next() {
+		_ = rows.Close()
+		_ = txn.Rollback()
+		return false, ErrBadToken
+	}
+	token := &BootstrapToken{}
+	if err := token.fromRows(rows); err != nil {
+		_ = rows.Close()
+		_ = txn.Rollback()
+		return false, err
+	}
+	_ = rows.Close()
+
+	// Find an existing hypervisor and whether the token registered it
+	findSQL := `
+	SELECT hypervisor_id, mac, ip, state, cpu, memory, disk, cpu_overcommit, memory_overcommit, disk_overcommit, metadata, last_seen, agent_facts, rack_id, config
+	FROM hypervisors
+	WHERE mac = $1::macaddr
+	`
+	rows, err = txn.Query(findSQL, fmtString(hypervisor.MAC))
+	if err != nil {
+		_ = txn.Rollback()
+		return false, err
+	}
+	existing, err := hypervisorsFromRows(rows)
+	_ = rows.Close()
+	if err != nil {
+		_ = txn.Rollback()
+		return false, err
+	}
+	var registered bool
+	if len(existing) > 0 {
+		registeredSQL := `
+		SELECT EXISTS (
+			SELECT 1
+			FROM bootstrap_token_registrations
+			WHERE bootstrap_token_id = $1 AND hypervisor_id = $2
+		)
+		`
+		if err := txn.QueryRow(registeredSQL, token.ID, existing[0].ID).Scan(&registered); err != nil {
+			_ = txn.Rollback()
+			return false, err
+		}
+	}
+	if registered {
+		*hypervisor = *existing[0]
+		return false, txn.Commit()
+	}
+	if !token.Usable(time.Now()) {
+		_ = txn.Rollback()
+		return false, ErrBadToken
+	}
+	if len(existing) > 0 {
+		_ = txn.Rollback()
+		return false, ErrHypervisorExists
+	}
+
+	if err := hypervisor.save(txn); err != nil {
+		_ = txn.Rollback()
+		return false, locationNotFoundError(hypervisorConflictError(err, hypervisor))
+	}
+	relateSQL := `
+	INSERT INTO hypervisors_ipranges (hypervisor_id, iprange_id)
+	VALUES ($1, $2)
+	`
+	for _, iprangeID := range token.IPRangeIDs {
+		if _, err := txn.Exec(relateSQL, hypervisor.ID, iprangeID); err != nil {
+			_ = txn.Rollback()
+			return false, err
+		}
+	}
+
+	useSQL := `
+	INSERT INTO bootstrap_token_registrations (bootstrap_token_id, hypervisor_id)
+	VALUES ($1, $2)
+	`
+	if _, err := txn.Exec(useSQL, token.ID, hypervisor.ID); err != nil {
+		_ = txn.Rollback()
+		return false, err
+	}
+	return true, txn.Commit()
+}
@@ -0,0 +1,170 @@
+package models_test
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"code.google.com/p/go-uuid/uuid"
+
+	h "github.com/bakins/test-helpers"
+	"github.com/mistifyio/mistify-operator-admin/models"
+)
+
+func createBootstrapToken(t *testing.T) *models.BootstrapToken {
+	token, err := models.NewBootstrapToken()
+	h.Ok(t, err)
+	token.SingleUse = true
+	return token
+}
+
+func TestNewBootstrapToken(t *testing.T) {
+	token, err := models.NewBootstrapToken()
+	h.Ok(t, err)
+	h.Assert(t, uuid.Parse(token.ID) != nil, "missing uuid ID")
+	h.Equals(t, 64, len(token.Token))
+	h.Assert(t, token.Metadata != nil, "uninitialized metadata")
+
+	token2, err := models.NewBootstrapToken()
+	h.Ok(t, err)
+	h.Assert(t, token.Token != token2.Token, "New secret was not generated")
+}
+
+func TestBootstrapTokenValidate(t *testing.T) {
+	token := &models.BootstrapToken{}
+	err := token.Validate()
+	h.Assert(t, errContains(models.ErrNoID, err), "expected ErrNoID")
+	h.Assert(t, errContains(models.ErrNoToken, err), "expected ErrNoToken")
+	h.Assert(t, errContains(models.ErrUnlimitedToken, err), "expected ErrUnlimitedToken")
+	h.Assert(t, errContains(models.ErrNilMetadata, err), "expected ErrNilMetadata")
+
+	token, err = models.NewBootstrapToken()
+	h.Ok(t, err)
+	h.Assert(t, errContains(models.ErrUnlimitedToken, token.Validate()), "expected ErrUnlimitedToken")
+	token.Expires = time.Now().Add(time.Hour)
+	h.Ok(t, token.Validate())
+	token.IPRangeIDs = []string{"foobar"}
+	h.Assert(t, errContains(models.ErrBadIPRangeID, token.Validate()), "expected ErrBadIPRangeID")
+}
+
+func TestBootstrapTokenUsable(t *testing.T) {
+	token := createBootstrapToken(t)
+	now := time.Now()
+	h.Assert(t, token.Usable(now), "expected unused token to be usable")
+	token.Uses = 1
+	h.Assert(t, !token.Usable(now), "expected used single use token to be unusable")
+
+	token.SingleUse = false
+	token.Expires = now.Add(time.Minute)
+	h.Assert(t, token.Usable(now), "expected unexpired token to be usable")
+	h.Assert(t, !token.Usable(now.Add(time.Hour)), "expected expired token to be unusable")
+}
+
+func TestBootstrapTokenSaveLoad(t *testing.T) {
+	// Prep
+	iprange := createIPRange(t)
+	h.Ok(t, iprange.Save())
+	token := createBootstrapToken(t)
+	token.IPRangeIDs = []string{iprange.ID}
+	h.Ok(t, token.Save())
+
+	token2, err := models.FetchBootstrapToken(token.ID)
+	h.Ok(t, err)
+	h.Equals(t, "", token2.Token)
+	h.Equals(t, true, token2.SingleUse)
+	h.Equals(t, 0, token2.Uses)
+	h.Equals(t, []string{iprange.ID}, token2.IPRangeIDs)
+
+	tokens, err := models.ListBootstrapTokens()
+	h.Ok(t, err)
+	h.Equals(t, 1, len(tokens))
+
+	// An unknown iprange leaves no token behind
+	token3 := createBootstrapToken(t)
+	token3.IPRangeIDs = []string{uuid.New()}
+	h.Equals(t, models.ErrIPRangeNotFound, token3.Save())
+	tokens, err = models.ListBootstrapTokens()
+	h.Ok(t, err)
+	h.Equals(t, 1, len(tokens))
+
+	// Deleting the iprange drops it from the token
+	h.Ok(t, iprange.Delete())
+	token2, err = models.FetchBootstrapToken(token.ID)
+	h.Ok(t, err)
+	h.Equals(t, []string{}, token2.IPRangeIDs)
+
+	// Cleanup
+	h.Ok(t, token.Delete())
+}
+
+func TestRegisterHypervisor(t *testing.T) {
+	// Prep
+	iprange := createIPRange(t)
+	h.Ok(t, iprange.Save())
+	token := createBootstrapToken(t)
+	token.IPRangeIDs = []string{iprange.ID}
+	h.Ok(t, token.Save())
+
+	// Unknown token
+	hypervisor := createHypervisor(t)
+	_, err := models.RegisterHypervisor("foobar", hypervisor)
+	h.Equals(t, models.ErrBadToken, err)
+
+	// Create
+	created, err := models.RegisterHypervisor(token.Token, hypervisor)
+	h.Ok(t, err)
+	h.Assert(t, created, "expected hypervisor to be created")
+	h.Ok(t, hypervisor.LoadIPRanges())
+	h.Equals(t, 1, len(hypervisor.IPRanges))
+
+	// Retrying finds the same hypervisor, even though the token is used up
+	retry := createHypervisor(t)
+	retry.NewID()
+	created, err = models.RegisterHypervisor(token.Token, retry)
+	h.Ok(t, err)
+	h.Assert(t, !created, "did not expect hypervisor to be created")
+	h.Equals(t, hypervisor.ID, retry.ID)
+
+	// The used up token can not register another machine
+	other := createHypervisor(t)
+	other.NewID()
+	other.MAC, _ = net.ParseMAC("01:23:45:67:89:cd")
+	other.IP = net.ParseIP("192.168.1.21")
+	_, err = models.RegisterHypervisor(token.Token, other)
+	h.Equals(t, models.ErrBadToken, err)
+
+	token2, err := models.FetchBootstrapToken(token.ID)
+	h.Ok(t, err)
+	h.Equals(t, 1, token2.Uses)
+
+	// Retrying still finds the hypervisor once the token has expired
+	token.Expires = time.Now().Add(-time.Minute)
+	h.Ok(t, token.Save())
+	retry = createHypervisor(t)
+	retry.NewID()
+	created, err = models.RegisterHypervisor(token.Token, retry)
+	h.Ok(t, err)
+	h.Assert(t, !created, "did not expect hypervisor to be created")
+	h.Equals(t, hypervisor.ID, retry.ID)
+
+	// Another token can not claim the hypervisor by its MAC
+	token3 := createBootstrapToken(t)
+	token3.SingleUse = false
+	token3.Expires = time.Now().Add(time.Hour)
+	h.Ok(t, token3.Save())
+	impostor := createHypervisor(t)
+	impostor.NewID()
+	_, err = models.RegisterHypervisor(token3.Token, impostor)
+	h.Equals(t, models.ErrHypervisorExists, err)
+	h.Assert(t, impostor.ID != hypervisor.ID, "did not expect the existing hypervisor")
+	token3, err = models.FetchBootstrapToken(token3.ID)
+	h.Ok(t, err)
+	h.Equals(t, 0, token3.Uses)
+
+	// Cleanup
+	h.Ok(t, token3.Delete())
+	h.Ok(t, token.Delete())
+	h.Ok(t, hypervisor.SetIPRanges(make([]*models.IPRange, 0)))
+	h.Ok(t, hypervisor.Delete())
+	h.Ok(t, iprange.Delete())
+}
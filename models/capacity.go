@@ -0,0 +1,78 @@
+package models
+
+import "math"
+
+type (
+	// HypervisorFit is the number of instances of a flavor that fit on a
+	// hypervisor
+	HypervisorFit struct {
+		HypervisorID string `json:"hypervisor"`
+		FlavorID     string `json:"flavor"`
+		Count        int    `json:"count"`
+	}
+
+	// FlavorCapacity is the number of instances of a flavor that fit across
+	// all hypervisors
+	FlavorCapacity struct {
+		FlavorID    string           `json:"flavor"`
+		Count       int              `json:"count"`
+		Hypervisors []*HypervisorFit `json:"hypervisors"`
+	}
+)
+
+// Fit calculates how many instances of the flavor fit on the hypervisor, each
+// resource's capacity scaled by its overcommit ratio. The least plentiful
+// resource limits the count. A hypervisor with no capacity set fits none.
+func (hypervisor *Hypervisor) Fit(flavor *Flavor) *HypervisorFit {
+	fit := &HypervisorFit{
+		HypervisorID: hypervisor.ID,
+		FlavorID:     flavor.ID,
+	}
+	if flavor.CPU <= 0 || flavor.Memory <= 0 || flavor.Disk <= 0 {
+		return fit
+	}
+	count := math.Min(
+		math.Floor(float64(hypervisor.CPU)*overcommit(hypervisor.CPUOvercommit)/float64(flavor.CPU)),
+		math.Min(
+			math.Floor(float64(hypervisor.Memory)*overcommit(hypervisor.MemoryOvercommit)/float64(flavor.Memory)),
+			math.Floor(float64(hypervisor.Disk)*overcommit(hypervisor.DiskOvercommit)/float64(flavor.Disk)),
+		),
+	)
+	fit.Count = int(count)
+	return fit
+}
+
+// Fits calculates how many instances of each flavor fit on the hypervisor
+func (hypervisor *Hypervisor) Fits() ([]*HypervisorFit, error) {
+	flavors, err := ListFlavors()
+	if err != nil {
+		return nil, err
+	}
+	fits := make([]*HypervisorFit, len(flavors))
+	for i, flavor := range flavors {
+		fits[i] = hypervisor.Fit(flavor)
+	}
+	return fits, nil
+}
+
+// Capacity calculates how many instances of the flavor fit on each hypervisor
+// that can host guests and in total. As with placement, only active
+// hypervisors can host guests.
+func (flavor *Flavor) Capacity() (*FlavorCapacity, error) {
+	hypervisors, err := FilterHypervisors(&HypervisorFilter{
+		State: HypervisorStateActive,
+	})
+	if err != nil {
+		return nil, err
+	}
+	capacity := &FlavorCapacity{
+		FlavorID:    flavor.ID,
+		Hypervisors: make([]*HypervisorFit, len(hypervisors)),
+	}
+	for i, hypervisor := range hypervisors {
+		fit := hypervisor.Fit(flavor)
+		capacity.Hypervisors[i] = fit
+		capacity.Count += fit.Count
+	}
+	return capacity, nil
+}
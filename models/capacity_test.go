@@ -0,0 +1,62 @@
+package models_test
+
+import (
+	"testing"
+
+	h "github.com/bakins/test-helpers"
+	"github.com/mistifyio/mistify-operator-admin/models"
+)
+
+func TestHypervisorFit(t *testing.T) {
+	hypervisor := createHypervisor(t)
+	flavor := createFlavor(t)
+
+	// Limited by overcommitted cpu: 16 * 4 / 5
+	fit := hypervisor.Fit(flavor)
+	h.Equals(t, hypervisor.ID, fit.HypervisorID)
+	h.Equals(t, flavor.ID, fit.FlavorID)
+	h.Equals(t, 12, fit.Count)
+
+	// Limited by disk without overcommit
+	hypervisor.Disk = 100
+	h.Equals(t, 6, hypervisor.Fit(flavor).Count)
+
+	// No capacity set
+	hypervisor.Disk = 0
+	h.Equals(t, 0, hypervisor.Fit(flavor).Count)
+}
+
+func TestFlavorCapacity(t *testing.T) {
+	// Prep
+	hypervisor := createHypervisor(t)
+	h.Ok(t, hypervisor.Save())
+	flavor := createFlavor(t)
+	h.Ok(t, flavor.Save())
+
+	// Only active hypervisors can host guests
+	capacity, err := flavor.Capacity()
+	h.Ok(t, err)
+	h.Equals(t, flavor.ID, capacity.FlavorID)
+	h.Equals(t, 0, len(capacity.Hypervisors))
+	h.Equals(t, 0, capacity.Count)
+
+	h.Ok(t, hypervisor.Transition(models.HypervisorStateActive))
+	capacity, err = flavor.Capacity()
+	h.Ok(t, err)
+	h.Equals(t, 1, len(capacity.Hypervisors))
+	h.Equals(t, 12, capacity.Count)
+
+	h.Ok(t, hypervisor.Transition(models.HypervisorStateMaintenance))
+	capacity, err = flavor.Capacity()
+	h.Ok(t, err)
+	h.Equals(t, 0, capacity.Count)
+
+	fits, err := hypervisor.Fits()
+	h.Ok(t, err)
+	h.Equals(t, 1, len(fits))
+	h.Equals(t, 12, fits[0].Count)
+
+	// Cleanup
+	h.Ok(t, flavor.Delete())
+	h.Ok(t, hypervisor.Delete())
+}
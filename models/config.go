@@ -20,11 +20,17 @@ type (
 	}
 )
 
-// Validate checks that the properties of Config are valid
+// Validate checks that the properties of Config are valid, including the set
+// values of core keys that are parsed when used
 func (config *Config) Validate() error {
 	if config.data == nil {
 		return ErrNilData
 	}
+	if value, ok := config.data[HeartbeatConfigNamespace][HeartbeatStaleAfterKey]; ok {
+		if _, err := parseStaleAfter(value); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
@@ -22,6 +22,13 @@ func TestConfigValidate(t *testing.T) {
 
 	c = models.NewConfig()
 	h.Ok(t, c.Validate())
+
+	c.SetValue(models.HeartbeatConfigNamespace, models.HeartbeatStaleAfterKey, "foobar")
+	h.Equals(t, models.ErrBadStaleAfter, c.Validate())
+	c.SetValue(models.HeartbeatConfigNamespace, models.HeartbeatStaleAfterKey, "-5m")
+	h.Equals(t, models.ErrBadStaleAfter, c.Validate())
+	c.SetValue(models.HeartbeatConfigNamespace, models.HeartbeatStaleAfterKey, "90s")
+	h.Ok(t, c.Validate())
 }
 
 func TestConfigGet(t *testing.T) {
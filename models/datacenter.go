@@ -0,0 +1,217 @@
+package models
+
+import (
+	"database/sql"
+	"encoding/json"
+	"io"
+
+	"code.google.com/p/go-uuid/uuid"
+	"github.com/hashicorp/go-multierror"
+	"github.com/mistifyio/mistify-operator-admin/db"
+)
+
+// Datacenter describes a physical site, the top of the datacenter, zone, and
+// rack location hierarchy
+type Datacenter struct {
+	ID       string            `json:"id"`
+	Name     string            `json:"name"`
+	Metadata map[string]string `json:"metadata"`
+	Config   ConfigOverrides   `json:"config"`
+}
+
+// Validate ensures the datacenter properties are set correctly
+func (datacenter *Datacenter) Validate() error {
+	var results *multierror.Error
+	if datacenter.ID == "" {
+		results = multierror.Append(results, ErrNoID)
+	}
+	if uuid.Parse(datacenter.ID) == nil {
+		results = multierror.Append(results, ErrBadID)
+	}
+	if datacenter.Name == "" {
+		results = multierror.Append(results, ErrNoName)
+	}
+	if datacenter.Metadata == nil {
+		results = multierror.Append(results, ErrNilMetadata)
+	}
+	return results.ErrorOrNil()
+}
+
+// Save persists a datacenter to the database
+func (datacenter *Datacenter) Save() error {
+	if err := datacenter.Validate(); err != nil {
+		return err
+	}
+	d, err := db.Connect(nil)
+	if err != nil {
+		return err
+	}
+	// Writable CTE for an Upsert
+	// See: http://stackoverflow.com/a/8702291
+	// And: http://dba.stackexchange.com/a/78535
+	sql := `
+	WITH new_values (datacenter_id, name, metadata, config) as (
+		VALUES ($1::uuid, $2, $3::json, $4::json)
+	),
+	upsert as (
+		UPDATE datacenters dc SET
+			name = nv.name,
+			metadata = nv.metadata,
+			config = nv.config
+		FROM new_values nv
+		WHERE dc.datacenter_id = nv.datacenter_id
+		RETURNING nv.datacenter_id
+	)
+	INSERT INTO datacenters
+		(datacenter_id, name, metadata, config)
+	SELECT datacenter_id, name, metadata, config
+	FROM new_values nv
+	WHERE NOT EXISTS (SELECT 1 FROM upsert u WHERE nv.datacenter_id = u.datacenter_id)
+	`
+	metadata, err := json.Marshal(datacenter.Metadata)
+	if err != nil {
+		return err
+	}
+	config, err := json.Marshal(datacenter.Config)
+	if err != nil {
+		return err
+	}
+	_, err = d.Exec(sql,
+		datacenter.ID,
+		datacenter.Name,
+		string(metadata),
+		string(config),
+	)
+	return err
+}
+
+// Delete removes a datacenter from the database. A datacenter that still has
+// zones can not be deleted.
+func (datacenter *Datacenter) Delete() error {
+	d, err := db.Connect(nil)
+	if err != nil {
+		return err
+	}
+	sql := "DELETE FROM datacenters WHERE datacenter_id = $1"
+	_, err = d.Exec(sql, datacenter.ID)
+	return locationInUseError(err)
+}
+
+// Load retrieves a datacenter from the database
+func (datacenter *Datacenter) Load() error {
+	d, err := db.Connect(nil)
+	if err != nil {
+		return err
+	}
+	sql := `
+	SELECT datacenter_id, name, metadata, config
+	FROM datacenters
+	WHERE datacenter_id = $1
+	`
+	rows, err := d.Query(sql, datacenter.ID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	rows.Next()
+	if err := datacenter.fromRows(rows); err != nil {
+		return err
+	}
+	return rows.Err()
+}
+
+// fromRows unmarshals a database query result row into the datacenter object
+func (datacenter *Datacenter) fromRows(rows *sql.Rows) error {
+	var metadata, config string
+	err := rows.Scan(
+		&datacenter.ID,
+		&datacenter.Name,
+		&metadata,
+		&config,
+	)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal([]byte(metadata), &datacenter.Metadata); err != nil {
+		return err
+	}
+	return json.Unmarshal([]byte(config), &datacenter.Config)
+}
+
+// Decode unmarshals JSON into the datacenter object
+func (datacenter *Datacenter) Decode(data io.Reader) error {
+	if err := json.NewDecoder(data).Decode(datacenter); err != nil {
+		return err
+	}
+	if datacenter.Config == nil {
+		datacenter.Config = make(ConfigOverrides)
+	}
+	datacenter.Config.clean()
+	if datacenter.Metadata == nil {
+		datacenter.Metadata = make(map[string]string)
+	} else {
+		for key, value := range datacenter.Metadata {
+			if value == "" {
+				delete(datacenter.Metadata, key)
+			}
+		}
+	}
+	return nil
+}
+
+// NewID generates a new uuid ID
+func (datacenter *Datacenter) NewID() string {
+	datacenter.ID = uuid.New()
+	return datacenter.ID
+}
+
+// NewDatacenter creates and initializes a new datacenter object
+func NewDatacenter() *Datacenter {
+	datacenter := &Datacenter{
+		ID:       uuid.New(),
+		Metadata: make(map[string]string),
+		Config:   make(ConfigOverrides),
+	}
+	return datacenter
+}
+
+// FetchDatacenter retrieves a datacenter object from the database by ID
+func FetchDatacenter(id string) (*Datacenter, error) {
+	datacenter := &Datacenter{
+		ID: id,
+	}
+	if err := datacenter.Load(); err != nil {
+		return nil, err
+	}
+	return datacenter, nil
+}
+
+// ListDatacenters retrieves an array of all datacenter objects from the
+// database
+func ListDatacenters() ([]*Datacenter, error) {
+	d, err := db.Connect(nil)
+	if err != nil {
+		return nil, err
+	}
+	sql := `
+	SELECT datacenter_id, name, metadata, config
+	FROM datacenters
+	ORDER BY datacenter_id
+	`
+	rows, err := d.Query(sql)
+	if err != nil {
+		return nil, err
+	}
+	datacenters := make([]*Datacenter, 0, 1)
+	for rows.Next() {
+		datacenter := &Datacenter{}
+		if err := datacenter.fromRows(rows); err != nil {
+			return nil, err
+		}
+		datacenters = append(datacenters, datacenter)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return datacenters, nil
+}
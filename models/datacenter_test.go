@@ -0,0 +1,57 @@
+package models_test
+
+import (
+	"strings"
+	"testing"
+
+	"code.google.com/p/go-uuid/uuid"
+
+	h "github.com/bakins/test-helpers"
+	"github.com/mistifyio/mistify-operator-admin/models"
+)
+
+var datacenterJSON = `{
+	"id": "5ed4c8a4-6b1e-4a4c-9d2e-1f3a6b7c8d90",
+	"name": "foobar",
+	"metadata": {
+		"foo": "bar"
+	}
+}`
+
+func createDatacenter(t *testing.T) *models.Datacenter {
+	r := strings.NewReader(datacenterJSON)
+	datacenter := &models.Datacenter{}
+	h.Ok(t, datacenter.Decode(r))
+	return datacenter
+}
+
+func TestNewDatacenter(t *testing.T) {
+	datacenter := models.NewDatacenter()
+	h.Assert(t, uuid.Parse(datacenter.ID) != nil, "missing uuid ID")
+	h.Assert(t, datacenter.Metadata != nil, "uninitialized metadata")
+}
+
+func TestDatacenterValidate(t *testing.T) {
+	datacenter := &models.Datacenter{}
+	err := datacenter.Validate()
+	h.Assert(t, errContains(models.ErrNoID, err), "expected ErrNoID")
+	h.Assert(t, errContains(models.ErrBadID, err), "expected ErrBadID")
+	h.Assert(t, errContains(models.ErrNoName, err), "expected ErrNoName")
+	h.Assert(t, errContains(models.ErrNilMetadata, err), "expected ErrNilMetadata")
+
+	h.Ok(t, createDatacenter(t).Validate())
+}
+
+func TestDatacenterLoad(t *testing.T) {
+	datacenter := createDatacenter(t)
+	h.Ok(t, datacenter.Save())
+
+	datacenter2, err := models.FetchDatacenter(datacenter.ID)
+	h.Ok(t, err)
+	h.Equals(t, datacenter, datacenter2)
+
+	datacenters, err := models.ListDatacenters()
+	h.Ok(t, err)
+	h.Equals(t, 1, len(datacenters))
+	h.Ok(t, datacenter.Delete())
+}
@@ -0,0 +1,265 @@
+package models
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/mistifyio/mistify-operator-admin/db"
+)
+
+const (
+	// DHCPFormatDnsmasq is for rendering dnsmasq configuration
+	DHCPFormatDnsmasq = "dnsmasq"
+	// DHCPFormatISC is for rendering ISC dhcpd configuration
+	DHCPFormatISC = "isc"
+)
+
+// dhcpSubnet describes an iprange as served by a DHCP server, with the
+// settings inherited from its network resolved
+type dhcpSubnet struct {
+	iprange      *IPRange
+	pools        ipIntervals
+	leases       []*IPAllocation
+	dnsServers   []net.IP
+	searchDomain string
+	mtu          int
+	routes       []*Route
+}
+
+// DHCPConfig renders the configuration for a DHCP server on the hypervisor to
+// serve guests from the hypervisor's ipranges. A family of 4 or 6 only
+// includes the ipranges of that IP version, while 0 includes all of them.
+func (hypervisor *Hypervisor) DHCPConfig(format string, family int) ([]byte, error) {
+	var writeSubnet func(*bytes.Buffer, *dhcpSubnet)
+	switch format {
+	case DHCPFormatDnsmasq:
+		writeSubnet = writeDnsmasqSubnet
+	case DHCPFormatISC:
+		writeSubnet = writeISCSubnet
+	default:
+		return nil, ErrBadDHCPFormat
+	}
+	if family != 0 && family != 4 && family != 6 {
+		return nil, ErrBadIPFamily
+	}
+	if err := hypervisor.LoadIPRanges(); err != nil {
+		return nil, err
+	}
+	subnets := make([]*dhcpSubnet, 0, len(hypervisor.IPRanges))
+	classless := false
+	for _, iprange := range hypervisor.IPRanges {
+		if (family == 4 && iprange.IPv6()) || (family == 6 && !iprange.IPv6()) {
+			continue
+		}
+		subnet, err := newDHCPSubnet(iprange)
+		if err != nil {
+			return nil, err
+		}
+		subnets = append(subnets, subnet)
+		classless = classless || (!iprange.IPv6() && len(subnet.routes) > 0)
+	}
+
+	buf := &bytes.Buffer{}
+	fmt.Fprintf(buf, "# DHCP configuration for hypervisor %s\n", hypervisor.ID)
+	if format == DHCPFormatISC && classless {
+		fmt.Fprint(buf, "option rfc3442-classless-static-routes code 121 = array of integer 8;\n")
+	}
+	for _, subnet := range subnets {
+		fmt.Fprintf(buf, "\n# iprange %s\n", subnet.iprange.ID)
+		writeSubnet(buf, subnet)
+	}
+	return buf.Bytes(), nil
+}
+
+// newDHCPSubnet gathers the pools, fixed leases, and settings of an iprange.
+// The pools are the free spans of the iprange's pool, leaving out allocated
+// and reserved addresses, and are only served dynamically in the DHCP and
+// DHCPv6 modes. Guests in SLAAC mode derive their own addresses, so have no
+// fixed leases. Settings not set on the iprange are taken from its network,
+// leaving out DNS servers and routes of the other IP version.
+func newDHCPSubnet(iprange *IPRange) (*dhcpSubnet, error) {
+	d, err := db.Connect(nil)
+	if err != nil {
+		return nil, err
+	}
+	blocked, err := blockedIntervals(d, iprange.ID, fmtString(iprange.Start), fmtString(iprange.End))
+	if err != nil {
+		return nil, err
+	}
+	if err := iprange.LoadAllocations(); err != nil {
+		return nil, err
+	}
+	if err := iprange.LoadNetwork(); err != nil {
+		return nil, err
+	}
+
+	subnet := &dhcpSubnet{
+		iprange: iprange,
+		leases:  make([]*IPAllocation, 0, len(iprange.Allocations)),
+	}
+	switch iprange.mode() {
+	case IPRangeModeDHCP, IPRangeModeDHCPv6:
+		subnet.pools = freeIntervals(iprange.Start, iprange.End, blocked)
+	}
+	for _, allocation := range iprange.Allocations {
+		if allocation.MAC != nil && iprange.mode() != IPRangeModeSLAAC {
+			subnet.leases = append(subnet.leases, allocation)
+		}
+	}
+	// Only DNS servers and routes of the iprange's IP version can be served
+	family := iprange.CIDR.IP
+	if network := iprange.Network; network != nil {
+		subnet.dnsServers = dnsServersOfFamily(network.DNSServers, family)
+		subnet.searchDomain = network.SearchDomain
+		subnet.mtu = network.MTU
+		subnet.routes = routesOfFamily(network.Routes, family)
+	}
+	if dnsServers := dnsServersOfFamily(iprange.DNSServers, family); len(dnsServers) > 0 {
+		subnet.dnsServers = dnsServers
+	}
+	if iprange.SearchDomain != "" {
+		subnet.searchDomain = iprange.SearchDomain
+	}
+	if iprange.MTU != 0 {
+		subnet.mtu = iprange.MTU
+	}
+	if routes := routesOfFamily(iprange.Routes, family); len(routes) > 0 {
+		subnet.routes = routes
+	}
+	return subnet, nil
+}
+
+// writeDnsmasqSubnet renders a subnet as dnsmasq configuration, tagged with
+// the iprange id
+func writeDnsmasqSubnet(buf *bytes.Buffer, subnet *dhcpSubnet) {
+	tag := subnet.iprange.ID
+	cidr := subnet.iprange.CIDR
+	ones, _ := cidr.Mask.Size()
+	if subnet.iprange.IPv6() {
+		switch subnet.iprange.mode() {
+		case IPRangeModeSLAAC:
+			fmt.Fprintf(buf, "dhcp-range=set:%s,%s,ra-stateless,%d\n", tag, cidr.IP, ones)
+		case IPRangeModeStatic:
+			fmt.Fprintf(buf, "dhcp-range=set:%s,%s,static,%d\n", tag, cidr.IP, ones)
+		}
+		for _, pool := range subnet.pools {
+			fmt.Fprintf(buf, "dhcp-range=set:%s,%s,%s,%d\n", tag, pool.start, pool.end, ones)
+		}
+		if len(subnet.dnsServers) > 0 {
+			servers := make([]string, len(subnet.dnsServers))
+			for i, ip := range subnet.dnsServers {
+				servers[i] = "[" + ip.String() + "]"
+			}
+			fmt.Fprintf(buf, "dhcp-option=tag:%s,option6:dns-server,%s\n", tag, strings.Join(servers, ","))
+		}
+		if subnet.searchDomain != "" {
+			fmt.Fprintf(buf, "dhcp-option=tag:%s,option6:domain-search,%s\n", tag, subnet.searchDomain)
+		}
+		for _, lease := range subnet.leases {
+			fmt.Fprintf(buf, "dhcp-host=%s,[%s]\n", lease.MAC, lease.IP)
+		}
+		return
+	}
+
+	netmask := net.IP(cidr.Mask).String()
+	if subnet.iprange.mode() == IPRangeModeStatic {
+		fmt.Fprintf(buf, "dhcp-range=set:%s,%s,static,%s\n", tag, cidr.IP, netmask)
+	}
+	for _, pool := range subnet.pools {
+		fmt.Fprintf(buf, "dhcp-range=set:%s,%s,%s,%s\n", tag, pool.start, pool.end, netmask)
+	}
+	fmt.Fprintf(buf, "dhcp-option=tag:%s,option:router,%s\n", tag, subnet.iprange.Gateway)
+	if len(subnet.dnsServers) > 0 {
+		fmt.Fprintf(buf, "dhcp-option=tag:%s,option:dns-server,%s\n", tag, strings.Join(fmtIPs(subnet.dnsServers), ","))
+	}
+	if subnet.searchDomain != "" {
+		fmt.Fprintf(buf, "dhcp-option=tag:%s,option:domain-search,%s\n", tag, subnet.searchDomain)
+	}
+	if subnet.mtu != 0 {
+		fmt.Fprintf(buf, "dhcp-option=tag:%s,option:mtu,%d\n", tag, subnet.mtu)
+	}
+	if len(subnet.routes) > 0 {
+		// Clients ignore the router option when given classless routes
+		routes := make([]string, 0, len(subnet.routes)+1)
+		for _, route := range subnet.routes {
+			routes = append(routes, route.Destination.String()+","+route.Gateway.String())
+		}
+		routes = append(routes, "0.0.0.0/0,"+subnet.iprange.Gateway.String())
+		fmt.Fprintf(buf, "dhcp-option=tag:%s,option:classless-static-route,%s\n", tag, strings.Join(routes, ","))
+	}
+	for _, lease := range subnet.leases {
+		fmt.Fprintf(buf, "dhcp-host=%s,%s\n", lease.MAC, lease.IP)
+	}
+}
+
+// writeISCSubnet renders a subnet as ISC dhcpd configuration
+func writeISCSubnet(buf *bytes.Buffer, subnet *dhcpSubnet) {
+	cidr := subnet.iprange.CIDR
+	if subnet.iprange.IPv6() {
+		fmt.Fprintf(buf, "subnet6 %s {\n", cidr)
+		for _, pool := range subnet.pools {
+			fmt.Fprintf(buf, "\trange6 %s %s;\n", pool.start, pool.end)
+		}
+		if len(subnet.dnsServers) > 0 {
+			fmt.Fprintf(buf, "\toption dhcp6.name-servers %s;\n", strings.Join(fmtIPs(subnet.dnsServers), ", "))
+		}
+		if subnet.searchDomain != "" {
+			fmt.Fprintf(buf, "\toption dhcp6.domain-search \"%s\";\n", subnet.searchDomain)
+		}
+		for _, lease := range subnet.leases {
+			fmt.Fprintf(buf, "\thost %s {\n\t\thardware ethernet %s;\n\t\tfixed-address6 %s;\n\t}\n", iscHostName(lease.IP), lease.MAC, lease.IP)
+		}
+		fmt.Fprint(buf, "}\n")
+		return
+	}
+
+	fmt.Fprintf(buf, "subnet %s netmask %s {\n", cidr.IP, net.IP(cidr.Mask))
+	for _, pool := range subnet.pools {
+		fmt.Fprintf(buf, "\trange %s %s;\n", pool.start, pool.end)
+	}
+	fmt.Fprintf(buf, "\toption routers %s;\n", subnet.iprange.Gateway)
+	if len(subnet.dnsServers) > 0 {
+		fmt.Fprintf(buf, "\toption domain-name-servers %s;\n", strings.Join(fmtIPs(subnet.dnsServers), ", "))
+	}
+	if subnet.searchDomain != "" {
+		fmt.Fprintf(buf, "\toption domain-search \"%s\";\n", subnet.searchDomain)
+	}
+	if subnet.mtu != 0 {
+		fmt.Fprintf(buf, "\toption interface-mtu %d;\n", subnet.mtu)
+	}
+	if len(subnet.routes) > 0 {
+		// Clients ignore the router option when given classless routes
+		routes := make([]string, 0, len(subnet.routes)+1)
+		for _, route := range subnet.routes {
+			routes = append(routes, classlessRoute(route.Destination, route.Gateway))
+		}
+		_, defaultRoute, _ := net.ParseCIDR("0.0.0.0/0")
+		routes = append(routes, classlessRoute(defaultRoute, subnet.iprange.Gateway))
+		fmt.Fprintf(buf, "\toption rfc3442-classless-static-routes %s;\n", strings.Join(routes, ", "))
+	}
+	for _, lease := range subnet.leases {
+		fmt.Fprintf(buf, "\thost %s {\n\t\thardware ethernet %s;\n\t\tfixed-address %s;\n\t}\n", iscHostName(lease.IP), lease.MAC, lease.IP)
+	}
+	fmt.Fprint(buf, "}\n")
+}
+
+// classlessRoute encodes an IPv4 route as RFC 3442 octets: the prefix length,
+// the significant octets of the destination, then the gateway
+func classlessRoute(destination *net.IPNet, gateway net.IP) string {
+	ones, _ := destination.Mask.Size()
+	octets := []string{fmt.Sprint(ones)}
+	for _, b := range ipNormalize(destination.IP)[:(ones+7)/8] {
+		octets = append(octets, fmt.Sprint(b))
+	}
+	for _, b := range ipNormalize(gateway) {
+		octets = append(octets, fmt.Sprint(b))
+	}
+	return strings.Join(octets, ", ")
+}
+
+// iscHostName generates a unique host declaration name for a fixed lease
+func iscHostName(ip net.IP) string {
+	return "lease-" + strings.NewReplacer(".", "-", ":", "-").Replace(ip.String())
+}
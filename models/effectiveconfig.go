@@ -0,0 +1,123 @@
+package models
+
+import (
+	"encoding/json"
+
+	conf "github.com/mistifyio/mistify-operator-admin/config"
+)
+
+// Config sources, from lowest to highest precedence
+const (
+	ConfigSourceDefault    = "default"
+	ConfigSourceGlobal     = "global"
+	ConfigSourceDatacenter = "datacenter"
+	ConfigSourceZone       = "zone"
+	ConfigSourceRack       = "rack"
+	ConfigSourceHypervisor = "hypervisor"
+)
+
+type (
+	// ConfigOverrides are namespaced config key/value pairs set on a location
+	// or hypervisor that take precedence over the global config
+	ConfigOverrides map[string]map[string]string
+
+	// ConfigValue is an effective config value along with where it came from.
+	// SourceID is the id of the location or hypervisor the value was set on.
+	ConfigValue struct {
+		Value    string `json:"value"`
+		Source   string `json:"source"`
+		SourceID string `json:"source_id,omitempty"`
+	}
+
+	// EffectiveConfig is the namespaced config that applies to a hypervisor
+	EffectiveConfig map[string]map[string]*ConfigValue
+)
+
+// MarshalJSON marshals config overrides into JSON, writing no overrides as an
+// empty object rather than null
+func (overrides ConfigOverrides) MarshalJSON() ([]byte, error) {
+	if overrides == nil {
+		return []byte("{}"), nil
+	}
+	return json.Marshal(map[string]map[string]string(overrides))
+}
+
+// clean removes empty values and namespaces, so that setting a value to ""
+// removes the override
+func (overrides ConfigOverrides) clean() {
+	for namespace, values := range overrides {
+		for key, value := range values {
+			if value == "" {
+				delete(values, key)
+			}
+		}
+		if len(values) == 0 {
+			delete(overrides, namespace)
+		}
+	}
+}
+
+// overlay sets the values of a layer of config in the effective config
+func (effective EffectiveConfig) overlay(layer map[string]map[string]string, source, sourceID string) {
+	for namespace, values := range layer {
+		ns, ok := effective[namespace]
+		if !ok {
+			ns = make(map[string]*ConfigValue)
+			effective[namespace] = ns
+		}
+		for key, value := range values {
+			ns[key] = &ConfigValue{
+				Value:    value,
+				Source:   source,
+				SourceID: sourceID,
+			}
+		}
+	}
+}
+
+// Values returns the effective config values without where they came from
+func (effective EffectiveConfig) Values() map[string]map[string]string {
+	values := make(map[string]map[string]string)
+	for namespace, ns := range effective {
+		values[namespace] = make(map[string]string)
+		for key, value := range ns {
+			values[namespace][key] = value.Value
+		}
+	}
+	return values
+}
+
+// EffectiveConfig merges the config that applies to the hypervisor. Defaults
+// are overlaid by the global config, then by the overrides of the hypervisor's
+// datacenter, zone, and rack, and finally by the hypervisor's own overrides.
+func (hypervisor *Hypervisor) EffectiveConfig() (EffectiveConfig, error) {
+	effective := make(EffectiveConfig)
+	effective.overlay(conf.Get().Mistify, ConfigSourceDefault, "")
+
+	global := NewConfig()
+	if err := global.Load(); err != nil {
+		return nil, err
+	}
+	effective.overlay(global.data, ConfigSourceGlobal, "")
+
+	if hypervisor.RackID != "" {
+		rack, err := FetchRack(hypervisor.RackID)
+		if err != nil {
+			return nil, err
+		}
+		zone, err := FetchZone(rack.ZoneID)
+		if err != nil {
+			return nil, err
+		}
+		datacenter, err := FetchDatacenter(zone.DatacenterID)
+		if err != nil {
+			return nil, err
+		}
+		effective.overlay(datacenter.Config, ConfigSourceDatacenter, datacenter.ID)
+		effective.overlay(zone.Config, ConfigSourceZone, zone.ID)
+		effective.overlay(rack.Config, ConfigSourceRack, rack.ID)
+	}
+
+	effective.overlay(hypervisor.Config, ConfigSourceHypervisor, hypervisor.ID)
+	return effective, nil
+}
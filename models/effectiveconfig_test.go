@@ -0,0 +1,62 @@
+package models_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	h "github.com/bakins/test-helpers"
+	"github.com/mistifyio/mistify-operator-admin/config"
+	"github.com/mistifyio/mistify-operator-admin/models"
+)
+
+func TestConfigOverridesMarshalJSON(t *testing.T) {
+	var overrides models.ConfigOverrides
+	b, err := json.Marshal(overrides)
+	h.Ok(t, err)
+	h.Equals(t, "{}", string(b))
+}
+
+func TestHypervisorEffectiveConfig(t *testing.T) {
+	config.Load(configFileName)
+
+	// Prep
+	c := models.NewConfig()
+	c.SetValue("foobar", "global", "global")
+	c.SetValue("foobar", "rack", "global")
+	h.Ok(t, c.Save())
+	datacenter := createDatacenter(t)
+	datacenter.Config = models.ConfigOverrides{"foobar": {"rack": "datacenter"}}
+	h.Ok(t, datacenter.Save())
+	zone := createZone(t)
+	h.Ok(t, zone.Save())
+	rack := createRack(t)
+	rack.Config = models.ConfigOverrides{"foobar": {"rack": "rack"}}
+	h.Ok(t, rack.Save())
+	hypervisor := createHypervisor(t)
+	hypervisor.RackID = rack.ID
+	hypervisor.Config = models.ConfigOverrides{"agent": {"debug": "true"}}
+	h.Ok(t, hypervisor.Save())
+	h.Ok(t, hypervisor.Load())
+
+	effective, err := hypervisor.EffectiveConfig()
+	h.Ok(t, err)
+	h.Equals(t, &models.ConfigValue{Value: "default", Source: models.ConfigSourceDefault}, effective["foobar"]["baz"])
+	h.Equals(t, &models.ConfigValue{Value: "global", Source: models.ConfigSourceGlobal}, effective["foobar"]["global"])
+	h.Equals(t, &models.ConfigValue{Value: "rack", Source: models.ConfigSourceRack, SourceID: rack.ID}, effective["foobar"]["rack"])
+	h.Equals(t, &models.ConfigValue{Value: "true", Source: models.ConfigSourceHypervisor, SourceID: hypervisor.ID}, effective["agent"]["debug"])
+	h.Equals(t, "rack", effective.Values()["foobar"]["rack"])
+
+	// Without a rack, location overrides no longer apply
+	hypervisor.RackID = ""
+	effective, err = hypervisor.EffectiveConfig()
+	h.Ok(t, err)
+	h.Equals(t, &models.ConfigValue{Value: "global", Source: models.ConfigSourceGlobal}, effective["foobar"]["rack"])
+
+	// Cleanup
+	h.Ok(t, hypervisor.Delete())
+	h.Ok(t, rack.Delete())
+	h.Ok(t, zone.Delete())
+	h.Ok(t, datacenter.Delete())
+	c.DeleteNamespace("foobar")
+	h.Ok(t, c.Save())
+}
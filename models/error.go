@@ -1,6 +1,12 @@
 package models
 
-import "errors"
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/lib/pq"
+)
 
 // ErrNoID is for a missing id
 var ErrNoID = errors.New("missing id")
@@ -20,6 +26,9 @@ var ErrNoMAC = errors.New("missing MAC")
 // ErrNoIP is for a missing IP in the hypervisor
 var ErrNoIP = errors.New("missing IP")
 
+// ErrBadMAC is for a MAC that could not be parsed
+var ErrBadMAC = errors.New("invalid MAC")
+
 // ErrNoService is for calling an unconfigured service
 var ErrNoService = errors.New("missing service")
 
@@ -55,3 +64,384 @@ var ErrBadDisk = errors.New("disk must be > 0")
 
 // ErrNilData is for nil data map in the config
 var ErrNilData = errors.New("data must not be nil")
+
+// ErrBadIP is for an address that could not be parsed
+var ErrBadIP = errors.New("invalid IP")
+
+// ErrIPNotInPool is for an address outside of the iprange start and end
+var ErrIPNotInPool = errors.New("IP is not within the iprange pool")
+
+// ErrIPAllocated is for an address that has already been allocated
+var ErrIPAllocated = errors.New("IP is already allocated")
+
+// ErrIPNotAllocated is for releasing an address that is not allocated
+var ErrIPNotAllocated = errors.New("IP is not allocated")
+
+// ErrIPRangeExhausted is for an iprange with no free addresses left
+var ErrIPRangeExhausted = errors.New("no free addresses in iprange")
+
+// ErrIPReserved is for an address that is reserved and cannot be allocated
+var ErrIPReserved = errors.New("IP is reserved")
+
+// ErrBadHypervisorID is for an invalid hypervisor id (e.g. non-uuid)
+var ErrBadHypervisorID = errors.New("invalid hypervisor id")
+
+// ErrBadIPRangeID is for an invalid iprange id (e.g. non-uuid)
+var ErrBadIPRangeID = errors.New("invalid iprange id")
+
+// ErrHypervisorNotFound is for an allocation on behalf of a hypervisor that
+// does not exist
+var ErrHypervisorNotFound = errors.New("hypervisor not found")
+
+// ErrHypervisorNotInIPRange is for an allocation on behalf of a hypervisor that
+// is not related to the iprange
+var ErrHypervisorNotInIPRange = errors.New("hypervisor is not associated with the iprange")
+
+// ErrExclusionNotInPool is for an exclusion outside of the iprange start and
+// end
+var ErrExclusionNotInPool = errors.New("exclusion is not within the iprange pool")
+
+// ErrExclusionOverlap is for an exclusion overlapping another in the iprange
+var ErrExclusionOverlap = errors.New("exclusion overlaps another exclusion")
+
+// ErrExclusionOutsidePool is for changing an iprange's pool so that it no
+// longer contains one of the iprange's exclusions
+var ErrExclusionOutsidePool = errors.New("iprange pool must contain its exclusions")
+
+// ErrMixedIPFamilies is for an iprange mixing IPv4 and IPv6 addresses
+var ErrMixedIPFamilies = errors.New("cidr, gateway, start IP, and end IP must all be the same IP version")
+
+// ErrGatewayNotInCIDR is for an iprange gateway outside of the cidr
+var ErrGatewayNotInCIDR = errors.New("gateway must be within cidr")
+
+// ErrStartIPNotInCIDR is for an iprange starting ip outside of the cidr
+var ErrStartIPNotInCIDR = errors.New("start IP must be within cidr")
+
+// ErrEndIPNotInCIDR is for an iprange ending ip outside of the cidr
+var ErrEndIPNotInCIDR = errors.New("end IP must be within cidr")
+
+// ErrStartIPAfterEndIP is for an iprange with a start ip after the end ip
+var ErrStartIPAfterEndIP = errors.New("start IP must not be after end IP")
+
+// ErrGatewayInPool is for an iprange gateway between the start and end ips
+var ErrGatewayInPool = errors.New("gateway must not be between start IP and end IP")
+
+// ErrPoolHasNetworkIP is for an iprange pool including the network address
+var ErrPoolHasNetworkIP = errors.New("start IP must be after the network address")
+
+// ErrPoolHasBroadcastIP is for an iprange pool including the broadcast address
+var ErrPoolHasBroadcastIP = errors.New("end IP must be before the broadcast address")
+
+// ErrBadDNSServer is for a DNS server address that could not be parsed
+var ErrBadDNSServer = errors.New("invalid DNS server")
+
+// ErrBadSearchDomain is for a search domain that is not a valid domain name
+var ErrBadSearchDomain = errors.New("invalid search domain")
+
+// ErrBadVLAN is for a VLAN ID outside of 1-4094
+var ErrBadVLAN = errors.New("vlan must be between 1 and 4094")
+
+// ErrVLANInUse is for a VLAN ID already used by another network
+var ErrVLANInUse = errors.New("vlan is already used by another network")
+
+// ErrBadMTU is for an MTU outside of 68-65535
+var ErrBadMTU = errors.New("mtu must be between 68 and 65535")
+
+// ErrBadRoute is for a static route missing a destination or gateway, or
+// mixing IPv4 and IPv6 addresses
+var ErrBadRoute = errors.New("invalid route")
+
+// ErrDNSServerFamily is for an iprange DNS server of a different IP version
+// than the iprange
+var ErrDNSServerFamily = errors.New("dns servers must be the same IP version as the cidr")
+
+// ErrRouteFamily is for an iprange route of a different IP version than the
+// iprange
+var ErrRouteFamily = errors.New("routes must be the same IP version as the cidr")
+
+// ErrBadDHCPFormat is for an unsupported DHCP server configuration format
+var ErrBadDHCPFormat = errors.New("format must be dnsmasq or isc")
+
+// ErrBadIPFamily is for an IP version other than 4 or 6
+var ErrBadIPFamily = errors.New("family must be 4 or 6")
+
+// ErrBadPrefixLength is for a prefix length that does not fit within a pool
+var ErrBadPrefixLength = errors.New("prefix length must be within the pool cidr and leave room for a gateway and pool")
+
+// ErrPoolExhausted is for a pool with no free subnets of a prefix length left
+var ErrPoolExhausted = errors.New("no free subnets of that prefix length in pool")
+
+// ErrBadIPRangeMode is for an iprange mode unknown or unsuited to its IP
+// version
+var ErrBadIPRangeMode = errors.New("mode must be dhcp or static for IPv4, and slaac, dhcpv6, or static for IPv6")
+
+// ErrSLAACPrefixLength is for a SLAAC iprange with a cidr other than a /64
+var ErrSLAACPrefixLength = errors.New("slaac requires a /64 cidr")
+
+// ErrIPNotSLAAC is for an address requested from a SLAAC iprange that is not
+// the address derived from the MAC
+var ErrIPNotSLAAC = errors.New("IP must be the SLAAC address of the MAC")
+
+// ErrSegmentInUse is for a network segment that already has an iprange of the
+// same IP version
+var ErrSegmentInUse = errors.New("segment already has an iprange of that IP version in the network")
+
+// ErrBadCapacity is for a negative capacity in the hypervisor
+var ErrBadCapacity = errors.New("cpu, memory, and disk must be >= 0")
+
+// ErrBadOvercommit is for a negative overcommit ratio in the hypervisor
+var ErrBadOvercommit = errors.New("overcommit ratios must be >= 0")
+
+// ErrBadHypervisorState is for an unknown hypervisor state
+var ErrBadHypervisorState = errors.New("state must be registered, active, maintenance, draining, or decommissioned")
+
+// ErrIllegalTransition is for a hypervisor state change not allowed from its
+// current state
+var ErrIllegalTransition = errors.New("illegal hypervisor state transition")
+
+// ErrBadStaleAfter is for a configured heartbeat staleness threshold that is not
+// a positive duration
+var ErrBadStaleAfter = errors.New("heartbeat staleness threshold must be a positive duration")
+
+// ErrNoToken is for a bootstrap token without a secret
+var ErrNoToken = errors.New("missing token")
+
+// ErrUnlimitedToken is for a bootstrap token that is neither single use nor
+// expiring
+var ErrUnlimitedToken = errors.New("token must be single use or have an expiration")
+
+// ErrBadToken is for a bootstrap token that is unknown, expired, or used up
+var ErrBadToken = errors.New("invalid, expired, or used token")
+
+// ErrHypervisorExists is for registering a machine with a bootstrap token when
+// a hypervisor the token did not register already has its MAC
+var ErrHypervisorExists = errors.New("a hypervisor with the MAC is already registered")
+
+// ErrBadDatacenterID is for an invalid datacenter id (e.g. non-uuid)
+var ErrBadDatacenterID = errors.New("invalid datacenter id")
+
+// ErrBadZoneID is for an invalid zone id (e.g. non-uuid)
+var ErrBadZoneID = errors.New("invalid zone id")
+
+// ErrBadRackID is for an invalid rack id (e.g. non-uuid)
+var ErrBadRackID = errors.New("invalid rack id")
+
+// ErrDatacenterNotFound is for a zone in a datacenter that does not exist
+var ErrDatacenterNotFound = errors.New("datacenter not found")
+
+// ErrZoneNotFound is for a rack in a zone that does not exist
+var ErrZoneNotFound = errors.New("zone not found")
+
+// ErrRackNotFound is for a hypervisor in a rack that does not exist
+var ErrRackNotFound = errors.New("rack not found")
+
+// ErrLocationInUse is for deleting a datacenter, zone, or rack that still
+// contains zones, racks, or hypervisors
+var ErrLocationInUse = errors.New("location still contains zones, racks, or hypervisors")
+
+// ErrBadNetworkID is for an invalid network id (e.g. non-uuid)
+var ErrBadNetworkID = errors.New("invalid network id")
+
+// ErrNetworkNotFound is for a hypervisor interface attached to a network that
+// does not exist
+var ErrNetworkNotFound = errors.New("network not found")
+
+// ErrIPRangeNotFound is for a bootstrap token with an iprange that does not
+// exist
+var ErrIPRangeNotFound = errors.New("iprange not found")
+
+// ErrBadBond is for a hypervisor interface that is a member of itself
+var ErrBadBond = errors.New("interface can not be a member of itself")
+
+// ErrBondNotFound is for a hypervisor interface whose bond is not another
+// interface of the hypervisor
+var ErrBondNotFound = errors.New("bond must be another interface of the hypervisor")
+
+// ErrBondCycle is for a hypervisor interface whose bond is, directly or through
+// other bonds, a member of the interface
+var ErrBondCycle = errors.New("bonds can not form a cycle")
+
+// ErrInterfaceNameInUse is for a hypervisor interface whose name is already
+// used by another interface of the hypervisor
+var ErrInterfaceNameInUse = errors.New("name is already used by another interface of the hypervisor")
+
+// ErrNoAddress is for a missing address in the BMC
+var ErrNoAddress = errors.New("missing address")
+
+// ErrBadBMCProtocol is for an unknown BMC protocol
+var ErrBadBMCProtocol = errors.New("protocol must be ipmi or redfish")
+
+// ErrBadSecret is for a stored secret that could not be decrypted, such as
+// after the secrets key was changed
+var ErrBadSecret = errors.New("secret could not be decrypted")
+
+// ErrNilFacts is for a hardware facts report without a facts document
+var ErrNilFacts = errors.New("facts must be a JSON object")
+
+// ErrBadFactPath is for a dotted path into hardware facts with an empty part
+var ErrBadFactPath = errors.New("invalid fact path")
+
+// ErrFlavorNameInUse is for a name already used by another flavor
+var ErrFlavorNameInUse = errors.New("name is already used by another flavor")
+
+// OverlapError is for ipranges whose addresses overlap other ipranges
+type OverlapError struct {
+	IDs []string
+}
+
+// Error lists the ids of the overlapping ipranges
+func (err *OverlapError) Error() string {
+	return fmt.Sprintf("overlaps ipranges: %s", strings.Join(err.IDs, ", "))
+}
+
+// overlapError converts an exclusion violation raised by the database, such as
+// when a concurrent writer wins the race past an application level check, into
+// an OverlapError by rerunning the check. Other errors are returned as is.
+func overlapError(err error, check func() ([]string, error)) error {
+	pqErr, ok := err.(*pq.Error)
+	if !ok || pqErr.Code.Name() != "exclusion_violation" {
+		return err
+	}
+	ids, checkErr := check()
+	if checkErr != nil || len(ids) == 0 {
+		return err
+	}
+	return &OverlapError{IDs: ids}
+}
+
+// HypervisorConflictError is for a hypervisor whose MAC or IP is already used by
+// another hypervisor
+type HypervisorConflictError struct {
+	Field string
+	ID    string
+}
+
+// Error names the field and the id of the hypervisor already using it
+func (err *HypervisorConflictError) Error() string {
+	return fmt.Sprintf("%s is already used by hypervisor %s", err.Field, err.ID)
+}
+
+// hypervisorConflictError converts a unique violation raised by the database
+// for a hypervisor's MAC or IP into a HypervisorConflictError by looking up the
+// other hypervisor already using it. Other errors are returned as is.
+func hypervisorConflictError(err error, hypervisor *Hypervisor) error {
+	pqErr, ok := err.(*pq.Error)
+	if !ok {
+		return err
+	}
+	var field string
+	var conflicts []*Hypervisor
+	var lookupErr error
+	switch pqErr.Constraint {
+	case "hypervisors_mac_key":
+		field = "mac"
+		conflicts, lookupErr = HypervisorsByMAC(hypervisor.MAC)
+	case "hypervisors_ip_key":
+		field = "ip"
+		conflicts, lookupErr = HypervisorsByIP(hypervisor.IP)
+	default:
+		return err
+	}
+	if lookupErr != nil {
+		return err
+	}
+	for _, conflict := range conflicts {
+		if conflict.ID != hypervisor.ID {
+			return &HypervisorConflictError{Field: field, ID: conflict.ID}
+		}
+	}
+	return err
+}
+
+// interfaceConflictError converts a unique violation raised by the database
+// for a hypervisor interface's MAC into a HypervisorConflictError by looking up
+// the other hypervisor already using it, and for its name into ErrInterfaceNameInUse.
+// A foreign key violation for its network is converted into
+// ErrNetworkNotFound. Other errors are returned as is.
+func interfaceConflictError(err error, iface *HypervisorInterface) error {
+	pqErr, ok := err.(*pq.Error)
+	if !ok {
+		return err
+	}
+	switch pqErr.Constraint {
+	case "hypervisor_interfaces_mac_key":
+		conflicts, lookupErr := HypervisorsByMAC(iface.MAC)
+		if lookupErr != nil {
+			return err
+		}
+		// The MAC may also be shared within the interface's own hypervisor
+		for _, conflict := range conflicts {
+			if conflict.ID != iface.HypervisorID {
+				return &HypervisorConflictError{Field: "mac", ID: conflict.ID}
+			}
+		}
+		return err
+	case "hypervisor_interfaces_hypervisor_id_name_key":
+		return ErrInterfaceNameInUse
+	case "hypervisor_interfaces_network_id_fkey":
+		return ErrNetworkNotFound
+	}
+	return err
+}
+
+// segmentError converts the violation raised by the database when a network
+// segment would hold two ipranges of the same IP version into
+// ErrSegmentInUse. Other errors are returned as is.
+func segmentError(err error) error {
+	if pqErr, ok := err.(*pq.Error); ok && pqErr.Constraint == "iprange_networks_segment_family" {
+		return ErrSegmentInUse
+	}
+	return err
+}
+
+// locationNotFoundError converts the foreign key violation raised by the
+// database when saving a zone, rack, or hypervisor whose parent location does
+// not exist into the matching not found error. Other errors are returned as is.
+func locationNotFoundError(err error) error {
+	pqErr, ok := err.(*pq.Error)
+	if !ok || pqErr.Code.Name() != "foreign_key_violation" {
+		return err
+	}
+	switch pqErr.Constraint {
+	case "zones_datacenter_id_fkey":
+		return ErrDatacenterNotFound
+	case "racks_zone_id_fkey":
+		return ErrZoneNotFound
+	case "hypervisors_rack_id_fkey":
+		return ErrRackNotFound
+	}
+	return err
+}
+
+// locationInUseError converts the foreign key violation raised by the database
+// when deleting a datacenter, zone, or rack that still contains anything into
+// ErrLocationInUse. Other errors are returned as is.
+func locationInUseError(err error) error {
+	if pqErr, ok := err.(*pq.Error); ok && pqErr.Code.Name() == "foreign_key_violation" {
+		return ErrLocationInUse
+	}
+	return err
+}
+
+// BootTemplateError is for a boot script template that could not be parsed or
+// rendered
+type BootTemplateError struct {
+	Err error
+}
+
+// Error describes why the boot script template could not be used
+func (err *BootTemplateError) Error() string {
+	return fmt.Sprintf("invalid boot template: %s", err.Err)
+}
+
+// FlavorSpecError is for a flavor extra spec with an unknown key or a value
+// its spec does not allow
+type FlavorSpecError struct {
+	Key    string
+	Reason string
+}
+
+// Error names the extra spec key and what is wrong with it
+func (err *FlavorSpecError) Error() string {
+	return fmt.Sprintf("extra spec %s %s", err.Key, err.Reason)
+}
@@ -10,17 +10,35 @@ import (
 
 	"code.google.com/p/go-uuid/uuid"
 	"github.com/hashicorp/go-multierror"
+	"github.com/lib/pq"
 	"github.com/mistifyio/mistify-operator-admin/db"
 )
 
-// Flavor describes a unit of resources, similar to an AWS EC2 type
+// Flavor describes a unit of resources, similar to an AWS EC2 type. Extra
+// specs tune the resources beyond their amounts, such as CPU pinning, and are
+// validated against the FlavorSpecs registry. Private flavors are only
+// available to the projects related to them.
 type Flavor struct {
-	ID       string            `json:"id"`
-	Name     string            `json:"name"`
-	CPU      int               `json:"cpu"`    // Number of Cores
-	Memory   int               `json:"memory"` // Size in MB
-	Disk     int               `json:"disk"`   // Size in MB
-	Metadata map[string]string `json:"metadata"`
+	ID         string            `json:"id"`
+	Name       string            `json:"name"`
+	CPU        int               `json:"cpu"`    // Number of Cores
+	Memory     int               `json:"memory"` // Size in MB
+	Disk       int               `json:"disk"`   // Size in MB
+	Private    bool              `json:"private"`
+	ExtraSpecs map[string]string `json:"extra_specs"`
+	Metadata   map[string]string `json:"metadata"`
+	Projects   []*Project        `json:"-"`
+}
+
+// id returns the id, required by the relatable interface
+func (flavor *Flavor) id() string {
+	return flavor.ID
+}
+
+// pkeyName returns the database primary key name, required by the relatable
+// interface
+func (flavor *Flavor) pkeyName() string {
+	return "flavor_id"
 }
 
 // Validate ensures the flavor properties are set correctly
@@ -44,13 +62,17 @@ func (flavor *Flavor) Validate() error {
 	if flavor.Disk <= 0 {
 		result = multierror.Append(result, ErrBadDisk)
 	}
+	for _, err := range validateExtraSpecs(flavor.ExtraSpecs) {
+		result = multierror.Append(result, err)
+	}
 	if flavor.Metadata == nil {
 		result = multierror.Append(result, ErrNilMetadata)
 	}
 	return result.ErrorOrNil()
 }
 
-// Save persists a flavor to the database
+// Save persists a flavor to the database. Its name may not be used by any
+// other flavor.
 func (flavor *Flavor) Save() error {
 	if err := flavor.Validate(); err != nil {
 		return err
@@ -64,8 +86,8 @@ func (flavor *Flavor) Save() error {
 	// See: http://stackoverflow.com/a/8702291
 	// And: http://dba.stackexchange.com/a/78535
 	sql := `
-	WITH new_values (flavor_id, name, cpu, memory, disk, metadata) as (
-		VALUES ($1::uuid, $2, $3::integer, $4::integer, $5::integer, $6::json)
+	WITH new_values (flavor_id, name, cpu, memory, disk, private, extra_specs, metadata) as (
+		VALUES ($1::uuid, $2, $3::integer, $4::integer, $5::integer, $6::boolean, $7::json, $8::json)
 	),
 	upsert as (
 		UPDATE flavors f SET
@@ -73,17 +95,27 @@ func (flavor *Flavor) Save() error {
 			cpu = nv.cpu,
 			memory = nv.memory,
 			disk = nv.disk,
+			private = nv.private,
+			extra_specs = nv.extra_specs,
 			metadata = nv.metadata
 		FROM new_values nv
 		WHERE f.flavor_id = nv.flavor_id
 		RETURNING nv.flavor_id
 	)
 	INSERT INTO flavors
-		(flavor_id, name, cpu, memory, disk, metadata)
-	SELECT flavor_id, name, cpu, memory, disk, metadata
+		(flavor_id, name, cpu, memory, disk, private, extra_specs, metadata)
+	SELECT flavor_id, name, cpu, memory, disk, private, extra_specs, metadata
 	FROM new_values nv
 	WHERE NOT EXISTS (SELECT 1 FROM upsert u WHERE nv.flavor_id = u.flavor_id)
 	`
+	extraSpecs := flavor.ExtraSpecs
+	if extraSpecs == nil {
+		extraSpecs = make(map[string]string)
+	}
+	specs, err := json.Marshal(extraSpecs)
+	if err != nil {
+		return err
+	}
 	metadata, err := json.Marshal(flavor.Metadata)
 	if err != nil {
 		return err
@@ -94,8 +126,13 @@ func (flavor *Flavor) Save() error {
 		flavor.CPU,
 		flavor.Memory,
 		flavor.Disk,
+		flavor.Private,
+		string(specs),
 		string(metadata),
 	)
+	if pqErr, ok := err.(*pq.Error); ok && pqErr.Constraint == "flavors_name_key" {
+		return ErrFlavorNameInUse
+	}
 	return err
 }
 
@@ -117,7 +154,7 @@ func (flavor *Flavor) Load() error {
 		return err
 	}
 	sql := `
-	SELECT flavor_id, name, cpu, memory, disk, metadata
+	SELECT flavor_id, name, cpu, memory, disk, private, extra_specs, metadata
 	FROM flavors
 	WHERE flavor_id = $1
 	`
@@ -135,18 +172,23 @@ func (flavor *Flavor) Load() error {
 
 // fromRows unmarshals a database query result row into the flavor object
 func (flavor *Flavor) fromRows(rows *sql.Rows) error {
-	var metadata string
+	var extraSpecs, metadata string
 	err := rows.Scan(
 		&flavor.ID,
 		&flavor.Name,
 		&flavor.CPU,
 		&flavor.Memory,
 		&flavor.Disk,
+		&flavor.Private,
+		&extraSpecs,
 		&metadata,
 	)
 	if err != nil {
 		return err
 	}
+	if err := json.Unmarshal([]byte(extraSpecs), &flavor.ExtraSpecs); err != nil {
+		return err
+	}
 	return json.Unmarshal([]byte(metadata), &flavor.Metadata)
 }
 
@@ -155,6 +197,15 @@ func (flavor *Flavor) Decode(data io.Reader) error {
 	if err := json.NewDecoder(data).Decode(flavor); err != nil {
 		return err
 	}
+	if flavor.ExtraSpecs == nil {
+		flavor.ExtraSpecs = make(map[string]string)
+	} else {
+		for key, value := range flavor.ExtraSpecs {
+			if value == "" {
+				delete(flavor.ExtraSpecs, key)
+			}
+		}
+	}
 	if flavor.Metadata == nil {
 		flavor.Metadata = make(map[string]string)
 	} else {
@@ -167,6 +218,42 @@ func (flavor *Flavor) Decode(data io.Reader) error {
 	return nil
 }
 
+// LoadProjects retrieves the projects related to the flavor from the database
+func (flavor *Flavor) LoadProjects() error {
+	projects, err := ProjectsByFlavor(flavor)
+	if err != nil {
+		return err
+	}
+	flavor.Projects = projects
+	return nil
+}
+
+// SetProjects creates and ensures the only relations the flavor has with
+// projects
+func (flavor *Flavor) SetProjects(projects []*Project) error {
+	if len(projects) == 0 {
+		return ClearRelations("flavors_projects", flavor)
+	}
+	relatables := make([]relatable, len(projects))
+	for i, project := range projects {
+		relatables[i] = relatable(project)
+	}
+	if err := SetRelations("flavors_projects", flavor, relatables); err != nil {
+		return err
+	}
+	return flavor.LoadProjects()
+}
+
+// AddProject adds a relation to a project
+func (flavor *Flavor) AddProject(project *Project) error {
+	return AddRelation("flavors_projects", flavor, project)
+}
+
+// RemoveProject removes a relation with a project
+func (flavor *Flavor) RemoveProject(project *Project) error {
+	return RemoveRelation("flavors_projects", flavor, project)
+}
+
 // NewID generates a new uuid ID
 func (flavor *Flavor) NewID() string {
 	flavor.ID = uuid.New()
@@ -176,8 +263,9 @@ func (flavor *Flavor) NewID() string {
 // NewFlavor creates and initializes a new flavor object
 func NewFlavor() *Flavor {
 	flavor := &Flavor{
-		ID:       uuid.New(),
-		Metadata: make(map[string]string),
+		ID:         uuid.New(),
+		ExtraSpecs: make(map[string]string),
+		Metadata:   make(map[string]string),
 	}
 	return flavor
 }
@@ -193,6 +281,37 @@ func FetchFlavor(id string) (*Flavor, error) {
 	return flavor, nil
 }
 
+// FetchFlavorByName retrieves a flavor object from the database by name
+func FetchFlavorByName(name string) (*Flavor, error) {
+	flavors, err := flavorsByName(name)
+	if err != nil {
+		return nil, err
+	}
+	if len(flavors) == 0 {
+		return nil, sql.ErrNoRows
+	}
+	return flavors[0], nil
+}
+
+// flavorsByName retrieves an array of the flavor objects with a name from the
+// database. Names are unique, so there is at most one.
+func flavorsByName(name string) ([]*Flavor, error) {
+	d, err := db.Connect(nil)
+	if err != nil {
+		return nil, err
+	}
+	sql := `
+	SELECT flavor_id, name, cpu, memory, disk, private, extra_specs, metadata
+	FROM flavors
+	WHERE name = $1
+	`
+	rows, err := d.Query(sql, name)
+	if err != nil {
+		return nil, err
+	}
+	return flavorsFromRows(rows)
+}
+
 // ListFlavors retrieves an array of all flavor objects from the database
 func ListFlavors() ([]*Flavor, error) {
 	d, err := db.Connect(nil)
@@ -200,7 +319,7 @@ func ListFlavors() ([]*Flavor, error) {
 		return nil, err
 	}
 	sql := `
-	SELECT flavor_id, name, cpu, memory, disk, metadata
+	SELECT flavor_id, name, cpu, memory, disk, private, extra_specs, metadata
 	FROM flavors
 	ORDER BY flavor_id asc
 	`
@@ -208,6 +327,38 @@ func ListFlavors() ([]*Flavor, error) {
 	if err != nil {
 		return nil, err
 	}
+	return flavorsFromRows(rows)
+}
+
+// FlavorsByProject retrieves an array of the flavors available to a project
+// from the database: all public flavors, along with the private flavors
+// related to the project
+func FlavorsByProject(project *Project) ([]*Flavor, error) {
+	d, err := db.Connect(nil)
+	if err != nil {
+		return nil, err
+	}
+	sql := `
+	SELECT f.flavor_id, f.name, f.cpu, f.memory, f.disk, f.private, f.extra_specs, f.metadata
+	FROM flavors f
+	WHERE NOT f.private
+	OR EXISTS (
+		SELECT 1 FROM flavors_projects fp
+		WHERE fp.flavor_id = f.flavor_id
+		AND fp.project_id = $1
+	)
+	ORDER BY flavor_id asc
+	`
+	rows, err := d.Query(sql, project.ID)
+	if err != nil {
+		return nil, err
+	}
+	return flavorsFromRows(rows)
+}
+
+// flavorsFromRows unmarshals multiple query rows into an array of flavors
+func flavorsFromRows(rows *sql.Rows) ([]*Flavor, error) {
+	defer rows.Close()
 	flavors := make([]*Flavor, 0, 1)
 	for rows.Next() {
 		flavor := &Flavor{}
@@ -216,7 +367,7 @@ func ListFlavors() ([]*Flavor, error) {
 		}
 		flavors = append(flavors, flavor)
 	}
-	if err = rows.Err(); err != nil {
+	if err := rows.Err(); err != nil {
 		return nil, err
 	}
 	return flavors, nil
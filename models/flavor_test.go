@@ -1,6 +1,7 @@
 package models_test
 
 import (
+	"database/sql"
 	"strings"
 	"testing"
 
@@ -16,6 +17,10 @@ var flavorJSON = `{
 	"cpu": 5,
 	"memory": 10,
 	"disk": 15,
+	"extra_specs": {
+		"cpu:policy": "dedicated",
+		"custom:team": "storage"
+	},
 	"metadata": {
 		"foo": "bar"
 	}
@@ -34,12 +39,14 @@ func checkFlavorValues(t *testing.T, flavor *models.Flavor) {
 	h.Equals(t, 5, flavor.CPU)
 	h.Equals(t, 10, flavor.Memory)
 	h.Equals(t, 15, flavor.Disk)
+	h.Equals(t, map[string]string{"cpu:policy": "dedicated", "custom:team": "storage"}, flavor.ExtraSpecs)
 	h.Equals(t, map[string]string{"foo": "bar"}, flavor.Metadata)
 }
 
 func TestNewFlavor(t *testing.T) {
 	flavor := models.NewFlavor()
 	h.Assert(t, uuid.Parse(flavor.ID) != nil, "missing uuid ID")
+	h.Assert(t, flavor.ExtraSpecs != nil, "uninitialized extra specs")
 	h.Assert(t, flavor.Metadata != nil, "uninitialized metadata")
 }
 
@@ -95,6 +102,57 @@ func TestFlavorValidate(t *testing.T) {
 	h.Ok(t, err)
 }
 
+func TestFlavorValidateExtraSpecs(t *testing.T) {
+	flavor := createFlavor(t)
+	h.Ok(t, flavor.Validate())
+
+	specErrors := func(err error) []*models.FlavorSpecError {
+		merr, ok := err.(*multierror.Error)
+		if !ok {
+			return nil
+		}
+		var specErrs []*models.FlavorSpecError
+		for _, e := range merr.Errors {
+			if specErr, ok := e.(*models.FlavorSpecError); ok {
+				specErrs = append(specErrs, specErr)
+			}
+		}
+		return specErrs
+	}
+
+	valid := map[string]string{
+		"cpu:policy":        "shared",
+		"numa:nodes":        "2",
+		"memory:page_size":  "1GB",
+		"memory:locked":     "true",
+		"network:bandwidth": "100000",
+		"custom:anything":   "goes",
+	}
+	for key, value := range valid {
+		flavor.ExtraSpecs = map[string]string{key: value}
+		h.Ok(t, flavor.Validate())
+	}
+
+	invalid := map[string]string{
+		"cpu:policy":     "pinned",
+		"numa:nodes":     "0",
+		"disk:read_iops": "lots",
+		"memory:locked":  "yes",
+		"foo":            "bar",
+		"custom:":        "bar",
+	}
+	for key, value := range invalid {
+		flavor.ExtraSpecs = map[string]string{key: value}
+		specErrs := specErrors(flavor.Validate())
+		h.Equals(t, 1, len(specErrs))
+		h.Equals(t, key, specErrs[0].Key)
+	}
+
+	// Every bad spec is reported
+	flavor.ExtraSpecs = invalid
+	h.Equals(t, len(invalid), len(specErrors(flavor.Validate())))
+}
+
 func TestFlavorSave(t *testing.T) {
 	flavor := createFlavor(t)
 	h.Ok(t, flavor.Save())
@@ -127,6 +185,25 @@ func TestFetchFlavor(t *testing.T) {
 	h.Ok(t, flavor2.Delete())
 }
 
+func TestFetchFlavorByName(t *testing.T) {
+	flavor := createFlavor(t)
+	h.Ok(t, flavor.Save())
+
+	flavor2, err := models.FetchFlavorByName("fooName")
+	h.Ok(t, err)
+	checkFlavorValues(t, flavor2)
+
+	_, err = models.FetchFlavorByName("barName")
+	h.Equals(t, sql.ErrNoRows, err)
+
+	// Names are unique
+	flavor3 := createFlavor(t)
+	flavor3.NewID()
+	h.Equals(t, models.ErrFlavorNameInUse, flavor3.Save())
+
+	h.Ok(t, flavor2.Delete())
+}
+
 func TestListFlavors(t *testing.T) {
 	flavor := createFlavor(t)
 	h.Ok(t, flavor.Save())
@@ -139,6 +216,60 @@ func TestListFlavors(t *testing.T) {
 	h.Ok(t, flavor.Delete())
 }
 
+func TestFlavorProjectRelations(t *testing.T) {
+	// Prep
+	flavor := createFlavor(t)
+	h.Ok(t, flavor.Save())
+	project := createProject(t)
+	h.Ok(t, project.Save())
+	private := createFlavor(t)
+	private.NewID()
+	private.Name = "privateName"
+	private.Private = true
+	h.Ok(t, private.Save())
+
+	// Private flavors are only available to related projects
+	flavors, err := models.FlavorsByProject(project)
+	h.Ok(t, err)
+	h.Equals(t, 1, len(flavors))
+	h.Equals(t, flavor.ID, flavors[0].ID)
+
+	// Add
+	h.Ok(t, private.AddProject(project))
+	flavors, err = models.FlavorsByProject(project)
+	h.Ok(t, err)
+	h.Equals(t, 2, len(flavors))
+
+	// Load
+	h.Ok(t, private.LoadProjects())
+	h.Equals(t, 1, len(private.Projects))
+
+	// Remove
+	h.Ok(t, private.RemoveProject(project))
+	h.Ok(t, private.LoadProjects())
+	h.Equals(t, 0, len(private.Projects))
+
+	// Set
+	h.Ok(t, private.SetProjects([]*models.Project{project}))
+	h.Ok(t, private.LoadProjects())
+	h.Equals(t, 1, len(private.Projects))
+
+	// Lookup projects by flavor
+	projects, err := models.ProjectsByFlavor(private)
+	h.Ok(t, err)
+	h.Equals(t, 1, len(projects))
+
+	// Clear
+	h.Ok(t, private.SetProjects(make([]*models.Project, 0)))
+	h.Ok(t, private.LoadProjects())
+	h.Equals(t, 0, len(private.Projects))
+
+	// Cleanup
+	h.Ok(t, private.Delete())
+	h.Ok(t, project.Delete())
+	h.Ok(t, flavor.Delete())
+}
+
 func errContains(err error, list error) bool {
 	merr, ok := list.(*multierror.Error)
 	if !ok {
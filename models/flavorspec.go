@@ -0,0 +1,163 @@
+package models
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Types of flavor extra spec values
+const (
+	// FlavorSpecTypeInt is for whole number values of at least the spec's Min
+	FlavorSpecTypeInt = "int"
+	// FlavorSpecTypeBool is for true or false values
+	FlavorSpecTypeBool = "bool"
+	// FlavorSpecTypeEnum is for values from the spec's list of Values
+	FlavorSpecTypeEnum = "enum"
+)
+
+// FlavorSpecCustomPrefix namespaces extra spec keys that are not in the
+// registry. Custom specs are stored as is without validation.
+const FlavorSpecCustomPrefix = "custom:"
+
+// FlavorSpec describes a known flavor extra spec key and the values it allows
+type FlavorSpec struct {
+	Key         string   `json:"key"`
+	Type        string   `json:"type"`
+	Values      []string `json:"values,omitempty"`
+	Min         int      `json:"min,omitempty"`
+	Description string   `json:"description"`
+}
+
+// FlavorSpecs is the registry of known flavor extra spec keys
+var FlavorSpecs = []*FlavorSpec{
+	{
+		Key:         "cpu:policy",
+		Type:        FlavorSpecTypeEnum,
+		Values:      []string{"shared", "dedicated"},
+		Description: "Whether guest vCPUs float over host CPUs or are pinned to dedicated host CPUs",
+	},
+	{
+		Key:         "cpu:thread_policy",
+		Type:        FlavorSpecTypeEnum,
+		Values:      []string{"prefer", "isolate", "require"},
+		Description: "How pinned vCPUs are placed on host CPUs with simultaneous multithreading",
+	},
+	{
+		Key:         "numa:nodes",
+		Type:        FlavorSpecTypeInt,
+		Min:         1,
+		Description: "Number of NUMA nodes to spread guest vCPUs and memory over",
+	},
+	{
+		Key:         "memory:page_size",
+		Type:        FlavorSpecTypeEnum,
+		Values:      []string{"small", "large", "any", "2MB", "1GB"},
+		Description: "Page size backing guest memory, where large and sized pages use hugepages",
+	},
+	{
+		Key:         "memory:locked",
+		Type:        FlavorSpecTypeBool,
+		Description: "Whether guest memory is locked into host memory so it is never swapped out",
+	},
+	{
+		Key:         "disk:read_iops",
+		Type:        FlavorSpecTypeInt,
+		Min:         1,
+		Description: "Limit on disk read operations per second",
+	},
+	{
+		Key:         "disk:write_iops",
+		Type:        FlavorSpecTypeInt,
+		Min:         1,
+		Description: "Limit on disk write operations per second",
+	},
+	{
+		Key:         "disk:read_bytes_sec",
+		Type:        FlavorSpecTypeInt,
+		Min:         1,
+		Description: "Limit on disk read bandwidth in bytes per second",
+	},
+	{
+		Key:         "disk:write_bytes_sec",
+		Type:        FlavorSpecTypeInt,
+		Min:         1,
+		Description: "Limit on disk write bandwidth in bytes per second",
+	},
+	{
+		Key:         "network:bandwidth",
+		Type:        FlavorSpecTypeInt,
+		Min:         1,
+		Description: "Limit on network bandwidth in kilobits per second",
+	},
+	{
+		Key:         "network:burst",
+		Type:        FlavorSpecTypeInt,
+		Min:         1,
+		Description: "Size in kilobytes of bursts allowed above the network bandwidth limit",
+	},
+}
+
+// LookupFlavorSpec finds a known flavor extra spec by key
+func LookupFlavorSpec(key string) (*FlavorSpec, bool) {
+	for _, spec := range FlavorSpecs {
+		if spec.Key == key {
+			return spec, true
+		}
+	}
+	return nil, false
+}
+
+// validate checks a value against the spec's type and allowed values
+func (spec *FlavorSpec) validate(value string) error {
+	switch spec.Type {
+	case FlavorSpecTypeInt:
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return &FlavorSpecError{spec.Key, "must be a whole number"}
+		}
+		if n < spec.Min {
+			return &FlavorSpecError{spec.Key, fmt.Sprintf("must be >= %d", spec.Min)}
+		}
+	case FlavorSpecTypeBool:
+		if value != "true" && value != "false" {
+			return &FlavorSpecError{spec.Key, "must be true or false"}
+		}
+	case FlavorSpecTypeEnum:
+		for _, allowed := range spec.Values {
+			if value == allowed {
+				return nil
+			}
+		}
+		return &FlavorSpecError{spec.Key, "must be one of " + strings.Join(spec.Values, ", ")}
+	}
+	return nil
+}
+
+// validateExtraSpecs checks each extra spec against the registry, in key
+// order. Keys that are neither known nor custom are rejected.
+func validateExtraSpecs(specs map[string]string) []error {
+	keys := make([]string, 0, len(specs))
+	for key := range specs {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var errs []error
+	for _, key := range keys {
+		value := specs[key]
+		if strings.HasPrefix(key, FlavorSpecCustomPrefix) && len(key) > len(FlavorSpecCustomPrefix) {
+			continue
+		}
+		spec, ok := LookupFlavorSpec(key)
+		if !ok {
+			errs = append(errs, &FlavorSpecError{key, "is not a known spec; prefix it with " + FlavorSpecCustomPrefix + " for a custom spec"})
+			continue
+		}
+		if err := spec.validate(value); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errs
+}
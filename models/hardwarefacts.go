@@ -0,0 +1,260 @@
+package models
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mistifyio/mistify-operator-admin/db"
+)
+
+// Kinds of change between two hardware facts reports
+const (
+	FactAdded   = "added"
+	FactRemoved = "removed"
+	FactChanged = "changed"
+)
+
+type (
+	// HardwareFacts is a structured hardware inventory document, such as the
+	// JSON output of lshw
+	HardwareFacts map[string]interface{}
+
+	// HardwareFactsReport is a version of the hardware facts reported for a
+	// hypervisor. Versions count up from 1 for each hypervisor.
+	HardwareFactsReport struct {
+		HypervisorID string        `json:"hypervisor"`
+		Version      int           `json:"version"`
+		Reported     time.Time     `json:"reported"`
+		Facts        HardwareFacts `json:"facts"`
+	}
+
+	// FactChange is a single difference between two hardware facts reports.
+	// The path is dotted like fact queries, with array elements given by
+	// index.
+	FactChange struct {
+		Path   string      `json:"path"`
+		Change string      `json:"change"`
+		From   interface{} `json:"from"`
+		To     interface{} `json:"to"`
+	}
+)
+
+// Decode unmarshals a JSON hardware facts document, keeping numbers as they
+// were given rather than converting them to floats
+func (facts *HardwareFacts) Decode(data io.Reader) error {
+	decoder := json.NewDecoder(data)
+	decoder.UseNumber()
+	return decoder.Decode(facts)
+}
+
+// decodeFacts unmarshals stored hardware facts
+func decodeFacts(b []byte) (HardwareFacts, error) {
+	var facts HardwareFacts
+	if err := facts.Decode(bytes.NewReader(b)); err != nil {
+		return nil, err
+	}
+	return facts, nil
+}
+
+// ParseFactPath splits a dotted fact path, such as cpu.model, into its parts
+func ParseFactPath(path string) ([]string, error) {
+	parts := strings.Split(path, ".")
+	for _, part := range parts {
+		if part == "" {
+			return nil, ErrBadFactPath
+		}
+	}
+	return parts, nil
+}
+
+// ReportHardwareFacts stores a new version of the hypervisor's hardware facts
+func (hypervisor *Hypervisor) ReportHardwareFacts(facts HardwareFacts) (*HardwareFactsReport, error) {
+	if facts == nil {
+		return nil, ErrNilFacts
+	}
+	factsJSON, err := json.Marshal(facts)
+	if err != nil {
+		return nil, err
+	}
+	d, err := db.Connect(nil)
+	if err != nil {
+		return nil, err
+	}
+	// Lock the hypervisor row to serialize versions
+	txn, err := d.Begin()
+	if err != nil {
+		return nil, err
+	}
+	lockSQL := "SELECT 1 FROM hypervisors WHERE hypervisor_id = $1 FOR UPDATE"
+	var found int
+	if err := txn.QueryRow(lockSQL, hypervisor.ID).Scan(&found); err != nil {
+		_ = txn.Rollback()
+		return nil, err
+	}
+	sql := `
+	INSERT INTO hypervisor_facts
+		(hypervisor_id, version, facts)
+	SELECT $1, COALESCE(MAX(version), 0) + 1, $2::json
+	FROM hypervisor_facts
+	WHERE hypervisor_id = $1
+	RETURNING version, reported
+	`
+	report := &HardwareFactsReport{
+		HypervisorID: hypervisor.ID,
+	}
+	if err := txn.QueryRow(sql, hypervisor.ID, string(factsJSON)).Scan(&report.Version, &report.Reported); err != nil {
+		_ = txn.Rollback()
+		return nil, err
+	}
+	if err := txn.Commit(); err != nil {
+		return nil, err
+	}
+	if report.Facts, err = decodeFacts(factsJSON); err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+// fromRows unmarshals a database query result row into the report object
+func (report *HardwareFactsReport) fromRows(rows *sql.Rows) error {
+	var facts string
+	err := rows.Scan(
+		&report.HypervisorID,
+		&report.Version,
+		&report.Reported,
+		&facts,
+	)
+	if err != nil {
+		return err
+	}
+	report.Facts, err = decodeFacts([]byte(facts))
+	return err
+}
+
+// FetchHardwareFactsReport retrieves a version of the hypervisor's hardware
+// facts from the database. Version 0 is the latest.
+func FetchHardwareFactsReport(hypervisor *Hypervisor, version int) (*HardwareFactsReport, error) {
+	d, err := db.Connect(nil)
+	if err != nil {
+		return nil, err
+	}
+	sql := `
+	SELECT hypervisor_id, version, reported, facts
+	FROM hypervisor_facts
+	WHERE hypervisor_id = $1
+	AND ($2 = 0 OR version = $2)
+	ORDER BY version desc
+	LIMIT 1
+	`
+	report := &HardwareFactsReport{}
+	var facts string
+	err = d.QueryRow(sql, hypervisor.ID, version).Scan(
+		&report.HypervisorID,
+		&report.Version,
+		&report.Reported,
+		&facts,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if report.Facts, err = decodeFacts([]byte(facts)); err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+// HardwareFactsReportsByHypervisor retrieves an array of all versions of the
+// hypervisor's hardware facts from the database, oldest first
+func HardwareFactsReportsByHypervisor(hypervisor *Hypervisor) ([]*HardwareFactsReport, error) {
+	d, err := db.Connect(nil)
+	if err != nil {
+		return nil, err
+	}
+	sql := `
+	SELECT hypervisor_id, version, reported, facts
+	FROM hypervisor_facts
+	WHERE hypervisor_id = $1
+	ORDER BY version asc
+	`
+	rows, err := d.Query(sql, hypervisor.ID)
+	if err != nil {
+		return nil, err
+	}
+	reports := make([]*HardwareFactsReport, 0, 1)
+	for rows.Next() {
+		report := &HardwareFactsReport{}
+		if err := report.fromRows(rows); err != nil {
+			return nil, err
+		}
+		reports = append(reports, report)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return reports, nil
+}
+
+// flattenFacts collects the leaf values of a facts document by dotted path
+func flattenFacts(prefix string, value interface{}, leaves map[string]interface{}) {
+	join := func(key string) string {
+		if prefix == "" {
+			return key
+		}
+		return prefix + "." + key
+	}
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, child := range v {
+			flattenFacts(join(key), child, leaves)
+		}
+	case HardwareFacts:
+		flattenFacts(prefix, map[string]interface{}(v), leaves)
+	case []interface{}:
+		for i, child := range v {
+			flattenFacts(join(fmt.Sprint(i)), child, leaves)
+		}
+	default:
+		leaves[prefix] = value
+	}
+}
+
+// DiffHardwareFacts lists the differences between two hardware facts reports,
+// sorted by path
+func DiffHardwareFacts(from, to *HardwareFactsReport) []*FactChange {
+	fromLeaves := make(map[string]interface{})
+	toLeaves := make(map[string]interface{})
+	flattenFacts("", from.Facts, fromLeaves)
+	flattenFacts("", to.Facts, toLeaves)
+
+	changes := make([]*FactChange, 0, 1)
+	for path, fromValue := range fromLeaves {
+		toValue, ok := toLeaves[path]
+		switch {
+		case !ok:
+			changes = append(changes, &FactChange{Path: path, Change: FactRemoved, From: fromValue})
+		case !reflect.DeepEqual(fromValue, toValue):
+			changes = append(changes, &FactChange{Path: path, Change: FactChanged, From: fromValue, To: toValue})
+		}
+	}
+	for path, toValue := range toLeaves {
+		if _, ok := fromLeaves[path]; !ok {
+			changes = append(changes, &FactChange{Path: path, Change: FactAdded, To: toValue})
+		}
+	}
+	sort.Sort(factChanges(changes))
+	return changes
+}
+
+// factChanges sorts fact changes by path
+type factChanges []*FactChange
+
+func (changes factChanges) Len() int           { return len(changes) }
+func (changes factChanges) Swap(i, j int)      { changes[i], changes[j] = changes[j], changes[i] }
+func (changes factChanges) Less(i, j int) bool { return changes[i].Path < changes[j].Path }
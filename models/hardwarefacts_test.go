@@ -0,0 +1,123 @@
+package models_test
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	h "github.com/bakins/test-helpers"
+	"github.com/mistifyio/mistify-operator-admin/models"
+)
+
+var hardwareFactsJSON = `{
+	"serial": "ABC123",
+	"vendor": "Acme",
+	"cpu": {
+		"model": "Xeon E5-2680",
+		"cores": 16
+	},
+	"disks": [
+		{"name": "sda", "size": 480103981056},
+		{"name": "sdb", "size": 480103981056}
+	]
+}`
+
+func createHardwareFacts(t *testing.T) models.HardwareFacts {
+	var facts models.HardwareFacts
+	h.Ok(t, facts.Decode(strings.NewReader(hardwareFactsJSON)))
+	return facts
+}
+
+func TestParseFactPath(t *testing.T) {
+	parts, err := models.ParseFactPath("cpu.model")
+	h.Ok(t, err)
+	h.Equals(t, []string{"cpu", "model"}, parts)
+
+	parts, err = models.ParseFactPath("disks.0.size")
+	h.Ok(t, err)
+	h.Equals(t, []string{"disks", "0", "size"}, parts)
+
+	for _, path := range []string{"", "cpu.", ".cpu", "cpu..model"} {
+		_, err = models.ParseFactPath(path)
+		h.Equals(t, models.ErrBadFactPath, err)
+	}
+}
+
+func TestHardwareFactsDecode(t *testing.T) {
+	facts := createHardwareFacts(t)
+	h.Equals(t, "ABC123", facts["serial"])
+
+	// Large numbers are kept as given
+	disk := facts["disks"].([]interface{})[0].(map[string]interface{})
+	h.Equals(t, json.Number("480103981056"), disk["size"])
+}
+
+func TestDiffHardwareFacts(t *testing.T) {
+	from := &models.HardwareFactsReport{Version: 1, Facts: createHardwareFacts(t)}
+	to := &models.HardwareFactsReport{Version: 2, Facts: createHardwareFacts(t)}
+	h.Equals(t, 0, len(models.DiffHardwareFacts(from, to)))
+
+	to.Facts["cpu"].(map[string]interface{})["model"] = "Xeon E5-2690"
+	to.Facts["disks"] = to.Facts["disks"].([]interface{})[:1]
+	to.Facts["bmc"] = "ipmi"
+
+	changes := models.DiffHardwareFacts(from, to)
+	h.Equals(t, 4, len(changes))
+	h.Equals(t, &models.FactChange{Path: "bmc", Change: models.FactAdded, To: "ipmi"}, changes[0])
+	h.Equals(t, &models.FactChange{Path: "cpu.model", Change: models.FactChanged, From: "Xeon E5-2680", To: "Xeon E5-2690"}, changes[1])
+	h.Equals(t, &models.FactChange{Path: "disks.1.name", Change: models.FactRemoved, From: "sdb"}, changes[2])
+	h.Equals(t, "disks.1.size", changes[3].Path)
+	h.Equals(t, models.FactRemoved, changes[3].Change)
+}
+
+func TestReportHardwareFacts(t *testing.T) {
+	// Prep
+	hypervisor := createHypervisor(t)
+	h.Ok(t, hypervisor.Save())
+
+	_, err := hypervisor.ReportHardwareFacts(nil)
+	h.Equals(t, models.ErrNilFacts, err)
+
+	report, err := hypervisor.ReportHardwareFacts(createHardwareFacts(t))
+	h.Ok(t, err)
+	h.Equals(t, 1, report.Version)
+	h.Assert(t, !report.Reported.IsZero(), "expected reported time")
+
+	facts := createHardwareFacts(t)
+	facts["cpu"].(map[string]interface{})["model"] = "Xeon E5-2690"
+	report, err = hypervisor.ReportHardwareFacts(facts)
+	h.Ok(t, err)
+	h.Equals(t, 2, report.Version)
+
+	// Fetch
+	latest, err := models.FetchHardwareFactsReport(hypervisor, 0)
+	h.Ok(t, err)
+	h.Equals(t, 2, latest.Version)
+	h.Equals(t, "Xeon E5-2690", latest.Facts["cpu"].(map[string]interface{})["model"])
+
+	first, err := models.FetchHardwareFactsReport(hypervisor, 1)
+	h.Ok(t, err)
+	h.Equals(t, 1, first.Version)
+	h.Equals(t, 1, len(models.DiffHardwareFacts(first, latest)))
+
+	reports, err := models.HardwareFactsReportsByHypervisor(hypervisor)
+	h.Ok(t, err)
+	h.Equals(t, 2, len(reports))
+
+	// Filter by the latest facts
+	hypervisors, err := models.FilterHypervisors(&models.HypervisorFilter{
+		Facts: map[string]string{"cpu.model": "Xeon E5-2690", "disks.0.name": "sda"},
+	})
+	h.Ok(t, err)
+	h.Equals(t, 1, len(hypervisors))
+	h.Equals(t, hypervisor.ID, hypervisors[0].ID)
+
+	hypervisors, err = models.FilterHypervisors(&models.HypervisorFilter{
+		Facts: map[string]string{"cpu.model": "Xeon E5-2680"},
+	})
+	h.Ok(t, err)
+	h.Equals(t, 0, len(hypervisors))
+
+	// Cleanup
+	h.Ok(t, hypervisor.Delete())
+}
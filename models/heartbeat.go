@@ -0,0 +1,116 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/mistifyio/mistify-operator-admin/db"
+)
+
+// Hypervisor statuses describe how recently a hypervisor has sent a heartbeat
+const (
+	// HypervisorStatusHealthy is for a hypervisor heard from within the
+	// staleness threshold
+	HypervisorStatusHealthy = "healthy"
+	// HypervisorStatusStale is for a hypervisor not heard from within the
+	// staleness threshold
+	HypervisorStatusStale = "stale"
+	// HypervisorStatusUnknown is for a hypervisor that has never sent a
+	// heartbeat
+	HypervisorStatusUnknown = "unknown"
+)
+
+// Config namespace and key holding the heartbeat staleness threshold, as a
+// duration string such as "5m"
+const (
+	HeartbeatConfigNamespace = "hypervisors"
+	HeartbeatStaleAfterKey   = "heartbeat_stale_after"
+)
+
+// DefaultHeartbeatStaleAfter is the staleness threshold used when none is
+// configured
+const DefaultHeartbeatStaleAfter = 5 * time.Minute
+
+// Heartbeat records that the hypervisor has been seen now. Agent facts, if
+// given, replace those previously reported; otherwise they are left as is.
+func (hypervisor *Hypervisor) Heartbeat(facts map[string]string) error {
+	d, err := db.Connect(nil)
+	if err != nil {
+		return err
+	}
+	var factsJSON interface{}
+	if facts != nil {
+		b, err := json.Marshal(facts)
+		if err != nil {
+			return err
+		}
+		factsJSON = string(b)
+	}
+	sql := `
+	UPDATE hypervisors
+	SET last_seen = now(), agent_facts = COALESCE($2::json, agent_facts)
+	WHERE hypervisor_id = $1
+	RETURNING last_seen, agent_facts
+	`
+	var lastSeen pq.NullTime
+	var agentFacts string
+	if err := d.QueryRow(sql, hypervisor.ID, factsJSON).Scan(&lastSeen, &agentFacts); err != nil {
+		return err
+	}
+	if err := json.Unmarshal([]byte(agentFacts), &hypervisor.AgentFacts); err != nil {
+		return err
+	}
+	hypervisor.LastSeen = lastSeen.Time
+	return nil
+}
+
+// HeartbeatStatus determines the status of the hypervisor at a point in time
+// from when it was last seen
+func (hypervisor *Hypervisor) HeartbeatStatus(staleAfter time.Duration, now time.Time) string {
+	if hypervisor.LastSeen.IsZero() {
+		return HypervisorStatusUnknown
+	}
+	if now.Sub(hypervisor.LastSeen) > staleAfter {
+		return HypervisorStatusStale
+	}
+	return HypervisorStatusHealthy
+}
+
+// HeartbeatStaleAfter retrieves the configured heartbeat staleness threshold,
+// falling back to DefaultHeartbeatStaleAfter if none is set
+func HeartbeatStaleAfter() (time.Duration, error) {
+	config := NewConfig()
+	if err := config.Load(); err != nil {
+		return 0, err
+	}
+	value, _ := config.GetValue(HeartbeatConfigNamespace, HeartbeatStaleAfterKey)
+	return parseStaleAfter(value)
+}
+
+// parseStaleAfter parses a heartbeat staleness threshold, with an empty value
+// meaning DefaultHeartbeatStaleAfter
+func parseStaleAfter(value string) (time.Duration, error) {
+	if value == "" {
+		return DefaultHeartbeatStaleAfter, nil
+	}
+	staleAfter, err := time.ParseDuration(value)
+	if err != nil || staleAfter <= 0 {
+		return 0, ErrBadStaleAfter
+	}
+	return staleAfter, nil
+}
+
+// SetHypervisorStatuses sets the status of each hypervisor using the
+// configured heartbeat staleness threshold
+func SetHypervisorStatuses(hypervisors []*Hypervisor) error {
+	staleAfter, err := HeartbeatStaleAfter()
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	for _, hypervisor := range hypervisors {
+		hypervisor.Status = hypervisor.HeartbeatStatus(staleAfter, now)
+	}
+	return nil
+}
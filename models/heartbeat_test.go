@@ -0,0 +1,81 @@
+package models_test
+
+import (
+	"testing"
+	"time"
+
+	h "github.com/bakins/test-helpers"
+	"github.com/mistifyio/mistify-operator-admin/config"
+	"github.com/mistifyio/mistify-operator-admin/models"
+)
+
+func TestHypervisorHeartbeatStatus(t *testing.T) {
+	hypervisor := createHypervisor(t)
+	now := time.Now()
+
+	h.Equals(t, models.HypervisorStatusUnknown, hypervisor.HeartbeatStatus(time.Minute, now))
+
+	hypervisor.LastSeen = now.Add(-30 * time.Second)
+	h.Equals(t, models.HypervisorStatusHealthy, hypervisor.HeartbeatStatus(time.Minute, now))
+
+	hypervisor.LastSeen = now.Add(-2 * time.Minute)
+	h.Equals(t, models.HypervisorStatusStale, hypervisor.HeartbeatStatus(time.Minute, now))
+}
+
+func TestHypervisorHeartbeat(t *testing.T) {
+	config.Load(configFileName)
+
+	// Prep
+	hypervisor := createHypervisor(t)
+	h.Ok(t, hypervisor.Save())
+
+	h.Ok(t, models.SetHypervisorStatuses([]*models.Hypervisor{hypervisor}))
+	h.Equals(t, models.HypervisorStatusUnknown, hypervisor.Status)
+
+	h.Ok(t, hypervisor.Heartbeat(map[string]string{"agent_version": "1.0"}))
+	h.Assert(t, !hypervisor.LastSeen.IsZero(), "expected last seen to be set")
+	h.Equals(t, map[string]string{"agent_version": "1.0"}, hypervisor.AgentFacts)
+
+	// Facts are kept when none are reported
+	h.Ok(t, hypervisor.Heartbeat(nil))
+	h.Ok(t, hypervisor.Load())
+	h.Equals(t, map[string]string{"agent_version": "1.0"}, hypervisor.AgentFacts)
+
+	// Saving leaves the heartbeat data alone
+	hypervisor.AgentFacts = nil
+	h.Ok(t, hypervisor.Save())
+	h.Ok(t, hypervisor.Load())
+	h.Equals(t, map[string]string{"agent_version": "1.0"}, hypervisor.AgentFacts)
+
+	h.Ok(t, models.SetHypervisorStatuses([]*models.Hypervisor{hypervisor}))
+	h.Equals(t, models.HypervisorStatusHealthy, hypervisor.Status)
+
+	// Cleanup
+	h.Ok(t, hypervisor.Delete())
+}
+
+func TestHeartbeatStaleAfter(t *testing.T) {
+	config.Load(configFileName)
+
+	staleAfter, err := models.HeartbeatStaleAfter()
+	h.Ok(t, err)
+	h.Equals(t, models.DefaultHeartbeatStaleAfter, staleAfter)
+
+	c := models.NewConfig()
+	c.SetValue(models.HeartbeatConfigNamespace, models.HeartbeatStaleAfterKey, "90s")
+	h.Ok(t, c.Save())
+	staleAfter, err = models.HeartbeatStaleAfter()
+	h.Ok(t, err)
+	h.Equals(t, 90*time.Second, staleAfter)
+
+	// Bad thresholds are not saved
+	c.SetValue(models.HeartbeatConfigNamespace, models.HeartbeatStaleAfterKey, "foobar")
+	h.Equals(t, models.ErrBadStaleAfter, c.Save())
+	staleAfter, err = models.HeartbeatStaleAfter()
+	h.Ok(t, err)
+	h.Equals(t, 90*time.Second, staleAfter)
+
+	// Cleanup
+	c.DeleteNamespace(models.HeartbeatConfigNamespace)
+	h.Ok(t, c.Save())
+}
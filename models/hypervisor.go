@@ -3,30 +3,85 @@ package models
 import (
 	"database/sql"
 	"encoding/json"
+	"fmt"
 	"io"
 	"net"
+	"sort"
+	"strings"
+	"time"
 
 	"code.google.com/p/go-uuid/uuid"
 	"github.com/hashicorp/go-multierror"
+	"github.com/lib/pq"
 	"github.com/mistifyio/mistify-operator-admin/db"
 )
 
+// Hypervisor states describe where a hypervisor is in its lifecycle
+const (
+	// HypervisorStateRegistered is for a hypervisor not yet running guests
+	HypervisorStateRegistered = "registered"
+	// HypervisorStateActive is for a hypervisor running guests
+	HypervisorStateActive = "active"
+	// HypervisorStateMaintenance is for a hypervisor temporarily out of service
+	HypervisorStateMaintenance = "maintenance"
+	// HypervisorStateDraining is for a hypervisor whose guests are being moved
+	// off of it
+	HypervisorStateDraining = "draining"
+	// HypervisorStateDecommissioned is for a hypervisor permanently out of
+	// service
+	HypervisorStateDecommissioned = "decommissioned"
+)
+
+// hypervisorTransitions lists the states each hypervisor state may move to
+var hypervisorTransitions = map[string][]string{
+	HypervisorStateRegistered:     {HypervisorStateActive, HypervisorStateDecommissioned},
+	HypervisorStateActive:         {HypervisorStateMaintenance, HypervisorStateDraining},
+	HypervisorStateMaintenance:    {HypervisorStateActive, HypervisorStateDraining, HypervisorStateDecommissioned},
+	HypervisorStateDraining:       {HypervisorStateActive, HypervisorStateMaintenance, HypervisorStateDecommissioned},
+	HypervisorStateDecommissioned: {},
+}
+
 type (
 	// Hypervisor describes a machine where guests will be running
 	Hypervisor struct {
-		ID       string            `json:"id"`
-		MAC      net.HardwareAddr  `json:"mac"`
-		IP       net.IP            `json:"ip"`
-		Metadata map[string]string `json:"metadata"`
-		IPRanges []*IPRange        `json:"-"`
+		ID               string                 `json:"id"`
+		MAC              net.HardwareAddr       `json:"mac"`
+		IP               net.IP                 `json:"ip"`
+		State            string                 `json:"state"`
+		CPU              int                    `json:"cpu"`    // Number of Cores
+		Memory           int                    `json:"memory"` // Size in MB
+		Disk             int                    `json:"disk"`   // Size in MB
+		CPUOvercommit    float64                `json:"cpu_overcommit"`
+		MemoryOvercommit float64                `json:"memory_overcommit"`
+		DiskOvercommit   float64                `json:"disk_overcommit"`
+		Metadata         map[string]string      `json:"metadata"`
+		LastSeen         time.Time              `json:"last_seen"`
+		AgentFacts       map[string]string      `json:"agent_facts"`
+		Status           string                 `json:"status"`
+		RackID           string                 `json:"rack"`
+		Config           ConfigOverrides        `json:"config"`
+		IPRanges         []*IPRange             `json:"-"`
+		Interfaces       []*HypervisorInterface `json:"-"`
 	}
 
 	// hypervisorData is a middle-man for JSON and database (un)marshalling
 	hypervisorData struct {
-		ID       string            `json:"id"`
-		MAC      string            `json:"mac"`
-		IP       string            `json:"ip"`
-		Metadata map[string]string `json:"metadata"`
+		ID               string            `json:"id"`
+		MAC              string            `json:"mac"`
+		IP               string            `json:"ip"`
+		State            string            `json:"state"`
+		CPU              int               `json:"cpu"`
+		Memory           int               `json:"memory"`
+		Disk             int               `json:"disk"`
+		CPUOvercommit    float64           `json:"cpu_overcommit"`
+		MemoryOvercommit float64           `json:"memory_overcommit"`
+		DiskOvercommit   float64           `json:"disk_overcommit"`
+		Metadata         map[string]string `json:"metadata"`
+		LastSeen         *time.Time        `json:"last_seen"`
+		AgentFacts       map[string]string `json:"agent_facts"`
+		Status           string            `json:"status"`
+		RackID           string            `json:"rack"`
+		Config           ConfigOverrides   `json:"config"`
 	}
 )
 
@@ -50,18 +105,76 @@ func (hypervisor *Hypervisor) importData(data *hypervisorData) error {
 	hypervisor.ID = data.ID
 	hypervisor.MAC = mac
 	hypervisor.IP = net.ParseIP(data.IP)
+	hypervisor.State = data.State
+	hypervisor.CPU = data.CPU
+	hypervisor.Memory = data.Memory
+	hypervisor.Disk = data.Disk
+	hypervisor.CPUOvercommit = data.CPUOvercommit
+	hypervisor.MemoryOvercommit = data.MemoryOvercommit
+	hypervisor.DiskOvercommit = data.DiskOvercommit
 	hypervisor.Metadata = data.Metadata
+	hypervisor.LastSeen = time.Time{}
+	if data.LastSeen != nil {
+		hypervisor.LastSeen = *data.LastSeen
+	}
+	hypervisor.AgentFacts = data.AgentFacts
+	hypervisor.Status = data.Status
+	hypervisor.RackID = data.RackID
+	hypervisor.Config = data.Config
 	return nil
 }
 
 // exportData marshals the hypervisor object into the middle-man structure
 func (hypervisor *Hypervisor) exportData() *hypervisorData {
+	var lastSeen *time.Time
+	if !hypervisor.LastSeen.IsZero() {
+		lastSeen = &hypervisor.LastSeen
+	}
+	agentFacts := hypervisor.AgentFacts
+	if agentFacts == nil {
+		agentFacts = make(map[string]string)
+	}
 	return &hypervisorData{
-		ID:       hypervisor.ID,
-		MAC:      fmtString(hypervisor.MAC),
-		IP:       fmtString(hypervisor.IP),
-		Metadata: hypervisor.Metadata,
+		ID:               hypervisor.ID,
+		MAC:              fmtString(hypervisor.MAC),
+		IP:               fmtString(hypervisor.IP),
+		State:            hypervisor.state(),
+		CPU:              hypervisor.CPU,
+		Memory:           hypervisor.Memory,
+		Disk:             hypervisor.Disk,
+		CPUOvercommit:    overcommit(hypervisor.CPUOvercommit),
+		MemoryOvercommit: overcommit(hypervisor.MemoryOvercommit),
+		DiskOvercommit:   overcommit(hypervisor.DiskOvercommit),
+		Metadata:         hypervisor.Metadata,
+		LastSeen:         lastSeen,
+		AgentFacts:       agentFacts,
+		Status:           hypervisor.Status,
+		RackID:           hypervisor.RackID,
+		Config:           hypervisor.Config,
+	}
+}
+
+// state returns the hypervisor's state, defaulting to registered
+func (hypervisor *Hypervisor) state() string {
+	if hypervisor.State == "" {
+		return HypervisorStateRegistered
 	}
+	return hypervisor.State
+}
+
+// ValidHypervisorState checks whether a state is a known hypervisor state
+func ValidHypervisorState(state string) bool {
+	_, ok := hypervisorTransitions[state]
+	return ok
+}
+
+// overcommit returns an overcommit ratio, treating an unset ratio of 0 as no
+// overcommit
+func overcommit(ratio float64) float64 {
+	if ratio == 0 {
+		return 1
+	}
+	return ratio
 }
 
 // UnmarshalJSON unmarshals JSON into a hypervisor
@@ -96,13 +209,27 @@ func (hypervisor *Hypervisor) Validate() error {
 	if hypervisor.IP == nil {
 		result = multierror.Append(result, ErrNoIP)
 	}
+	if !ValidHypervisorState(hypervisor.state()) {
+		result = multierror.Append(result, ErrBadHypervisorState)
+	}
+	if hypervisor.CPU < 0 || hypervisor.Memory < 0 || hypervisor.Disk < 0 {
+		result = multierror.Append(result, ErrBadCapacity)
+	}
+	if hypervisor.CPUOvercommit < 0 || hypervisor.MemoryOvercommit < 0 || hypervisor.DiskOvercommit < 0 {
+		result = multierror.Append(result, ErrBadOvercommit)
+	}
+	if hypervisor.RackID != "" && uuid.Parse(hypervisor.RackID) == nil {
+		result = multierror.Append(result, ErrBadRackID)
+	}
 	if hypervisor.Metadata == nil {
 		result = multierror.Append(result, ErrNilMetadata)
 	}
 	return result.ErrorOrNil()
 }
 
-// Save persists a hypervisor to the database
+// Save persists a hypervisor to the database. The state of an existing
+// hypervisor is left as is; it only changes through Transition. The last seen
+// time and agent facts only change through Heartbeat.
 func (hypervisor *Hypervisor) Save() error {
 	if err := hypervisor.Validate(); err != nil {
 		return err
@@ -111,25 +238,38 @@ func (hypervisor *Hypervisor) Save() error {
 	if err != nil {
 		return err
 	}
+	return locationNotFoundError(hypervisorConflictError(hypervisor.save(d), hypervisor))
+}
+
+// save upserts the hypervisor, either directly or as part of a transaction
+func (hypervisor *Hypervisor) save(e execer) error {
 	// Writable CTE for an Upsert
 	// See: http://stackoverflow.com/a/8702291
 	// And: http://dba.stackexchange.com/a/78535
 	sql := `
-	WITH new_values (hypervisor_id, mac, ip, metadata) as (
-		VALUES ($1::uuid, $2::macaddr, $3::inet, $4::json)
+	WITH new_values (hypervisor_id, mac, ip, state, cpu, memory, disk, cpu_overcommit, memory_overcommit, disk_overcommit, metadata, rack_id, config) as (
+		VALUES ($1::uuid, $2::macaddr, $3::inet, $4, $5::integer, $6::integer, $7::integer, $8::double precision, $9::double precision, $10::double precision, $11::json, $12::uuid, $13::json)
 	),
 	upsert as (
 		UPDATE hypervisors h SET
 			mac = nv.mac,
 			ip = nv.ip,
-			metadata = nv.metadata
+			cpu = nv.cpu,
+			memory = nv.memory,
+			disk = nv.disk,
+			cpu_overcommit = nv.cpu_overcommit,
+			memory_overcommit = nv.memory_overcommit,
+			disk_overcommit = nv.disk_overcommit,
+			metadata = nv.metadata,
+			rack_id = nv.rack_id,
+			config = nv.config
 		FROM new_values nv
 		WHERE h.hypervisor_id = nv.hypervisor_id
 		RETURNING h.hypervisor_id
 	)
 	INSERT INTO hypervisors
-		(hypervisor_id, mac, ip, metadata)
-	SELECT hypervisor_id, mac, ip, metadata
+		(hypervisor_id, mac, ip, state, cpu, memory, disk, cpu_overcommit, memory_overcommit, disk_overcommit, metadata, rack_id, config)
+	SELECT hypervisor_id, mac, ip, state, cpu, memory, disk, cpu_overcommit, memory_overcommit, disk_overcommit, metadata, rack_id, config
 	FROM new_values nv
 	WHERE NOT EXISTS (SELECT 1 FROM upsert u WHERE nv.hypervisor_id = u.hypervisor_id)
     `
@@ -138,11 +278,24 @@ func (hypervisor *Hypervisor) Save() error {
 	if err != nil {
 		return err
 	}
-	_, err = d.Exec(sql,
+	config, err := json.Marshal(data.Config)
+	if err != nil {
+		return err
+	}
+	_, err = e.Exec(sql,
 		data.ID,
 		data.MAC,
 		data.IP,
+		data.State,
+		data.CPU,
+		data.Memory,
+		data.Disk,
+		data.CPUOvercommit,
+		data.MemoryOvercommit,
+		data.DiskOvercommit,
 		string(metadata),
+		nullString(data.RackID),
+		string(config),
 	)
 	return err
 }
@@ -165,7 +318,7 @@ func (hypervisor *Hypervisor) Load() error {
 		return err
 	}
 	sql := `
-	SELECT hypervisor_id, mac, ip, metadata
+	SELECT hypervisor_id, mac, ip, state, cpu, memory, disk, cpu_overcommit, memory_overcommit, disk_overcommit, metadata, last_seen, agent_facts, rack_id, config
 	FROM hypervisors
 	WHERE hypervisor_id = $1
 	`
@@ -183,13 +336,26 @@ func (hypervisor *Hypervisor) Load() error {
 
 // fromRows unmarshals a database query result row into the hypervisor object
 func (hypervisor *Hypervisor) fromRows(rows *sql.Rows) error {
-	var metadata string
+	var metadata, agentFacts, config string
+	var lastSeen pq.NullTime
+	var rackID sql.NullString
 	data := &hypervisorData{}
 	err := rows.Scan(
 		&data.ID,
 		&data.MAC,
 		&data.IP,
+		&data.State,
+		&data.CPU,
+		&data.Memory,
+		&data.Disk,
+		&data.CPUOvercommit,
+		&data.MemoryOvercommit,
+		&data.DiskOvercommit,
 		&metadata,
+		&lastSeen,
+		&agentFacts,
+		&rackID,
+		&config,
 	)
 	if err != nil {
 		return err
@@ -197,14 +363,25 @@ func (hypervisor *Hypervisor) fromRows(rows *sql.Rows) error {
 	if err := json.Unmarshal([]byte(metadata), &data.Metadata); err != nil {
 		return err
 	}
+	if err := json.Unmarshal([]byte(agentFacts), &data.AgentFacts); err != nil {
+		return err
+	}
+	if err := json.Unmarshal([]byte(config), &data.Config); err != nil {
+		return err
+	}
+	if lastSeen.Valid {
+		data.LastSeen = &lastSeen.Time
+	}
+	data.RackID = rackID.String
 	return hypervisor.importData(data)
 }
 
-// Decode unmarshals JSON into the flavor object
+// Decode unmarshals JSON into the hypervisor object
 func (hypervisor *Hypervisor) Decode(data io.Reader) error {
 	if err := json.NewDecoder(data).Decode(hypervisor); err != nil {
 		return err
 	}
+	hypervisor.Config.clean()
 	if hypervisor.Metadata == nil {
 		hypervisor.Metadata = make(map[string]string)
 	} else {
@@ -217,6 +394,44 @@ func (hypervisor *Hypervisor) Decode(data io.Reader) error {
 	return nil
 }
 
+// Transition moves the hypervisor to a new state, if the move is allowed from
+// its current state. The move is made only if the stored state has not changed
+// since the hypervisor was loaded.
+func (hypervisor *Hypervisor) Transition(state string) error {
+	if !ValidHypervisorState(state) {
+		return ErrBadHypervisorState
+	}
+	allowed := false
+	for _, next := range hypervisorTransitions[hypervisor.state()] {
+		allowed = allowed || next == state
+	}
+	if !allowed {
+		return ErrIllegalTransition
+	}
+	d, err := db.Connect(nil)
+	if err != nil {
+		return err
+	}
+	sql := `
+	UPDATE hypervisors
+	SET state = $2
+	WHERE hypervisor_id = $1 AND state = $3
+	`
+	result, err := d.Exec(sql, hypervisor.ID, state, hypervisor.state())
+	if err != nil {
+		return err
+	}
+	count, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return ErrIllegalTransition
+	}
+	hypervisor.State = state
+	return nil
+}
+
 // LoadIPRanges retrieves all of the ipranges related to the hypervisor
 func (hypervisor *Hypervisor) LoadIPRanges() error {
 	ipranges, err := IPRangesByHypervisor(hypervisor)
@@ -253,6 +468,17 @@ func (hypervisor *Hypervisor) SetIPRanges(ipranges []*IPRange) error {
 	return hypervisor.LoadIPRanges()
 }
 
+// LoadInterfaces retrieves the interfaces of the hypervisor beyond its
+// management interface from the database
+func (hypervisor *Hypervisor) LoadInterfaces() error {
+	ifaces, err := HypervisorInterfacesByHypervisor(hypervisor)
+	if err != nil {
+		return err
+	}
+	hypervisor.Interfaces = ifaces
+	return nil
+}
+
 // NewID generates a new uuid ID
 func (hypervisor *Hypervisor) NewID() string {
 	hypervisor.ID = uuid.New()
@@ -279,6 +505,18 @@ func FetchHypervisor(id string) (*Hypervisor, error) {
 	return hypervisor, nil
 }
 
+// FetchHypervisorByMAC retrieves a hypervisor object from the database by MAC
+func FetchHypervisorByMAC(mac net.HardwareAddr) (*Hypervisor, error) {
+	hypervisors, err := HypervisorsByMAC(mac)
+	if err != nil {
+		return nil, err
+	}
+	if len(hypervisors) == 0 {
+		return nil, sql.ErrNoRows
+	}
+	return hypervisors[0], nil
+}
+
 // ListHypervisors retrieves an array of all hypervisor objects from the
 // database
 func ListHypervisors() ([]*Hypervisor, error) {
@@ -287,7 +525,7 @@ func ListHypervisors() ([]*Hypervisor, error) {
 		return nil, err
 	}
 	sql := `
-	SELECT hypervisor_id, mac, ip, metadata
+	SELECT hypervisor_id, mac, ip, state, cpu, memory, disk, cpu_overcommit, memory_overcommit, disk_overcommit, metadata, last_seen, agent_facts, rack_id, config
 	FROM hypervisors
 	ORDER BY hypervisor_id
 	`
@@ -309,6 +547,154 @@ func ListHypervisors() ([]*Hypervisor, error) {
 	return hypervisors, nil
 }
 
+// HypervisorFilter narrows down a search for hypervisors. Fields left unset
+// match all hypervisors. Facts maps dotted paths into the latest hardware facts
+// report, such as cpu.model, to the values they must have.
+type HypervisorFilter struct {
+	MAC          net.HardwareAddr
+	IP           net.IP
+	State        string
+	RackID       string
+	ZoneID       string
+	DatacenterID string
+	Facts        map[string]string
+}
+
+// FilterHypervisors retrieves an array of hypervisors matching every condition
+// set in the filter from the database. Zones and datacenters match the
+// hypervisors in their racks, and MACs match the interfaces of hypervisors as
+// well as their management MACs.
+func FilterHypervisors(filter *HypervisorFilter) ([]*Hypervisor, error) {
+	d, err := db.Connect(nil)
+	if err != nil {
+		return nil, err
+	}
+	var conditions []string
+	var args []interface{}
+	where := func(condition string, arg interface{}) {
+		args = append(args, arg)
+		conditions = append(conditions, fmt.Sprintf(condition, len(args)))
+	}
+	if filter.MAC != nil {
+		where("(h.mac = $%[1]d::macaddr OR h.hypervisor_id IN (SELECT hypervisor_id FROM hypervisor_interfaces WHERE mac = $%[1]d::macaddr))", fmtString(filter.MAC))
+	}
+	if filter.IP != nil {
+		where("h.ip = $%d::inet", fmtString(filter.IP))
+	}
+	if filter.State != "" {
+		where("h.state = $%d", filter.State)
+	}
+	if filter.RackID != "" {
+		where("h.rack_id = $%d", filter.RackID)
+	}
+	if filter.ZoneID != "" {
+		where("r.zone_id = $%d", filter.ZoneID)
+	}
+	if filter.DatacenterID != "" {
+		where("z.datacenter_id = $%d", filter.DatacenterID)
+	}
+	paths := make([]string, 0, len(filter.Facts))
+	for path := range filter.Facts {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		parts, err := ParseFactPath(path)
+		if err != nil {
+			return nil, err
+		}
+		placeholders := make([]string, len(parts))
+		for i, part := range parts {
+			args = append(args, part)
+			placeholders[i] = fmt.Sprintf("$%d", len(args))
+		}
+		where(`h.hypervisor_id IN (
+		SELECT f.hypervisor_id
+		FROM hypervisor_facts f
+		WHERE f.version = (SELECT MAX(version) FROM hypervisor_facts WHERE hypervisor_id = f.hypervisor_id)
+		AND f.facts #>> ARRAY[`+strings.Join(placeholders, ", ")+`]::text[] = $%d
+	)`, filter.Facts[path])
+	}
+	sql := `
+	SELECT h.hypervisor_id, h.mac, h.ip, h.state, h.cpu, h.memory, h.disk, h.cpu_overcommit, h.memory_overcommit, h.disk_overcommit, h.metadata, h.last_seen, h.agent_facts, h.rack_id, h.config
+	FROM hypervisors h
+	LEFT JOIN racks r ON h.rack_id = r.rack_id
+	LEFT JOIN zones z ON r.zone_id = z.zone_id
+	`
+	if len(conditions) > 0 {
+		sql += "WHERE " + strings.Join(conditions, " AND ") + "\n"
+	}
+	sql += "ORDER BY h.hypervisor_id asc"
+	rows, err := d.Query(sql, args...)
+	if err != nil {
+		return nil, err
+	}
+	hypervisors, err := hypervisorsFromRows(rows)
+	if err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return hypervisors, nil
+}
+
+// HypervisorsByIP retrieves an array of hypervisors with an address from the
+// database
+func HypervisorsByIP(ip net.IP) ([]*Hypervisor, error) {
+	d, err := db.Connect(nil)
+	if err != nil {
+		return nil, err
+	}
+	sql := `
+	SELECT hypervisor_id, mac, ip, state, cpu, memory, disk, cpu_overcommit, memory_overcommit, disk_overcommit, metadata, last_seen, agent_facts, rack_id, config
+	FROM hypervisors
+	WHERE ip = $1::inet
+	ORDER BY hypervisor_id asc
+	`
+	rows, err := d.Query(sql, fmtString(ip))
+	if err != nil {
+		return nil, err
+	}
+	hypervisors, err := hypervisorsFromRows(rows)
+	if err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return hypervisors, nil
+}
+
+// HypervisorsByMAC retrieves an array of hypervisors with a MAC, either as
+// their management MAC or as the MAC of one of their interfaces, from the
+// database
+func HypervisorsByMAC(mac net.HardwareAddr) ([]*Hypervisor, error) {
+	d, err := db.Connect(nil)
+	if err != nil {
+		return nil, err
+	}
+	sql := `
+	SELECT hypervisor_id, mac, ip, state, cpu, memory, disk, cpu_overcommit, memory_overcommit, disk_overcommit, metadata, last_seen, agent_facts, rack_id, config
+	FROM hypervisors
+	WHERE mac = $1::macaddr
+	OR hypervisor_id IN (SELECT hypervisor_id FROM hypervisor_interfaces WHERE mac = $1::macaddr)
+	ORDER BY hypervisor_id asc
+	`
+	rows, err := d.Query(sql, fmtString(mac))
+	if err != nil {
+		return nil, err
+	}
+	hypervisors, err := hypervisorsFromRows(rows)
+	if err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return hypervisors, nil
+}
+
 // HypervisorsByIPRange retrieves an array of hypervisors associated with an
 // iprange from the database
 func HypervisorsByIPRange(iprange *IPRange) ([]*Hypervisor, error) {
@@ -317,7 +703,7 @@ func HypervisorsByIPRange(iprange *IPRange) ([]*Hypervisor, error) {
 		return nil, err
 	}
 	sql := `
-	SELECT h.hypervisor_id, h.mac, h.ip, h.metadata
+	SELECT h.hypervisor_id, h.mac, h.ip, h.state, h.cpu, h.memory, h.disk, h.cpu_overcommit, h.memory_overcommit, h.disk_overcommit, h.metadata, h.last_seen, h.agent_facts, h.rack_id, h.config
 	FROM hypervisors h
 	JOIN hypervisors_ipranges hi ON h.hypervisor_id = hi.hypervisor_id
 	WHERE hi.iprange_id = $1
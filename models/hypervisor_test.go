@@ -1,6 +1,7 @@
 package models_test
 
 import (
+	"database/sql"
 	"net"
 	"strings"
 	"testing"
@@ -15,6 +16,13 @@ var hypervisorJSON = `{
 	"id": "ebf3bfd5-9915-4ed1-bcb3-117bb48b155d",
 	"mac": "01:23:45:67:89:ab",
 	"ip": "192.168.1.20",
+	"state": "registered",
+	"cpu": 16,
+	"memory": 65536,
+	"disk": 1048576,
+	"cpu_overcommit": 4,
+	"memory_overcommit": 1.5,
+	"disk_overcommit": 1,
 	"metadata": {
 		"foo": "bar"
 	}
@@ -31,6 +39,13 @@ func checkHypervisorValues(t *testing.T, hypervisor *models.Hypervisor) {
 	h.Equals(t, "ebf3bfd5-9915-4ed1-bcb3-117bb48b155d", hypervisor.ID)
 	h.Equals(t, "01:23:45:67:89:ab", hypervisor.MAC.String())
 	h.Equals(t, "192.168.1.20", hypervisor.IP.String())
+	h.Equals(t, models.HypervisorStateRegistered, hypervisor.State)
+	h.Equals(t, 16, hypervisor.CPU)
+	h.Equals(t, 65536, hypervisor.Memory)
+	h.Equals(t, 1048576, hypervisor.Disk)
+	h.Equals(t, 4.0, hypervisor.CPUOvercommit)
+	h.Equals(t, 1.5, hypervisor.MemoryOvercommit)
+	h.Equals(t, 1.0, hypervisor.DiskOvercommit)
 	h.Equals(t, map[string]string{"foo": "bar"}, hypervisor.Metadata)
 }
 
@@ -88,6 +103,18 @@ func TestHypervisorValidate(t *testing.T) {
 	h.Assert(t, errDoesNotContain(models.ErrNilMetadata, err), "did not expect ErrNilMetadata")
 
 	h.Ok(t, err)
+
+	hypervisor.Memory = -1
+	h.Assert(t, errContains(models.ErrBadCapacity, hypervisor.Validate()), "expected ErrBadCapacity")
+	hypervisor.Memory = 0
+	hypervisor.DiskOvercommit = -1
+	h.Assert(t, errContains(models.ErrBadOvercommit, hypervisor.Validate()), "expected ErrBadOvercommit")
+	hypervisor.DiskOvercommit = 0
+	hypervisor.State = "foobar"
+	h.Assert(t, errContains(models.ErrBadHypervisorState, hypervisor.Validate()), "expected ErrBadHypervisorState")
+	hypervisor.State = ""
+	hypervisor.RackID = "foobar"
+	h.Assert(t, errContains(models.ErrBadRackID, hypervisor.Validate()), "expected ErrBadRackID")
 }
 
 func TestHypervisorMarshalJSON(t *testing.T) {
@@ -177,3 +204,284 @@ func TestHypervisorIPRangeRelations(t *testing.T) {
 	h.Ok(t, iprange.Delete())
 	h.Ok(t, hypervisor.Delete())
 }
+
+func TestHypervisorsByIP(t *testing.T) {
+	hypervisor := createHypervisor(t)
+	h.Ok(t, hypervisor.Save())
+
+	hypervisors, err := models.HypervisorsByIP(hypervisor.IP)
+	h.Ok(t, err)
+	h.Equals(t, 1, len(hypervisors))
+
+	hypervisors, err = models.HypervisorsByIP(net.ParseIP("10.0.0.1"))
+	h.Ok(t, err)
+	h.Equals(t, 0, len(hypervisors))
+
+	h.Ok(t, hypervisor.Delete())
+}
+
+func TestHypervisorDHCPConfigFormat(t *testing.T) {
+	hypervisor := createHypervisor(t)
+	_, err := hypervisor.DHCPConfig("foobar", 0)
+	h.Equals(t, models.ErrBadDHCPFormat, err)
+	_, err = hypervisor.DHCPConfig(models.DHCPFormatISC, 5)
+	h.Equals(t, models.ErrBadIPFamily, err)
+}
+
+func TestHypervisorDHCPConfig(t *testing.T) {
+	// Prep
+	hypervisor := createHypervisor(t)
+	h.Ok(t, hypervisor.Save())
+	iprange := createIPRange(t)
+	h.Ok(t, iprange.Save())
+	h.Ok(t, hypervisor.AddIPRange(iprange))
+	lease := models.NewIPAllocation()
+	lease.IP = net.ParseIP("192.168.1.30")
+	lease.MAC, _ = net.ParseMAC("01:23:45:67:89:cd")
+	h.Ok(t, iprange.Allocate(lease))
+
+	config, err := hypervisor.DHCPConfig(models.DHCPFormatDnsmasq, 0)
+	h.Ok(t, err)
+	dnsmasq := string(config)
+	for _, line := range []string{
+		"dhcp-range=set:" + iprange.ID + ",192.168.1.10,192.168.1.19,255.255.255.0",
+		"dhcp-range=set:" + iprange.ID + ",192.168.1.21,192.168.1.29,255.255.255.0",
+		"dhcp-range=set:" + iprange.ID + ",192.168.1.31,192.168.1.254,255.255.255.0",
+		"dhcp-option=tag:" + iprange.ID + ",option:router,192.168.1.1",
+		"dhcp-option=tag:" + iprange.ID + ",option:dns-server,192.168.1.2",
+		"dhcp-option=tag:" + iprange.ID + ",option:classless-static-route,10.0.0.0/8,192.168.1.1,0.0.0.0/0,192.168.1.1",
+		"dhcp-host=01:23:45:67:89:cd,192.168.1.30",
+	} {
+		h.Assert(t, strings.Contains(dnsmasq, line+"\n"), "missing "+line)
+	}
+
+	config, err = hypervisor.DHCPConfig(models.DHCPFormatISC, 4)
+	h.Ok(t, err)
+	isc := string(config)
+	for _, line := range []string{
+		"subnet 192.168.1.0 netmask 255.255.255.0 {",
+		"\trange 192.168.1.10 192.168.1.19;",
+		"\toption routers 192.168.1.1;",
+		"\toption interface-mtu 1500;",
+		"\toption rfc3442-classless-static-routes 8, 10, 192, 168, 1, 1, 0, 192, 168, 1, 1;",
+		"\t\tfixed-address 192.168.1.30;",
+	} {
+		h.Assert(t, strings.Contains(isc, line+"\n"), "missing "+line)
+	}
+
+	config, err = hypervisor.DHCPConfig(models.DHCPFormatISC, 6)
+	h.Ok(t, err)
+	h.Assert(t, !strings.Contains(string(config), "subnet"), "unexpected IPv4 subnet")
+
+	// Cleanup
+	h.Ok(t, iprange.Release(lease.IP))
+	h.Ok(t, hypervisor.RemoveIPRange(iprange))
+	h.Ok(t, iprange.Delete())
+	h.Ok(t, hypervisor.Delete())
+}
+
+func TestHypervisorDHCPConfigMixedFamilies(t *testing.T) {
+	// Prep
+	hypervisor := createHypervisor(t)
+	h.Ok(t, hypervisor.Save())
+	network := createNetwork(t)
+	network.DNSServers = append(network.DNSServers, net.ParseIP("2001:db8::53"))
+	_, destination, err := net.ParseCIDR("2001:db8:1::/48")
+	h.Ok(t, err)
+	network.Routes = append(network.Routes, &models.Route{
+		Destination: destination,
+		Gateway:     net.ParseIP("2001:db8::1"),
+	})
+	h.Ok(t, network.Save())
+	iprange := createIPRange(t)
+	iprange.DNSServers = nil
+	iprange.Routes = nil
+	h.Ok(t, iprange.Save())
+	h.Ok(t, iprange.SetNetwork(network))
+	h.Ok(t, hypervisor.AddIPRange(iprange))
+	iprange6 := createIPv6Range(t, models.IPRangeModeDHCPv6)
+	iprange6.NewID()
+	iprange6.DNSServers = nil
+	h.Ok(t, iprange6.Save())
+	h.Ok(t, iprange6.SetNetwork(network))
+	h.Ok(t, hypervisor.AddIPRange(iprange6))
+
+	// Each iprange only inherits the settings of its own IP version
+	config, err := hypervisor.DHCPConfig(models.DHCPFormatDnsmasq, 0)
+	h.Ok(t, err)
+	dnsmasq := string(config)
+	for _, line := range []string{
+		"dhcp-option=tag:" + iprange.ID + ",option:dns-server,192.168.1.2,192.168.1.3",
+		"dhcp-option=tag:" + iprange.ID + ",option:classless-static-route,10.0.0.0/8,192.168.1.1,0.0.0.0/0,192.168.1.1",
+		"dhcp-option=tag:" + iprange6.ID + ",option6:dns-server,[2001:db8::53]",
+	} {
+		h.Assert(t, strings.Contains(dnsmasq, line+"\n"), "missing "+line)
+	}
+	h.Assert(t, !strings.Contains(dnsmasq, "[192.168.1.2]"), "unexpected IPv4 DNS server for IPv6 iprange")
+	h.Assert(t, !strings.Contains(dnsmasq, "2001:db8:1::/48"), "unexpected IPv6 route")
+
+	config, err = hypervisor.DHCPConfig(models.DHCPFormatISC, 4)
+	h.Ok(t, err)
+	isc := string(config)
+	for _, line := range []string{
+		"\toption domain-name-servers 192.168.1.2, 192.168.1.3;",
+		"\toption rfc3442-classless-static-routes 8, 10, 192, 168, 1, 1, 0, 192, 168, 1, 1;",
+	} {
+		h.Assert(t, strings.Contains(isc, line+"\n"), "missing "+line)
+	}
+	h.Assert(t, !strings.Contains(isc, "2001:db8"), "unexpected IPv6 settings for IPv4 iprange")
+
+	config, err = hypervisor.DHCPConfig(models.DHCPFormatISC, 6)
+	h.Ok(t, err)
+	isc = string(config)
+	h.Assert(t, strings.Contains(isc, "\toption dhcp6.name-servers 2001:db8::53;\n"), "missing IPv6 DNS server")
+	h.Assert(t, !strings.Contains(isc, "192.168.1"), "unexpected IPv4 settings for IPv6 iprange")
+
+	// Cleanup
+	h.Ok(t, hypervisor.RemoveIPRange(iprange6))
+	h.Ok(t, hypervisor.RemoveIPRange(iprange))
+	h.Ok(t, iprange6.RemoveNetwork(network))
+	h.Ok(t, iprange.RemoveNetwork(network))
+	h.Ok(t, iprange6.Delete())
+	h.Ok(t, iprange.Delete())
+	h.Ok(t, network.Delete())
+	h.Ok(t, hypervisor.Delete())
+}
+
+func TestHypervisorTransition(t *testing.T) {
+	// Prep
+	hypervisor := createHypervisor(t)
+	h.Ok(t, hypervisor.Save())
+
+	h.Equals(t, models.ErrBadHypervisorState, hypervisor.Transition("foobar"))
+	h.Equals(t, models.ErrIllegalTransition, hypervisor.Transition(models.HypervisorStateDraining))
+	h.Ok(t, hypervisor.Transition(models.HypervisorStateActive))
+	h.Ok(t, hypervisor.Transition(models.HypervisorStateMaintenance))
+
+	// A stale copy cannot make a move its stored state does not allow
+	stale := createHypervisor(t)
+	stale.State = models.HypervisorStateActive
+	h.Equals(t, models.ErrIllegalTransition, stale.Transition(models.HypervisorStateDraining))
+
+	// Saving leaves the state alone
+	hypervisor.State = models.HypervisorStateRegistered
+	h.Ok(t, hypervisor.Save())
+	h.Ok(t, hypervisor.Load())
+	h.Equals(t, models.HypervisorStateMaintenance, hypervisor.State)
+
+	hypervisors, err := models.FilterHypervisors(&models.HypervisorFilter{State: models.HypervisorStateMaintenance})
+	h.Ok(t, err)
+	h.Equals(t, 1, len(hypervisors))
+	hypervisors, err = models.FilterHypervisors(&models.HypervisorFilter{State: models.HypervisorStateActive})
+	h.Ok(t, err)
+	h.Equals(t, 0, len(hypervisors))
+
+	h.Ok(t, hypervisor.Transition(models.HypervisorStateDecommissioned))
+	h.Equals(t, models.ErrIllegalTransition, hypervisor.Transition(models.HypervisorStateActive))
+
+	// Cleanup
+	h.Ok(t, hypervisor.Delete())
+}
+
+func TestHypervisorsByMAC(t *testing.T) {
+	hypervisor := createHypervisor(t)
+	h.Ok(t, hypervisor.Save())
+
+	hypervisors, err := models.HypervisorsByMAC(hypervisor.MAC)
+	h.Ok(t, err)
+	h.Equals(t, 1, len(hypervisors))
+
+	hypervisor2, err := models.FetchHypervisorByMAC(hypervisor.MAC)
+	h.Ok(t, err)
+	checkHypervisorValues(t, hypervisor2)
+
+	mac, _ := net.ParseMAC("01:23:45:67:89:cd")
+	hypervisors, err = models.HypervisorsByMAC(mac)
+	h.Ok(t, err)
+	h.Equals(t, 0, len(hypervisors))
+	_, err = models.FetchHypervisorByMAC(mac)
+	h.Equals(t, sql.ErrNoRows, err)
+
+	h.Ok(t, hypervisor.Delete())
+}
+
+func TestHypervisorUniqueAddresses(t *testing.T) {
+	// Prep
+	hypervisor := createHypervisor(t)
+	h.Ok(t, hypervisor.Save())
+
+	// Same MAC
+	other := createHypervisor(t)
+	other.NewID()
+	other.IP = net.ParseIP("192.168.1.21")
+	err := other.Save()
+	conflict, ok := err.(*models.HypervisorConflictError)
+	h.Assert(t, ok, "expected HypervisorConflictError")
+	h.Equals(t, "mac", conflict.Field)
+	h.Equals(t, hypervisor.ID, conflict.ID)
+
+	// Same IP
+	other.MAC, _ = net.ParseMAC("01:23:45:67:89:cd")
+	other.IP = hypervisor.IP
+	err = other.Save()
+	conflict, ok = err.(*models.HypervisorConflictError)
+	h.Assert(t, ok, "expected HypervisorConflictError")
+	h.Equals(t, "ip", conflict.Field)
+	h.Equals(t, hypervisor.ID, conflict.ID)
+
+	// Different addresses
+	other.IP = net.ParseIP("192.168.1.21")
+	h.Ok(t, other.Save())
+
+	// Cleanup
+	h.Ok(t, other.Delete())
+	h.Ok(t, hypervisor.Delete())
+}
+
+func TestFilterHypervisors(t *testing.T) {
+	// Prep
+	datacenter := createDatacenter(t)
+	h.Ok(t, datacenter.Save())
+	zone := createZone(t)
+	h.Ok(t, zone.Save())
+	rack := createRack(t)
+	h.Ok(t, rack.Save())
+
+	hypervisor := createHypervisor(t)
+	hypervisor.RackID = "7b9e2d1c-3a4f-4b5e-8c6d-9e0f1a2b3c4e"
+	h.Equals(t, models.ErrRackNotFound, hypervisor.Save())
+	hypervisor.RackID = rack.ID
+	h.Ok(t, hypervisor.Save())
+	h.Ok(t, hypervisor.Load())
+	h.Equals(t, rack.ID, hypervisor.RackID)
+
+	other := createHypervisor(t)
+	other.NewID()
+	other.MAC, _ = net.ParseMAC("01:23:45:67:89:cd")
+	other.IP = net.ParseIP("192.168.1.21")
+	h.Ok(t, other.Save())
+
+	hypervisors, err := models.FilterHypervisors(&models.HypervisorFilter{})
+	h.Ok(t, err)
+	h.Equals(t, 2, len(hypervisors))
+
+	hypervisors, err = models.FilterHypervisors(&models.HypervisorFilter{ZoneID: zone.ID})
+	h.Ok(t, err)
+	h.Equals(t, 1, len(hypervisors))
+	h.Equals(t, hypervisor.ID, hypervisors[0].ID)
+
+	hypervisors, err = models.FilterHypervisors(&models.HypervisorFilter{DatacenterID: datacenter.ID, State: models.HypervisorStateRegistered})
+	h.Ok(t, err)
+	h.Equals(t, 1, len(hypervisors))
+
+	hypervisors, err = models.FilterHypervisors(&models.HypervisorFilter{RackID: rack.ID, IP: other.IP})
+	h.Ok(t, err)
+	h.Equals(t, 0, len(hypervisors))
+
+	// Cleanup
+	h.Ok(t, other.Delete())
+	h.Ok(t, hypervisor.Delete())
+	h.Ok(t, rack.Delete())
+	h.Ok(t, zone.Delete())
+	h.Ok(t, datacenter.Delete())
+}
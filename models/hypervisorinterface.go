@@ -0,0 +1,376 @@
+package models
+
+import (
+	"database/sql"
+	"encoding/json"
+	"io"
+	"net"
+
+	"code.google.com/p/go-uuid/uuid"
+	"github.com/hashicorp/go-multierror"
+	"github.com/mistifyio/mistify-operator-admin/db"
+)
+
+type (
+	// HypervisorInterface describes a network interface of a hypervisor beyond
+	// its management interface, which is given by the hypervisor's own MAC and
+	// IP. Interfaces enslaved in a bond name the bond they are a member of.
+	HypervisorInterface struct {
+		ID           string            `json:"id"`
+		HypervisorID string            `json:"hypervisor"`
+		Name         string            `json:"name"`
+		MAC          net.HardwareAddr  `json:"mac"`
+		IP           net.IP            `json:"ip"`
+		Bond         string            `json:"bond"`
+		NetworkID    string            `json:"network"`
+		Metadata     map[string]string `json:"metadata"`
+	}
+
+	// hypervisorInterfaceData is a middle-man for JSON and database
+	// (un)marshalling
+	hypervisorInterfaceData struct {
+		ID           string            `json:"id"`
+		HypervisorID string            `json:"hypervisor"`
+		Name         string            `json:"name"`
+		MAC          string            `json:"mac"`
+		IP           string            `json:"ip"`
+		Bond         string            `json:"bond"`
+		NetworkID    string            `json:"network"`
+		Metadata     map[string]string `json:"metadata"`
+	}
+)
+
+// importData unmarshals the middle-man structure into an interface object
+func (iface *HypervisorInterface) importData(data *hypervisorInterfaceData) {
+	iface.ID = data.ID
+	iface.HypervisorID = data.HypervisorID
+	iface.Name = data.Name
+	iface.MAC, _ = net.ParseMAC(data.MAC)
+	iface.IP = net.ParseIP(data.IP)
+	iface.Bond = data.Bond
+	iface.NetworkID = data.NetworkID
+	iface.Metadata = data.Metadata
+}
+
+// exportData marshals the interface object into the middle-man structure
+func (iface *HypervisorInterface) exportData() *hypervisorInterfaceData {
+	var ip string
+	if iface.IP != nil {
+		ip = iface.IP.String()
+	}
+	return &hypervisorInterfaceData{
+		ID:           iface.ID,
+		HypervisorID: iface.HypervisorID,
+		Name:         iface.Name,
+		MAC:          fmtString(iface.MAC),
+		IP:           ip,
+		Bond:         iface.Bond,
+		NetworkID:    iface.NetworkID,
+		Metadata:     iface.Metadata,
+	}
+}
+
+// UnmarshalJSON unmarshals JSON into an interface object
+func (iface *HypervisorInterface) UnmarshalJSON(b []byte) error {
+	data := &hypervisorInterfaceData{}
+	if err := json.Unmarshal(b, data); err != nil {
+		return err
+	}
+	if data.IP != "" && net.ParseIP(data.IP) == nil {
+		return ErrBadIP
+	}
+	if data.MAC != "" {
+		if _, err := net.ParseMAC(data.MAC); err != nil {
+			return ErrBadMAC
+		}
+	}
+	iface.importData(data)
+	return nil
+}
+
+// MarshalJSON marshals an interface object into JSON
+func (iface HypervisorInterface) MarshalJSON() ([]byte, error) {
+	return json.Marshal(iface.exportData())
+}
+
+// Validate ensures the interface properties are set correctly
+func (iface *HypervisorInterface) Validate() error {
+	var results *multierror.Error
+	if iface.ID == "" {
+		results = multierror.Append(results, ErrNoID)
+	}
+	if uuid.Parse(iface.ID) == nil {
+		results = multierror.Append(results, ErrBadID)
+	}
+	if uuid.Parse(iface.HypervisorID) == nil {
+		results = multierror.Append(results, ErrBadHypervisorID)
+	}
+	if iface.Name == "" {
+		results = multierror.Append(results, ErrNoName)
+	}
+	if iface.MAC == nil {
+		results = multierror.Append(results, ErrNoMAC)
+	}
+	if iface.Bond != "" && iface.Bond == iface.Name {
+		results = multierror.Append(results, ErrBadBond)
+	}
+	if iface.NetworkID != "" && uuid.Parse(iface.NetworkID) == nil {
+		results = multierror.Append(results, ErrBadNetworkID)
+	}
+	if iface.Metadata == nil {
+		results = multierror.Append(results, ErrNilMetadata)
+	}
+	return results.ErrorOrNil()
+}
+
+// Save persists an interface to the database. A bond must name another
+// interface of the hypervisor without the bonds forming a cycle. Its MAC may
+// not be used by another hypervisor or its interfaces, but may be shared within
+// the hypervisor, such as by a bond and its members.
+func (iface *HypervisorInterface) Save() error {
+	if err := iface.Validate(); err != nil {
+		return err
+	}
+	d, err := db.Connect(nil)
+	if err != nil {
+		return err
+	}
+	// Lock the hypervisor row to serialize changes to its interfaces
+	txn, err := d.Begin()
+	if err != nil {
+		return err
+	}
+	lockSQL := `
+	SELECT 1
+	FROM hypervisors
+	WHERE hypervisor_id = $1
+	FOR UPDATE
+	`
+	if _, err := txn.Exec(lockSQL, iface.HypervisorID); err != nil {
+		_ = txn.Rollback()
+		return err
+	}
+	if err := iface.checkBond(txn); err != nil {
+		_ = txn.Rollback()
+		return err
+	}
+
+	// Writable CTE for an Upsert
+	// See: http://stackoverflow.com/a/8702291
+	// And: http://dba.stackexchange.com/a/78535
+	sql := `
+	WITH new_values (interface_id, hypervisor_id, name, mac, ip, bond, network_id, metadata) as (
+		VALUES ($1::uuid, $2::uuid, $3, $4::macaddr, $5::inet, $6, $7::uuid, $8::json)
+	),
+	upsert as (
+		UPDATE hypervisor_interfaces hi SET
+			name = nv.name,
+			mac = nv.mac,
+			ip = nv.ip,
+			bond = nv.bond,
+			network_id = nv.network_id,
+			metadata = nv.metadata
+		FROM new_values nv
+		WHERE hi.interface_id = nv.interface_id
+		RETURNING hi.interface_id
+	)
+	INSERT INTO hypervisor_interfaces
+		(interface_id, hypervisor_id, name, mac, ip, bond, network_id, metadata)
+	SELECT interface_id, hypervisor_id, name, mac, ip, bond, network_id, metadata
+	FROM new_values nv
+	WHERE NOT EXISTS (SELECT 1 FROM upsert u WHERE nv.interface_id = u.interface_id)
+	`
+	data := iface.exportData()
+	metadata, err := json.Marshal(data.Metadata)
+	if err != nil {
+		return err
+	}
+	_, err = txn.Exec(sql,
+		data.ID,
+		data.HypervisorID,
+		data.Name,
+		data.MAC,
+		nullString(data.IP),
+		data.Bond,
+		nullString(data.NetworkID),
+		string(metadata),
+	)
+	if err != nil {
+		_ = txn.Rollback()
+		return interfaceConflictError(err, iface)
+	}
+	return txn.Commit()
+}
+
+// checkBond ensures the bond names another interface of the hypervisor, and
+// that following the bonds from the interface never leads back to it
+func (iface *HypervisorInterface) checkBond(q querier) error {
+	if iface.Bond == "" {
+		return nil
+	}
+	siblings, err := interfacesByHypervisor(q, iface.HypervisorID)
+	if err != nil {
+		return err
+	}
+	bonds := make(map[string]string, len(siblings)+1)
+	for _, sibling := range siblings {
+		if sibling.ID != iface.ID {
+			bonds[sibling.Name] = sibling.Bond
+		}
+	}
+	if _, ok := bonds[iface.Bond]; !ok {
+		return ErrBondNotFound
+	}
+	bonds[iface.Name] = iface.Bond
+	seen := map[string]bool{iface.Name: true}
+	for name := iface.Bond; name != ""; name = bonds[name] {
+		if seen[name] {
+			return ErrBondCycle
+		}
+		seen[name] = true
+	}
+	return nil
+}
+
+// Delete removes an interface from the database
+func (iface *HypervisorInterface) Delete() error {
+	d, err := db.Connect(nil)
+	if err != nil {
+		return err
+	}
+	sql := "DELETE FROM hypervisor_interfaces WHERE interface_id = $1"
+	_, err = d.Exec(sql, iface.ID)
+	return err
+}
+
+// Load retrieves an interface from the database
+func (iface *HypervisorInterface) Load() error {
+	d, err := db.Connect(nil)
+	if err != nil {
+		return err
+	}
+	sql := `
+	SELECT interface_id, hypervisor_id, name, mac, ip, bond, network_id, metadata
+	FROM hypervisor_interfaces
+	WHERE interface_id = $1
+	`
+	rows, err := d.Query(sql, iface.ID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	rows.Next()
+	if err := iface.fromRows(rows); err != nil {
+		return err
+	}
+	return rows.Err()
+}
+
+// fromRows unmarshals a database query result row into the interface object
+func (iface *HypervisorInterface) fromRows(rows *sql.Rows) error {
+	var metadata string
+	var ip, networkID sql.NullString
+	data := &hypervisorInterfaceData{}
+	err := rows.Scan(
+		&data.ID,
+		&data.HypervisorID,
+		&data.Name,
+		&data.MAC,
+		&ip,
+		&data.Bond,
+		&networkID,
+		&metadata,
+	)
+	if err != nil {
+		return err
+	}
+	data.IP = ip.String
+	data.NetworkID = networkID.String
+	if err := json.Unmarshal([]byte(metadata), &data.Metadata); err != nil {
+		return err
+	}
+	iface.importData(data)
+	return nil
+}
+
+// Decode unmarshals JSON into the interface object
+func (iface *HypervisorInterface) Decode(data io.Reader) error {
+	if err := json.NewDecoder(data).Decode(iface); err != nil {
+		return err
+	}
+	if iface.Metadata == nil {
+		iface.Metadata = make(map[string]string)
+	} else {
+		for key, value := range iface.Metadata {
+			if value == "" {
+				delete(iface.Metadata, key)
+			}
+		}
+	}
+	return nil
+}
+
+// NewID generates a new uuid ID
+func (iface *HypervisorInterface) NewID() string {
+	iface.ID = uuid.New()
+	return iface.ID
+}
+
+// NewHypervisorInterface creates and initializes a new interface object
+func NewHypervisorInterface() *HypervisorInterface {
+	iface := &HypervisorInterface{
+		ID:       uuid.New(),
+		Metadata: make(map[string]string),
+	}
+	return iface
+}
+
+// FetchHypervisorInterface retrieves an interface object from the database by
+// ID
+func FetchHypervisorInterface(id string) (*HypervisorInterface, error) {
+	iface := &HypervisorInterface{
+		ID: id,
+	}
+	if err := iface.Load(); err != nil {
+		return nil, err
+	}
+	return iface, nil
+}
+
+// HypervisorInterfacesByHypervisor retrieves an array of interfaces belonging
+// to a hypervisor from the database
+func HypervisorInterfacesByHypervisor(hypervisor *Hypervisor) ([]*HypervisorInterface, error) {
+	d, err := db.Connect(nil)
+	if err != nil {
+		return nil, err
+	}
+	return interfacesByHypervisor(d, hypervisor.ID)
+}
+
+// interfacesByHypervisor retrieves the interfaces of a hypervisor, either
+// directly or as part of a transaction
+func interfacesByHypervisor(q querier, hypervisorID string) ([]*HypervisorInterface, error) {
+	sql := `
+	SELECT interface_id, hypervisor_id, name, mac, ip, bond, network_id, metadata
+	FROM hypervisor_interfaces
+	WHERE hypervisor_id = $1
+	ORDER BY name asc
+	`
+	rows, err := q.Query(sql, hypervisorID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	ifaces := make([]*HypervisorInterface, 0, 1)
+	for rows.Next() {
+		iface := &HypervisorInterface{}
+		if err := iface.fromRows(rows); err != nil {
+			return nil, err
+		}
+		ifaces = append(ifaces, iface)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return ifaces, nil
+}
@@ -0,0 +1,187 @@
+package models_test
+
+import (
+	"net"
+	"strings"
+	"testing"
+
+	"code.google.com/p/go-uuid/uuid"
+
+	h "github.com/bakins/test-helpers"
+	"github.com/mistifyio/mistify-operator-admin/models"
+)
+
+var hypervisorInterfaceJSON = `{
+	"id": "9c1e7a3b-2d4f-4e8a-b6c5-0f1a2b3c4d5e",
+	"hypervisor": "ebf3bfd5-9915-4ed1-bcb3-117bb48b155d",
+	"name": "eth1",
+	"mac": "01:23:45:67:89:ef",
+	"ip": "10.0.1.20",
+	"bond": "bond0",
+	"network": "ebf3bfd5-9915-4ed1-bcb3-117bb48b155d",
+	"metadata": {
+		"foo": "bar"
+	}
+}`
+
+func createHypervisorInterface(t *testing.T) *models.HypervisorInterface {
+	r := strings.NewReader(hypervisorInterfaceJSON)
+	iface := &models.HypervisorInterface{}
+	h.Ok(t, iface.Decode(r))
+	return iface
+}
+
+func checkHypervisorInterfaceValues(t *testing.T, iface *models.HypervisorInterface) {
+	h.Equals(t, "9c1e7a3b-2d4f-4e8a-b6c5-0f1a2b3c4d5e", iface.ID)
+	h.Equals(t, "ebf3bfd5-9915-4ed1-bcb3-117bb48b155d", iface.HypervisorID)
+	h.Equals(t, "eth1", iface.Name)
+	h.Equals(t, "01:23:45:67:89:ef", iface.MAC.String())
+	h.Equals(t, "10.0.1.20", iface.IP.String())
+	h.Equals(t, "bond0", iface.Bond)
+	h.Equals(t, "ebf3bfd5-9915-4ed1-bcb3-117bb48b155d", iface.NetworkID)
+	h.Equals(t, map[string]string{"foo": "bar"}, iface.Metadata)
+}
+
+func TestNewHypervisorInterface(t *testing.T) {
+	iface := models.NewHypervisorInterface()
+	h.Assert(t, uuid.Parse(iface.ID) != nil, "missing uuid ID")
+	h.Assert(t, iface.Metadata != nil, "uninitialized metadata")
+}
+
+func TestHypervisorInterfaceDecode(t *testing.T) {
+	iface := createHypervisorInterface(t)
+	checkHypervisorInterfaceValues(t, iface)
+
+	iface = &models.HypervisorInterface{}
+	h.Equals(t, models.ErrBadMAC, iface.Decode(strings.NewReader(`{"mac": "foobar"}`)))
+	h.Equals(t, models.ErrBadIP, iface.Decode(strings.NewReader(`{"ip": "foobar"}`)))
+}
+
+func TestHypervisorInterfaceValidate(t *testing.T) {
+	iface := &models.HypervisorInterface{}
+	var err error
+
+	err = iface.Validate()
+	h.Assert(t, errContains(models.ErrNoID, err), "expected ErrNoID")
+	h.Assert(t, errContains(models.ErrBadID, err), "expected ErrBadID")
+	h.Assert(t, errContains(models.ErrBadHypervisorID, err), "expected ErrBadHypervisorID")
+	h.Assert(t, errContains(models.ErrNoName, err), "expected ErrNoName")
+	h.Assert(t, errContains(models.ErrNoMAC, err), "expected ErrNoMAC")
+	h.Assert(t, errContains(models.ErrNilMetadata, err), "expected ErrNilMetadata")
+	h.Assert(t, errDoesNotContain(models.ErrBadNetworkID, err), "unexpected ErrBadNetworkID")
+
+	iface = createHypervisorInterface(t)
+	h.Ok(t, iface.Validate())
+
+	iface.IP = nil
+	iface.NetworkID = ""
+	iface.Bond = ""
+	h.Ok(t, iface.Validate())
+
+	iface.Bond = iface.Name
+	h.Assert(t, errContains(models.ErrBadBond, iface.Validate()), "expected ErrBadBond")
+
+	iface.Bond = ""
+	iface.NetworkID = "foobar"
+	h.Assert(t, errContains(models.ErrBadNetworkID, iface.Validate()), "expected ErrBadNetworkID")
+}
+
+func TestHypervisorInterfaceSave(t *testing.T) {
+	// Prep
+	hypervisor := createHypervisor(t)
+	h.Ok(t, hypervisor.Save())
+	network := createNetwork(t)
+	h.Ok(t, network.Save())
+
+	// The bond shares the MAC of its member
+	bond := models.NewHypervisorInterface()
+	bond.HypervisorID = hypervisor.ID
+	bond.Name = "bond0"
+	bond.MAC, _ = net.ParseMAC("01:23:45:67:89:ef")
+	h.Ok(t, bond.Save())
+
+	iface := createHypervisorInterface(t)
+	h.Ok(t, iface.Save())
+
+	iface2, err := models.FetchHypervisorInterface(iface.ID)
+	h.Ok(t, err)
+	checkHypervisorInterfaceValues(t, iface2)
+
+	// Load
+	h.Ok(t, hypervisor.LoadInterfaces())
+	h.Equals(t, 2, len(hypervisor.Interfaces))
+
+	// Found by MAC
+	hypervisors, err := models.HypervisorsByMAC(iface.MAC)
+	h.Ok(t, err)
+	h.Equals(t, 1, len(hypervisors))
+	h.Equals(t, hypervisor.ID, hypervisors[0].ID)
+
+	// Same name
+	other := createHypervisorInterface(t)
+	other.NewID()
+	other.MAC, _ = net.ParseMAC("01:23:45:67:89:cd")
+	h.Equals(t, models.ErrInterfaceNameInUse, other.Save())
+
+	// Bond that is not an interface of the hypervisor
+	other.Name = "eth2"
+	other.Bond = "bond1"
+	h.Equals(t, models.ErrBondNotFound, other.Save())
+
+	// Bonds forming a cycle
+	bond.Bond = iface.Name
+	h.Equals(t, models.ErrBondCycle, bond.Save())
+	bond.Bond = ""
+
+	// A bonded management interface shares the hypervisor's MAC
+	management := models.NewHypervisorInterface()
+	management.HypervisorID = hypervisor.ID
+	management.Name = "bond1"
+	management.MAC = hypervisor.MAC
+	h.Ok(t, management.Save())
+	h.Ok(t, hypervisor.Save())
+
+	// Same MAC as an interface of another hypervisor
+	hypervisor2 := createHypervisor(t)
+	hypervisor2.NewID()
+	hypervisor2.MAC, _ = net.ParseMAC("01:23:45:67:89:cd")
+	hypervisor2.IP = net.ParseIP("192.168.1.21")
+	h.Ok(t, hypervisor2.Save())
+	other.HypervisorID = hypervisor2.ID
+	other.Bond = ""
+	other.MAC = iface.MAC
+	err = other.Save()
+	conflict, ok := err.(*models.HypervisorConflictError)
+	h.Assert(t, ok, "expected HypervisorConflictError")
+	h.Equals(t, "mac", conflict.Field)
+	h.Equals(t, hypervisor.ID, conflict.ID)
+
+	// Same MAC as another hypervisor
+	other.MAC = hypervisor.MAC
+	err = other.Save()
+	conflict, ok = err.(*models.HypervisorConflictError)
+	h.Assert(t, ok, "expected HypervisorConflictError")
+	h.Equals(t, "mac", conflict.Field)
+	h.Equals(t, hypervisor.ID, conflict.ID)
+
+	// A hypervisor with the MAC of another hypervisor's interface
+	hypervisor2.MAC = iface.MAC
+	err = hypervisor2.Save()
+	conflict, ok = err.(*models.HypervisorConflictError)
+	h.Assert(t, ok, "expected HypervisorConflictError")
+	h.Equals(t, "mac", conflict.Field)
+	h.Equals(t, hypervisor.ID, conflict.ID)
+
+	// Unknown network
+	other.MAC, _ = net.ParseMAC("01:23:45:67:89:cf")
+	other.NetworkID = uuid.New()
+	h.Equals(t, models.ErrNetworkNotFound, other.Save())
+
+	// Cleanup
+	h.Ok(t, management.Delete())
+	h.Ok(t, iface.Delete())
+	h.Ok(t, bond.Delete())
+	h.Ok(t, network.Delete())
+	h.Ok(t, hypervisor2.Delete())
+	h.Ok(t, hypervisor.Delete())
+}
@@ -0,0 +1,376 @@
+package models
+
+import (
+	"database/sql"
+	"encoding/json"
+	"io"
+	"net"
+	"time"
+
+	"code.google.com/p/go-uuid/uuid"
+	"github.com/hashicorp/go-multierror"
+	"github.com/mistifyio/mistify-operator-admin/db"
+)
+
+type (
+	// IPAllocation describes a single address handed out from an iprange
+	IPAllocation struct {
+		IPRangeID    string            `json:"iprange"`
+		IP           net.IP            `json:"ip"`
+		MAC          net.HardwareAddr  `json:"mac"`
+		HypervisorID string            `json:"hypervisor"`
+		Metadata     map[string]string `json:"metadata"`
+		Created      time.Time         `json:"created"`
+	}
+
+	// ipAllocationData is a middle-man for JSON and database (un)marshalling
+	ipAllocationData struct {
+		IPRangeID    string            `json:"iprange"`
+		IP           string            `json:"ip"`
+		MAC          string            `json:"mac"`
+		HypervisorID string            `json:"hypervisor"`
+		Metadata     map[string]string `json:"metadata"`
+		Created      time.Time         `json:"created"`
+	}
+)
+
+// importData unmarshals the middle-man structure into an allocation object
+func (allocation *IPAllocation) importData(data *ipAllocationData) {
+	allocation.IPRangeID = data.IPRangeID
+	allocation.IP = net.ParseIP(data.IP)
+	allocation.MAC, _ = net.ParseMAC(data.MAC)
+	allocation.HypervisorID = data.HypervisorID
+	allocation.Metadata = data.Metadata
+	allocation.Created = data.Created
+}
+
+// exportData marshals the allocation object into the middle-man structure
+func (allocation *IPAllocation) exportData() *ipAllocationData {
+	return &ipAllocationData{
+		IPRangeID:    allocation.IPRangeID,
+		IP:           fmtString(allocation.IP),
+		MAC:          fmtString(allocation.MAC),
+		HypervisorID: allocation.HypervisorID,
+		Metadata:     allocation.Metadata,
+		Created:      allocation.Created,
+	}
+}
+
+// UnmarshalJSON unmarshals JSON into an allocation object
+func (allocation *IPAllocation) UnmarshalJSON(b []byte) error {
+	data := &ipAllocationData{}
+	if err := json.Unmarshal(b, data); err != nil {
+		return err
+	}
+	if data.IP != "" && net.ParseIP(data.IP) == nil {
+		return ErrBadIP
+	}
+	if data.MAC != "" {
+		if _, err := net.ParseMAC(data.MAC); err != nil {
+			return ErrBadMAC
+		}
+	}
+	allocation.importData(data)
+	return nil
+}
+
+// MarshalJSON marshals an allocation object into JSON
+func (allocation IPAllocation) MarshalJSON() ([]byte, error) {
+	return json.Marshal(allocation.exportData())
+}
+
+// Validate ensures the allocation properties are set correctly
+func (allocation *IPAllocation) Validate() error {
+	var results *multierror.Error
+	if allocation.IPRangeID == "" {
+		results = multierror.Append(results, ErrNoID)
+	}
+	if uuid.Parse(allocation.IPRangeID) == nil {
+		results = multierror.Append(results, ErrBadID)
+	}
+	if allocation.IP == nil {
+		results = multierror.Append(results, ErrNoIP)
+	}
+	if allocation.HypervisorID != "" && uuid.Parse(allocation.HypervisorID) == nil {
+		results = multierror.Append(results, ErrBadHypervisorID)
+	}
+	if allocation.Metadata == nil {
+		results = multierror.Append(results, ErrNilMetadata)
+	}
+	return results.ErrorOrNil()
+}
+
+// Decode unmarshals JSON into the allocation object. An empty body is allowed
+// and results in a request for the next free address. Setting a MAC makes the
+// allocation a fixed DHCP lease.
+func (allocation *IPAllocation) Decode(data io.Reader) error {
+	if err := json.NewDecoder(data).Decode(allocation); err != nil && err != io.EOF {
+		return err
+	}
+	if allocation.Metadata == nil {
+		allocation.Metadata = make(map[string]string)
+	} else {
+		for key, value := range allocation.Metadata {
+			if value == "" {
+				delete(allocation.Metadata, key)
+			}
+		}
+	}
+	return nil
+}
+
+// Delete releases the allocated address back to the iprange
+func (allocation *IPAllocation) Delete() error {
+	d, err := db.Connect(nil)
+	if err != nil {
+		return err
+	}
+	sql := "DELETE FROM iprange_allocations WHERE iprange_id = $1 AND ip = $2"
+	result, err := d.Exec(sql, allocation.IPRangeID, fmtString(allocation.IP))
+	if err != nil {
+		return err
+	}
+	count, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return ErrIPNotAllocated
+	}
+	return nil
+}
+
+// fromRows unmarshals a database query result row into the allocation object
+func (allocation *IPAllocation) fromRows(rows *sql.Rows) error {
+	var metadata string
+	var mac, hypervisorID sql.NullString
+	data := &ipAllocationData{}
+	err := rows.Scan(
+		&data.IPRangeID,
+		&data.IP,
+		&mac,
+		&hypervisorID,
+		&metadata,
+		&data.Created,
+	)
+	if err != nil {
+		return err
+	}
+	data.MAC = mac.String
+	data.HypervisorID = hypervisorID.String
+	if err := json.Unmarshal([]byte(metadata), &data.Metadata); err != nil {
+		return err
+	}
+	allocation.importData(data)
+	return nil
+}
+
+// NewIPAllocation creates and initializes a new allocation object
+func NewIPAllocation() *IPAllocation {
+	allocation := &IPAllocation{
+		Metadata: make(map[string]string),
+	}
+	return allocation
+}
+
+// allocateIP reserves an address in an iprange. If the allocation has no IP
+// set, the lowest free address in the pool is used. The iprange row is locked
+// for the duration of the transaction so that concurrent allocations, from
+// this or any other API instance, are serialized.
+func allocateIP(allocation *IPAllocation) error {
+	d, err := db.Connect(nil)
+	if err != nil {
+		return err
+	}
+	txn, err := d.Begin()
+	if err != nil {
+		return err
+	}
+
+	var startIP, endIP string
+	lockSQL := `
+	SELECT start_ip, end_ip
+	FROM ipranges
+	WHERE iprange_id = $1
+	FOR UPDATE
+	`
+	if err := txn.QueryRow(lockSQL, allocation.IPRangeID).Scan(&startIP, &endIP); err != nil {
+		_ = txn.Rollback()
+		return err
+	}
+	start, end := net.ParseIP(startIP), net.ParseIP(endIP)
+
+	blocked, err := blockedIntervals(txn, allocation.IPRangeID, startIP, endIP)
+	if err != nil {
+		_ = txn.Rollback()
+		return err
+	}
+
+	if allocation.IP == nil {
+		if allocation.IP = nextFreeIP(start, end, blocked); allocation.IP == nil {
+			_ = txn.Rollback()
+			return ErrIPRangeExhausted
+		}
+	} else {
+		if !ipInRange(allocation.IP, start, end) {
+			_ = txn.Rollback()
+			return ErrIPNotInPool
+		}
+		for _, interval := range blocked {
+			if ipInRange(allocation.IP, interval.start, interval.end) {
+				_ = txn.Rollback()
+				if interval.reserved {
+					return ErrIPReserved
+				}
+				return ErrIPAllocated
+			}
+		}
+	}
+
+	if err := allocation.Validate(); err != nil {
+		_ = txn.Rollback()
+		return err
+	}
+
+	if allocation.HypervisorID != "" {
+		if err := checkAllocationHypervisor(txn, allocation); err != nil {
+			_ = txn.Rollback()
+			return err
+		}
+	}
+
+	metadata, err := json.Marshal(allocation.Metadata)
+	if err != nil {
+		_ = txn.Rollback()
+		return err
+	}
+	insertSQL := `
+	INSERT INTO iprange_allocations
+		(iprange_id, ip, mac, hypervisor_id, metadata)
+	VALUES ($1::uuid, $2::inet, $3::macaddr, $4::uuid, $5::json)
+	RETURNING created
+	`
+	var mac, hypervisorID interface{}
+	if allocation.MAC != nil {
+		mac = allocation.MAC.String()
+	}
+	if allocation.HypervisorID != "" {
+		hypervisorID = allocation.HypervisorID
+	}
+	err = txn.QueryRow(insertSQL,
+		allocation.IPRangeID,
+		fmtString(allocation.IP),
+		mac,
+		hypervisorID,
+		string(metadata),
+	).Scan(&allocation.Created)
+	if err != nil {
+		_ = txn.Rollback()
+		return err
+	}
+	return txn.Commit()
+}
+
+// checkAllocationHypervisor ensures the hypervisor an allocation is made on
+// behalf of exists and is related to the iprange
+func checkAllocationHypervisor(q querier, allocation *IPAllocation) error {
+	sql := `
+	SELECT
+		EXISTS (SELECT 1 FROM hypervisors WHERE hypervisor_id = $1),
+		EXISTS (SELECT 1 FROM hypervisors_ipranges WHERE hypervisor_id = $1 AND iprange_id = $2)
+	`
+	rows, err := q.Query(sql, allocation.HypervisorID, allocation.IPRangeID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	var found, related bool
+	if rows.Next() {
+		if err := rows.Scan(&found, &related); err != nil {
+			return err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	if !found {
+		return ErrHypervisorNotFound
+	}
+	if !related {
+		return ErrHypervisorNotInIPRange
+	}
+	return nil
+}
+
+// blockedIntervals retrieves the addresses of an iprange that are unavailable
+// for allocation, sorted by starting address. Allocated addresses are blocked,
+// as are reserved addresses: exclusions and the addresses of hypervisors.
+func blockedIntervals(q querier, iprangeID, startIP, endIP string) (ipIntervals, error) {
+	sql := `
+	SELECT ip, ip, false
+	FROM iprange_allocations
+	WHERE iprange_id = $1
+	UNION ALL
+	SELECT ip, ip, true
+	FROM hypervisors
+	WHERE ip BETWEEN $2::inet AND $3::inet
+	UNION ALL
+	SELECT start_ip, end_ip, true
+	FROM iprange_exclusions
+	WHERE iprange_id = $1
+	ORDER BY 1 asc
+	`
+	rows, err := q.Query(sql, iprangeID, startIP, endIP)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	blocked := make(ipIntervals, 0, 1)
+	for rows.Next() {
+		var start, end string
+		var reserved bool
+		if err := rows.Scan(&start, &end, &reserved); err != nil {
+			return nil, err
+		}
+		blocked = append(blocked, ipInterval{
+			start:    net.ParseIP(start),
+			end:      net.ParseIP(end),
+			reserved: reserved,
+		})
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return blocked, nil
+}
+
+// IPAllocationsByIPRange retrieves an array of allocations belonging to an
+// iprange from the database
+func IPAllocationsByIPRange(iprange *IPRange) ([]*IPAllocation, error) {
+	d, err := db.Connect(nil)
+	if err != nil {
+		return nil, err
+	}
+	sql := `
+	SELECT iprange_id, ip, mac, hypervisor_id, metadata, created
+	FROM iprange_allocations
+	WHERE iprange_id = $1
+	ORDER BY ip asc
+	`
+	rows, err := d.Query(sql, iprange.ID)
+	if err != nil {
+		return nil, err
+	}
+	allocations := make([]*IPAllocation, 0, 1)
+	for rows.Next() {
+		allocation := &IPAllocation{}
+		if err := allocation.fromRows(rows); err != nil {
+			return nil, err
+		}
+		allocations = append(allocations, allocation)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return allocations, nil
+}
@@ -0,0 +1,134 @@
+package models_test
+
+import (
+	"net"
+	"strings"
+	"testing"
+
+	"code.google.com/p/go-uuid/uuid"
+	h "github.com/bakins/test-helpers"
+	"github.com/mistifyio/mistify-operator-admin/models"
+)
+
+var ipAllocationJSON = `{
+	"ip": "192.168.1.20",
+	"metadata": {
+		"foo": "bar"
+	}
+}`
+
+func createIPAllocation(t *testing.T) *models.IPAllocation {
+	r := strings.NewReader(ipAllocationJSON)
+	allocation := &models.IPAllocation{}
+	h.Ok(t, allocation.Decode(r))
+	return allocation
+}
+
+func TestNewIPAllocation(t *testing.T) {
+	allocation := models.NewIPAllocation()
+	h.Assert(t, allocation.Metadata != nil, "uninitialized metadata")
+}
+
+func TestIPAllocationDecode(t *testing.T) {
+	allocation := createIPAllocation(t)
+	h.Equals(t, "192.168.1.20", allocation.IP.String())
+	h.Equals(t, map[string]string{"foo": "bar"}, allocation.Metadata)
+
+	allocation = &models.IPAllocation{}
+	h.Ok(t, allocation.Decode(strings.NewReader("")))
+	h.Assert(t, allocation.IP == nil, "expected nil IP")
+	h.Assert(t, allocation.Metadata != nil, "uninitialized metadata")
+
+	allocation = &models.IPAllocation{}
+	h.Equals(t, models.ErrBadIP, allocation.Decode(strings.NewReader(`{"ip": "foobar"}`)))
+
+	allocation = &models.IPAllocation{}
+	h.Ok(t, allocation.Decode(strings.NewReader(`{"mac": "01:23:45:67:89:ab"}`)))
+	h.Equals(t, "01:23:45:67:89:ab", allocation.MAC.String())
+
+	allocation = &models.IPAllocation{}
+	h.Equals(t, models.ErrBadMAC, allocation.Decode(strings.NewReader(`{"mac": "foobar"}`)))
+}
+
+func TestIPAllocationValidate(t *testing.T) {
+	allocation := &models.IPAllocation{}
+	var err error
+
+	err = allocation.Validate()
+	h.Assert(t, errContains(models.ErrNoID, err), "expected ErrNoID")
+	h.Assert(t, errContains(models.ErrBadID, err), "expected ErrBadID")
+	h.Assert(t, errContains(models.ErrNoIP, err), "expected ErrNoIP")
+	h.Assert(t, errContains(models.ErrNilMetadata, err), "expected ErrNilMetadata")
+
+	allocation.IPRangeID = "ebf3bfd5-9915-4ed1-bcb3-117bb48b155d"
+	err = allocation.Validate()
+	h.Assert(t, errDoesNotContain(models.ErrNoID, err), "did not expect ErrNoID")
+	h.Assert(t, errDoesNotContain(models.ErrBadID, err), "did not expect ErrBadID")
+
+	allocation.IP = net.ParseIP("192.168.1.20")
+	h.Assert(t, errDoesNotContain(models.ErrNoIP, allocation.Validate()), "did not expect ErrNoIP")
+
+	allocation.Metadata = make(map[string]string)
+	h.Ok(t, allocation.Validate())
+}
+
+func TestIPRangeAllocations(t *testing.T) {
+	// Prep
+	iprange := createIPRange(t)
+	h.Ok(t, iprange.Save())
+
+	// Allocate a requested address
+	requested := createIPAllocation(t)
+	h.Ok(t, iprange.Allocate(requested))
+	h.Equals(t, iprange.ID, requested.IPRangeID)
+
+	// Requested address is already taken
+	h.Equals(t, models.ErrIPAllocated, iprange.Allocate(createIPAllocation(t)))
+
+	// Requested address is outside of the pool
+	outside := models.NewIPAllocation()
+	outside.IP = net.ParseIP("192.168.1.2")
+	h.Equals(t, models.ErrIPNotInPool, iprange.Allocate(outside))
+
+	// Allocate the next free address
+	next := models.NewIPAllocation()
+	h.Ok(t, iprange.Allocate(next))
+	h.Equals(t, iprange.Start.String(), next.IP.String())
+
+	// Load
+	h.Ok(t, iprange.LoadAllocations())
+	h.Equals(t, 2, len(iprange.Allocations))
+
+	// The pool can not shrink past the allocations
+	iprange.Start = net.ParseIP("192.168.1.11")
+	h.Equals(t, models.ErrIPAllocated, iprange.Save())
+	iprange2, err := models.FetchIPRange(iprange.ID)
+	h.Ok(t, err)
+	h.Equals(t, "192.168.1.10", iprange2.Start.String())
+	iprange.Start = net.ParseIP("192.168.1.10")
+
+	// Release
+	h.Ok(t, iprange.Release(next.IP))
+	h.Ok(t, iprange.Release(requested.IP))
+	h.Equals(t, models.ErrIPNotAllocated, iprange.Release(requested.IP))
+	h.Ok(t, iprange.LoadAllocations())
+	h.Equals(t, 0, len(iprange.Allocations))
+
+	// On behalf of an unknown hypervisor
+	unknown := models.NewIPAllocation()
+	unknown.HypervisorID = uuid.New()
+	h.Equals(t, models.ErrHypervisorNotFound, iprange.Allocate(unknown))
+
+	// On behalf of a hypervisor not related to the iprange
+	hypervisor := createHypervisor(t)
+	h.Ok(t, hypervisor.Save())
+	unrelated := models.NewIPAllocation()
+	unrelated.HypervisorID = hypervisor.ID
+	h.Equals(t, models.ErrHypervisorNotInIPRange, iprange.Allocate(unrelated))
+	h.Ok(t, iprange.LoadAllocations())
+	h.Equals(t, 0, len(iprange.Allocations))
+
+	// Cleanup
+	h.Ok(t, hypervisor.Delete())
+	h.Ok(t, iprange.Delete())
+}
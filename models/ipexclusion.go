@@ -0,0 +1,346 @@
+package models
+
+import (
+	"database/sql"
+	"encoding/json"
+	"io"
+	"net"
+
+	"code.google.com/p/go-uuid/uuid"
+	"github.com/hashicorp/go-multierror"
+	"github.com/mistifyio/mistify-operator-admin/db"
+)
+
+type (
+	// IPExclusion describes a single address or span of addresses in an
+	// iprange's pool that must never be allocated
+	IPExclusion struct {
+		ID        string            `json:"id"`
+		IPRangeID string            `json:"iprange"`
+		Start     net.IP            `json:"start"`
+		End       net.IP            `json:"end"`
+		Metadata  map[string]string `json:"metadata"`
+	}
+
+	// ipExclusionData is a middle-man for JSON and database (un)marshalling
+	ipExclusionData struct {
+		ID        string            `json:"id"`
+		IPRangeID string            `json:"iprange"`
+		Start     string            `json:"start"`
+		End       string            `json:"end"`
+		Metadata  map[string]string `json:"metadata"`
+	}
+)
+
+// importData unmarshals the middle-man structure into an exclusion object
+func (exclusion *IPExclusion) importData(data *ipExclusionData) {
+	exclusion.ID = data.ID
+	exclusion.IPRangeID = data.IPRangeID
+	exclusion.Start = net.ParseIP(data.Start)
+	exclusion.End = net.ParseIP(data.End)
+	exclusion.Metadata = data.Metadata
+}
+
+// exportData marshals the exclusion object into the middle-man structure
+func (exclusion *IPExclusion) exportData() *ipExclusionData {
+	return &ipExclusionData{
+		ID:        exclusion.ID,
+		IPRangeID: exclusion.IPRangeID,
+		Start:     fmtString(exclusion.Start),
+		End:       fmtString(exclusion.End),
+		Metadata:  exclusion.Metadata,
+	}
+}
+
+// UnmarshalJSON unmarshals JSON into an exclusion object
+func (exclusion *IPExclusion) UnmarshalJSON(b []byte) error {
+	data := &ipExclusionData{}
+	if err := json.Unmarshal(b, data); err != nil {
+		return err
+	}
+	exclusion.importData(data)
+	return nil
+}
+
+// MarshalJSON marshals an exclusion object into JSON
+func (exclusion IPExclusion) MarshalJSON() ([]byte, error) {
+	return json.Marshal(exclusion.exportData())
+}
+
+// Validate ensures the exclusion properties are set correctly
+func (exclusion *IPExclusion) Validate() error {
+	var results *multierror.Error
+	if exclusion.ID == "" {
+		results = multierror.Append(results, ErrNoID)
+	}
+	if uuid.Parse(exclusion.ID) == nil {
+		results = multierror.Append(results, ErrBadID)
+	}
+	if uuid.Parse(exclusion.IPRangeID) == nil {
+		results = multierror.Append(results, ErrBadIPRangeID)
+	}
+	if exclusion.Start == nil {
+		results = multierror.Append(results, ErrNoStartIP)
+	}
+	if exclusion.End == nil {
+		results = multierror.Append(results, ErrNoEndIP)
+	}
+	if exclusion.Start != nil && exclusion.End != nil {
+		if !ipSameFamily(exclusion.Start, exclusion.End) {
+			results = multierror.Append(results, ErrMixedIPFamilies)
+		} else if ipCompare(exclusion.Start, exclusion.End) > 0 {
+			results = multierror.Append(results, ErrStartIPAfterEndIP)
+		}
+	}
+	if exclusion.Metadata == nil {
+		results = multierror.Append(results, ErrNilMetadata)
+	}
+	return results.ErrorOrNil()
+}
+
+// Save persists an exclusion to the database. The exclusion must lie within
+// the iprange's pool and may not overlap other exclusions or cover addresses
+// that are already allocated.
+func (exclusion *IPExclusion) Save() error {
+	if err := exclusion.Validate(); err != nil {
+		return err
+	}
+	d, err := db.Connect(nil)
+	if err != nil {
+		return err
+	}
+	// Lock the iprange row to serialize with allocations
+	txn, err := d.Begin()
+	if err != nil {
+		return err
+	}
+
+	data := exclusion.exportData()
+	var startIP, endIP string
+	lockSQL := `
+	SELECT start_ip, end_ip
+	FROM ipranges
+	WHERE iprange_id = $1
+	FOR UPDATE
+	`
+	if err := txn.QueryRow(lockSQL, data.IPRangeID).Scan(&startIP, &endIP); err != nil {
+		_ = txn.Rollback()
+		return err
+	}
+	start, end := net.ParseIP(startIP), net.ParseIP(endIP)
+	if !ipInRange(exclusion.Start, start, end) || !ipInRange(exclusion.End, start, end) {
+		_ = txn.Rollback()
+		return ErrExclusionNotInPool
+	}
+
+	conflictSQL := `
+	SELECT
+		EXISTS (
+			SELECT 1
+			FROM iprange_exclusions
+			WHERE iprange_id = $1
+			AND exclusion_id <> $2
+			AND start_ip <= $4::inet
+			AND end_ip >= $3::inet
+		),
+		EXISTS (
+			SELECT 1
+			FROM iprange_allocations
+			WHERE iprange_id = $1
+			AND ip BETWEEN $3::inet AND $4::inet
+		)
+	`
+	var overlaps, allocated bool
+	err = txn.QueryRow(conflictSQL,
+		data.IPRangeID,
+		data.ID,
+		data.Start,
+		data.End,
+	).Scan(&overlaps, &allocated)
+	if err != nil {
+		_ = txn.Rollback()
+		return err
+	}
+	if overlaps {
+		_ = txn.Rollback()
+		return ErrExclusionOverlap
+	}
+	if allocated {
+		_ = txn.Rollback()
+		return ErrIPAllocated
+	}
+
+	// Writable CTE for an Upsert
+	// See: http://stackoverflow.com/a/8702291
+	// And: http://dba.stackexchange.com/a/78535
+	sql := `
+	WITH new_values (exclusion_id, iprange_id, start_ip, end_ip, metadata) as (
+		VALUES ($1::uuid, $2::uuid, $3::inet, $4::inet, $5::json)
+	),
+	upsert as (
+		UPDATE iprange_exclusions e SET
+			iprange_id = nv.iprange_id,
+			start_ip = nv.start_ip,
+			end_ip = nv.end_ip,
+			metadata = nv.metadata
+		FROM new_values nv
+		WHERE e.exclusion_id = nv.exclusion_id
+		RETURNING e.exclusion_id
+	)
+	INSERT INTO iprange_exclusions
+		(exclusion_id, iprange_id, start_ip, end_ip, metadata)
+	SELECT exclusion_id, iprange_id, start_ip, end_ip, metadata
+	FROM new_values nv
+	WHERE NOT EXISTS (SELECT 1 FROM upsert u WHERE nv.exclusion_id = u.exclusion_id)
+	`
+	metadata, err := json.Marshal(data.Metadata)
+	if err != nil {
+		_ = txn.Rollback()
+		return err
+	}
+	_, err = txn.Exec(sql,
+		data.ID,
+		data.IPRangeID,
+		data.Start,
+		data.End,
+		string(metadata),
+	)
+	if err != nil {
+		_ = txn.Rollback()
+		return err
+	}
+	return txn.Commit()
+}
+
+// Delete removes an exclusion from the database
+func (exclusion *IPExclusion) Delete() error {
+	d, err := db.Connect(nil)
+	if err != nil {
+		return err
+	}
+	sql := "DELETE FROM iprange_exclusions WHERE exclusion_id = $1"
+	_, err = d.Exec(sql, exclusion.ID)
+	return err
+}
+
+// Load retrieves an exclusion from the database
+func (exclusion *IPExclusion) Load() error {
+	d, err := db.Connect(nil)
+	if err != nil {
+		return err
+	}
+	sql := `
+	SELECT exclusion_id, iprange_id, start_ip, end_ip, metadata
+	FROM iprange_exclusions
+	WHERE exclusion_id = $1
+	`
+	rows, err := d.Query(sql, exclusion.ID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	rows.Next()
+	if err := exclusion.fromRows(rows); err != nil {
+		return err
+	}
+	return rows.Err()
+}
+
+// fromRows unmarshals a database query result row into the exclusion object
+func (exclusion *IPExclusion) fromRows(rows *sql.Rows) error {
+	var metadata string
+	data := &ipExclusionData{}
+	err := rows.Scan(
+		&data.ID,
+		&data.IPRangeID,
+		&data.Start,
+		&data.End,
+		&metadata,
+	)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal([]byte(metadata), &data.Metadata); err != nil {
+		return err
+	}
+	exclusion.importData(data)
+	return nil
+}
+
+// Decode unmarshals JSON into the exclusion object. A single address may be
+// excluded by setting only the start.
+func (exclusion *IPExclusion) Decode(data io.Reader) error {
+	if err := json.NewDecoder(data).Decode(exclusion); err != nil {
+		return err
+	}
+	if exclusion.End == nil {
+		exclusion.End = exclusion.Start
+	}
+	if exclusion.Metadata == nil {
+		exclusion.Metadata = make(map[string]string)
+	} else {
+		for key, value := range exclusion.Metadata {
+			if value == "" {
+				delete(exclusion.Metadata, key)
+			}
+		}
+	}
+	return nil
+}
+
+// NewID generates a new uuid ID
+func (exclusion *IPExclusion) NewID() string {
+	exclusion.ID = uuid.New()
+	return exclusion.ID
+}
+
+// NewIPExclusion creates and initializes a new exclusion object
+func NewIPExclusion() *IPExclusion {
+	exclusion := &IPExclusion{
+		ID:       uuid.New(),
+		Metadata: make(map[string]string),
+	}
+	return exclusion
+}
+
+// FetchIPExclusion retrieves an exclusion object from the database by ID
+func FetchIPExclusion(id string) (*IPExclusion, error) {
+	exclusion := &IPExclusion{
+		ID: id,
+	}
+	if err := exclusion.Load(); err != nil {
+		return nil, err
+	}
+	return exclusion, nil
+}
+
+// IPExclusionsByIPRange retrieves an array of exclusions belonging to an
+// iprange from the database
+func IPExclusionsByIPRange(iprange *IPRange) ([]*IPExclusion, error) {
+	d, err := db.Connect(nil)
+	if err != nil {
+		return nil, err
+	}
+	sql := `
+	SELECT exclusion_id, iprange_id, start_ip, end_ip, metadata
+	FROM iprange_exclusions
+	WHERE iprange_id = $1
+	ORDER BY start_ip asc
+	`
+	rows, err := d.Query(sql, iprange.ID)
+	if err != nil {
+		return nil, err
+	}
+	exclusions := make([]*IPExclusion, 0, 1)
+	for rows.Next() {
+		exclusion := &IPExclusion{}
+		if err := exclusion.fromRows(rows); err != nil {
+			return nil, err
+		}
+		exclusions = append(exclusions, exclusion)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return exclusions, nil
+}
@@ -0,0 +1,130 @@
+package models_test
+
+import (
+	"net"
+	"strings"
+	"testing"
+
+	"code.google.com/p/go-uuid/uuid"
+
+	h "github.com/bakins/test-helpers"
+	"github.com/mistifyio/mistify-operator-admin/models"
+)
+
+var ipExclusionJSON = `{
+	"id": "3f2b6c8e-5a1d-4c7e-9b0f-2d8e6a4c1b7f",
+	"iprange": "ebf3bfd5-9915-4ed1-bcb3-117bb48b155d",
+	"start": "192.168.1.10",
+	"end": "192.168.1.12",
+	"metadata": {
+		"foo": "bar"
+	}
+}`
+
+func createIPExclusion(t *testing.T) *models.IPExclusion {
+	r := strings.NewReader(ipExclusionJSON)
+	exclusion := &models.IPExclusion{}
+	h.Ok(t, exclusion.Decode(r))
+	return exclusion
+}
+
+func checkIPExclusionValues(t *testing.T, exclusion *models.IPExclusion) {
+	h.Equals(t, "3f2b6c8e-5a1d-4c7e-9b0f-2d8e6a4c1b7f", exclusion.ID)
+	h.Equals(t, "ebf3bfd5-9915-4ed1-bcb3-117bb48b155d", exclusion.IPRangeID)
+	h.Equals(t, "192.168.1.10", exclusion.Start.String())
+	h.Equals(t, "192.168.1.12", exclusion.End.String())
+	h.Equals(t, map[string]string{"foo": "bar"}, exclusion.Metadata)
+}
+
+func TestNewIPExclusion(t *testing.T) {
+	exclusion := models.NewIPExclusion()
+	h.Assert(t, uuid.Parse(exclusion.ID) != nil, "missing uuid ID")
+	h.Assert(t, exclusion.Metadata != nil, "uninitialized metadata")
+}
+
+func TestIPExclusionDecode(t *testing.T) {
+	exclusion := createIPExclusion(t)
+	checkIPExclusionValues(t, exclusion)
+
+	exclusion = &models.IPExclusion{}
+	h.Ok(t, exclusion.Decode(strings.NewReader(`{"start": "192.168.1.50"}`)))
+	h.Equals(t, "192.168.1.50", exclusion.End.String())
+}
+
+func TestIPExclusionValidate(t *testing.T) {
+	exclusion := &models.IPExclusion{}
+	var err error
+
+	err = exclusion.Validate()
+	h.Assert(t, errContains(models.ErrNoID, err), "expected ErrNoID")
+	h.Assert(t, errContains(models.ErrBadID, err), "expected ErrBadID")
+	h.Assert(t, errContains(models.ErrBadIPRangeID, err), "expected ErrBadIPRangeID")
+	h.Assert(t, errContains(models.ErrNoStartIP, err), "expected ErrNoStartIP")
+	h.Assert(t, errContains(models.ErrNoEndIP, err), "expected ErrNoEndIP")
+	h.Assert(t, errContains(models.ErrNilMetadata, err), "expected ErrNilMetadata")
+
+	exclusion = createIPExclusion(t)
+	h.Ok(t, exclusion.Validate())
+
+	exclusion.Start, exclusion.End = exclusion.End, exclusion.Start
+	h.Assert(t, errContains(models.ErrStartIPAfterEndIP, exclusion.Validate()), "expected ErrStartIPAfterEndIP")
+
+	exclusion.End = net.ParseIP("2001:db8::1")
+	h.Assert(t, errContains(models.ErrMixedIPFamilies, exclusion.Validate()), "expected ErrMixedIPFamilies")
+}
+
+func TestIPExclusionSave(t *testing.T) {
+	// Prep
+	iprange := createIPRange(t)
+	h.Ok(t, iprange.Save())
+
+	exclusion := createIPExclusion(t)
+	h.Ok(t, exclusion.Save())
+
+	exclusion2, err := models.FetchIPExclusion(exclusion.ID)
+	h.Ok(t, err)
+	checkIPExclusionValues(t, exclusion2)
+
+	// Overlapping another exclusion
+	overlap := createIPExclusion(t)
+	overlap.NewID()
+	h.Equals(t, models.ErrExclusionOverlap, overlap.Save())
+
+	// Outside of the pool
+	outside := createIPExclusion(t)
+	outside.NewID()
+	outside.Start = net.ParseIP("192.168.1.2")
+	h.Equals(t, models.ErrExclusionNotInPool, outside.Save())
+
+	// Allocation skips excluded addresses
+	allocation := models.NewIPAllocation()
+	h.Ok(t, iprange.Allocate(allocation))
+	h.Equals(t, "192.168.1.13", allocation.IP.String())
+	h.Equals(t, models.ErrIPReserved, iprange.Allocate(&models.IPAllocation{
+		IP:       net.ParseIP("192.168.1.11"),
+		Metadata: map[string]string{},
+	}))
+
+	// Usage counts excluded addresses as reserved
+	usage, err := iprange.Usage()
+	h.Ok(t, err)
+	h.Equals(t, "3", usage.Reserved.String())
+	h.Equals(t, "241", usage.Free.String())
+
+	// Load
+	h.Ok(t, iprange.LoadExclusions())
+	h.Equals(t, 1, len(iprange.Exclusions))
+
+	// The pool can not shrink past the exclusion
+	iprange.Start = net.ParseIP("192.168.1.11")
+	h.Equals(t, models.ErrExclusionOutsidePool, iprange.Save())
+	iprange2, err := models.FetchIPRange(iprange.ID)
+	h.Ok(t, err)
+	h.Equals(t, "192.168.1.10", iprange2.Start.String())
+	iprange.Start = net.ParseIP("192.168.1.10")
+
+	// Cleanup
+	h.Ok(t, iprange.Release(allocation.IP))
+	h.Ok(t, exclusion.Delete())
+	h.Ok(t, iprange.Delete())
+}
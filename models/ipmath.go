@@ -0,0 +1,248 @@
+package models
+
+import (
+	"bytes"
+	"math/big"
+	"net"
+)
+
+// ipNormalize returns the 4 byte form of an IPv4 address and the 16 byte form
+// of an IPv6 address so that addresses can be compared byte for byte
+func ipNormalize(ip net.IP) net.IP {
+	if v4 := ip.To4(); v4 != nil {
+		return v4
+	}
+	return ip.To16()
+}
+
+// ipCompare compares two addresses of the same family, returning -1, 0, or 1
+func ipCompare(a, b net.IP) int {
+	return bytes.Compare(ipNormalize(a), ipNormalize(b))
+}
+
+// ipSameFamily returns whether two addresses are both IPv4 or both IPv6
+func ipSameFamily(a, b net.IP) bool {
+	return len(ipNormalize(a)) == len(ipNormalize(b))
+}
+
+// ipInRange returns whether ip lies between start and end, inclusive
+func ipInRange(ip, start, end net.IP) bool {
+	return ipSameFamily(ip, start) &&
+		ipCompare(ip, start) >= 0 &&
+		ipCompare(ip, end) <= 0
+}
+
+// ipNext returns the address immediately following ip, or nil if ip is the
+// last address of its family
+func ipNext(ip net.IP) net.IP {
+	next := make(net.IP, len(ipNormalize(ip)))
+	copy(next, ipNormalize(ip))
+	for i := len(next) - 1; i >= 0; i-- {
+		next[i]++
+		if next[i] != 0 {
+			return next
+		}
+	}
+	return nil
+}
+
+// ipPrev returns the address immediately preceding ip, or nil if ip is the
+// first address of its family
+func ipPrev(ip net.IP) net.IP {
+	prev := make(net.IP, len(ipNormalize(ip)))
+	copy(prev, ipNormalize(ip))
+	for i := len(prev) - 1; i >= 0; i-- {
+		prev[i]--
+		if prev[i] != 0xff {
+			return prev
+		}
+	}
+	return nil
+}
+
+// eui64 returns the modified EUI-64 address SLAAC derives from a /64 prefix
+// and a 48 bit MAC, or nil for any other MAC
+func eui64(prefix net.IP, mac net.HardwareAddr) net.IP {
+	if len(mac) != 6 {
+		return nil
+	}
+	ip := make(net.IP, net.IPv6len)
+	copy(ip, prefix.To16()[:8])
+	ip[8] = mac[0] ^ 0x02
+	ip[9] = mac[1]
+	ip[10] = mac[2]
+	ip[11] = 0xff
+	ip[12] = 0xfe
+	ip[13] = mac[3]
+	ip[14] = mac[4]
+	ip[15] = mac[5]
+	return ip
+}
+
+// ipInterval is an inclusive span of addresses
+type ipInterval struct {
+	start    net.IP
+	end      net.IP
+	reserved bool
+}
+
+// ipIntervals is a list of address intervals
+type ipIntervals []ipInterval
+
+// nextFreeIP returns the lowest address between start and end, inclusive,
+// that is not within any of the blocked intervals. The blocked intervals must
+// be sorted by their starting address. Returns nil if every address is
+// blocked.
+func nextFreeIP(start, end net.IP, blocked ipIntervals) net.IP {
+	candidate := ipNormalize(start)
+	for _, interval := range blocked {
+		if !ipSameFamily(interval.start, candidate) || ipCompare(interval.end, candidate) < 0 {
+			continue
+		}
+		if ipCompare(interval.start, candidate) > 0 {
+			break
+		}
+		if candidate = ipNext(interval.end); candidate == nil {
+			return nil
+		}
+	}
+	if ipCompare(candidate, end) > 0 {
+		return nil
+	}
+	return candidate
+}
+
+// freeIntervals returns the spans of addresses between start and end,
+// inclusive, that are not within any of the blocked intervals. The blocked
+// intervals must be sorted by their starting address.
+func freeIntervals(start, end net.IP, blocked ipIntervals) ipIntervals {
+	free := make(ipIntervals, 0, 1)
+	// next is the lowest address not yet known to be blocked
+	next := ipNormalize(start)
+	for _, interval := range blocked {
+		if next == nil || ipCompare(next, end) > 0 {
+			return free
+		}
+		if !ipSameFamily(interval.start, start) || ipCompare(interval.end, next) < 0 {
+			continue
+		}
+		if ipCompare(interval.start, end) > 0 {
+			break
+		}
+		if ipCompare(interval.start, next) > 0 {
+			free = append(free, ipInterval{start: next, end: ipPrev(interval.start)})
+		}
+		next = ipNext(interval.end)
+	}
+	if next != nil && ipCompare(next, end) <= 0 {
+		free = append(free, ipInterval{start: next, end: ipNormalize(end)})
+	}
+	return free
+}
+
+// blockedCount returns the number of distinct addresses between start and end,
+// inclusive, that are within any of the blocked intervals. The blocked
+// intervals must be sorted by their starting address.
+func blockedCount(start, end net.IP, blocked ipIntervals) *big.Int {
+	count := new(big.Int)
+	// next is the lowest address not yet counted
+	next := ipNormalize(start)
+	for _, interval := range blocked {
+		if next == nil {
+			break
+		}
+		if !ipSameFamily(interval.start, start) {
+			continue
+		}
+		from, to := interval.start, interval.end
+		if ipCompare(from, next) < 0 {
+			from = next
+		}
+		if ipCompare(to, end) > 0 {
+			to = end
+		}
+		if ipCompare(from, to) > 0 {
+			continue
+		}
+		count.Add(count, ipCount(from, to))
+		next = ipNext(to)
+	}
+	return count
+}
+
+// ipToInt converts an address into an integer
+func ipToInt(ip net.IP) *big.Int {
+	return new(big.Int).SetBytes(ipNormalize(ip))
+}
+
+// ipCount returns the number of addresses between start and end, inclusive
+func ipCount(start, end net.IP) *big.Int {
+	count := new(big.Int).Sub(ipToInt(end), ipToInt(start))
+	if count.Sign() < 0 {
+		return new(big.Int)
+	}
+	return count.Add(count, big.NewInt(1))
+}
+
+// cidrLast returns the last address of a cidr, which is the broadcast address
+// for IPv4
+func cidrLast(cidr *net.IPNet) net.IP {
+	ip := ipNormalize(cidr.IP)
+	mask := cidr.Mask
+	if len(mask) != len(ip) {
+		mask = mask[len(mask)-len(ip):]
+	}
+	last := make(net.IP, len(ip))
+	for i := range ip {
+		last[i] = ip[i] | ^mask[i]
+	}
+	return last
+}
+
+// intToIP converts an integer into an address with the given byte length
+func intToIP(i *big.Int, length int) net.IP {
+	b := i.Bytes()
+	ip := make(net.IP, length)
+	copy(ip[length-len(b):], b)
+	return ip
+}
+
+// nextFreeSubnet returns the lowest subnet of the given prefix length, aligned
+// on its own size, within parent that does not overlap any of the used
+// subnets. The used subnets must be sorted by their starting address. Returns
+// nil if there is no room left in parent.
+func nextFreeSubnet(parent *net.IPNet, prefixLength int, used []*net.IPNet) *net.IPNet {
+	length := len(ipNormalize(parent.IP))
+	bits := length * 8
+	size := new(big.Int).Lsh(big.NewInt(1), uint(bits-prefixLength))
+	last := ipToInt(cidrLast(parent))
+
+	candidate := ipToInt(parent.IP)
+	for _, subnet := range used {
+		if len(ipNormalize(subnet.IP)) != length {
+			continue
+		}
+		candidateLast := new(big.Int).Add(candidate, size)
+		candidateLast.Sub(candidateLast, big.NewInt(1))
+		usedLast := ipToInt(cidrLast(subnet))
+		if usedLast.Cmp(candidate) < 0 {
+			continue
+		}
+		if ipToInt(subnet.IP).Cmp(candidateLast) > 0 {
+			break
+		}
+		// Move past the used subnet, rounding up to the next aligned address
+		candidate.Add(usedLast, size)
+		candidate.Div(candidate, size)
+		candidate.Mul(candidate, size)
+	}
+	candidateLast := new(big.Int).Add(candidate, size)
+	candidateLast.Sub(candidateLast, big.NewInt(1))
+	if candidateLast.Cmp(last) > 0 {
+		return nil
+	}
+	return &net.IPNet{
+		IP:   intToIP(candidate, length),
+		Mask: net.CIDRMask(prefixLength, bits),
+	}
+}
@@ -11,27 +11,54 @@ import (
 	"github.com/mistifyio/mistify-operator-admin/db"
 )
 
+// IPRange modes describe how guests are given addresses from the iprange
+const (
+	// IPRangeModeDHCP is for IPv4 addresses leased by DHCP
+	IPRangeModeDHCP = "dhcp"
+	// IPRangeModeDHCPv6 is for IPv6 addresses leased by stateful DHCPv6
+	IPRangeModeDHCPv6 = "dhcpv6"
+	// IPRangeModeSLAAC is for IPv6 addresses guests derive from router
+	// advertisements and their MAC
+	IPRangeModeSLAAC = "slaac"
+	// IPRangeModeStatic is for addresses only handed out as fixed leases
+	IPRangeModeStatic = "static"
+)
+
 type (
 	// IPRange describes a segment of IP addresses
 	IPRange struct {
-		ID          string            `json:"id"`
-		CIDR        *net.IPNet        `json:"cidr"`
-		Gateway     net.IP            `json:"gateway"`
-		Start       net.IP            `json:"start"`
-		End         net.IP            `json:"end"`
-		Metadata    map[string]string `json:"metadata"`
-		Network     *Network          `json:"-"`
-		Hypervisors []*Hypervisor     `json:"-"`
+		ID           string            `json:"id"`
+		CIDR         *net.IPNet        `json:"cidr"`
+		Gateway      net.IP            `json:"gateway"`
+		Start        net.IP            `json:"start"`
+		End          net.IP            `json:"end"`
+		Mode         string            `json:"mode"`
+		Segment      string            `json:"segment"`
+		DNSServers   []net.IP          `json:"dns_servers"`
+		SearchDomain string            `json:"search_domain"`
+		MTU          int               `json:"mtu"`
+		Routes       []*Route          `json:"routes"`
+		Metadata     map[string]string `json:"metadata"`
+		Network      *Network          `json:"-"`
+		Hypervisors  []*Hypervisor     `json:"-"`
+		Allocations  []*IPAllocation   `json:"-"`
+		Exclusions   []*IPExclusion    `json:"-"`
 	}
 
 	// ipRangeData is a middle-man for JSON and database (un)marshalling
 	ipRangeData struct {
-		ID       string            `json:"id"`
-		CIDR     string            `json:"cidr"`
-		Gateway  string            `json:"gateway"`
-		Start    string            `json:"start"`
-		End      string            `json:"end"`
-		Metadata map[string]string `json:"metadata"`
+		ID           string            `json:"id"`
+		CIDR         string            `json:"cidr"`
+		Gateway      string            `json:"gateway"`
+		Start        string            `json:"start"`
+		End          string            `json:"end"`
+		Mode         string            `json:"mode"`
+		Segment      string            `json:"segment"`
+		DNSServers   []string          `json:"dns_servers"`
+		SearchDomain string            `json:"search_domain"`
+		MTU          int               `json:"mtu"`
+		Routes       []*Route          `json:"routes"`
+		Metadata     map[string]string `json:"metadata"`
 	}
 )
 
@@ -57,6 +84,12 @@ func (iprange *IPRange) importData(data *ipRangeData) error {
 	iprange.Gateway = net.ParseIP(data.Gateway)
 	iprange.Start = net.ParseIP(data.Start)
 	iprange.End = net.ParseIP(data.End)
+	iprange.Mode = data.Mode
+	iprange.Segment = data.Segment
+	iprange.DNSServers = parseIPs(data.DNSServers)
+	iprange.SearchDomain = data.SearchDomain
+	iprange.MTU = data.MTU
+	iprange.Routes = data.Routes
 	iprange.Metadata = data.Metadata
 	return nil
 }
@@ -64,12 +97,18 @@ func (iprange *IPRange) importData(data *ipRangeData) error {
 // exportData marshals the iprange object into the middle-man structure
 func (iprange *IPRange) exportData() *ipRangeData {
 	return &ipRangeData{
-		ID:       iprange.ID,
-		CIDR:     fmtString(iprange.CIDR),
-		Gateway:  fmtString(iprange.Gateway),
-		Start:    fmtString(iprange.Start),
-		End:      fmtString(iprange.End),
-		Metadata: iprange.Metadata,
+		ID:           iprange.ID,
+		CIDR:         fmtString(iprange.CIDR),
+		Gateway:      fmtString(iprange.Gateway),
+		Start:        fmtString(iprange.Start),
+		End:          fmtString(iprange.End),
+		Mode:         iprange.mode(),
+		Segment:      iprange.Segment,
+		DNSServers:   fmtIPs(iprange.DNSServers),
+		SearchDomain: iprange.SearchDomain,
+		MTU:          iprange.MTU,
+		Routes:       nonNilRoutes(iprange.Routes),
+		Metadata:     iprange.Metadata,
 	}
 }
 
@@ -90,6 +129,23 @@ func (iprange IPRange) MarshalJSON() ([]byte, error) {
 	return json.Marshal(iprange.exportData())
 }
 
+// IPv6 returns whether the iprange is an IPv6 range
+func (iprange *IPRange) IPv6() bool {
+	return iprange.CIDR != nil && len(ipNormalize(iprange.CIDR.IP)) == net.IPv6len
+}
+
+// mode returns the iprange's mode, defaulting to DHCP or DHCPv6 by IP version
+func (iprange *IPRange) mode() string {
+	switch {
+	case iprange.Mode != "":
+		return iprange.Mode
+	case iprange.IPv6():
+		return IPRangeModeDHCPv6
+	default:
+		return IPRangeModeDHCP
+	}
+}
+
 // Validate ensures the iprange proerties are set correctly
 func (iprange *IPRange) Validate() error {
 	var results *multierror.Error
@@ -111,13 +167,110 @@ func (iprange *IPRange) Validate() error {
 	if iprange.End == nil {
 		results = multierror.Append(results, ErrNoEndIP)
 	}
+	results = validateNetSettings(results, iprange.DNSServers, iprange.SearchDomain, iprange.MTU, iprange.Routes)
 	if iprange.Metadata == nil {
 		results = multierror.Append(results, ErrNilMetadata)
 	}
+	if iprange.CIDR != nil && iprange.Gateway != nil && iprange.Start != nil && iprange.End != nil {
+		if err := iprange.validateGeometry(); err != nil {
+			results = multierror.Append(results, err)
+		}
+	}
+	if iprange.CIDR != nil {
+		if err := iprange.validateMode(); err != nil {
+			results = multierror.Append(results, err)
+		}
+		results = iprange.validateFamilies(results)
+	}
+	return results.ErrorOrNil()
+}
+
+// validateFamilies ensures the DNS servers and routes are of the same IP
+// version as the cidr. Servers and routes that are invalid regardless are left
+// to validateNetSettings.
+func (iprange *IPRange) validateFamilies(results *multierror.Error) *multierror.Error {
+	family := iprange.CIDR.IP
+	for _, ip := range iprange.DNSServers {
+		if ip != nil && !ipSameFamily(ip, family) {
+			results = multierror.Append(results, ErrDNSServerFamily)
+			break
+		}
+	}
+	for _, route := range iprange.Routes {
+		if route != nil && route.Validate() == nil && !ipSameFamily(route.Gateway, family) {
+			results = multierror.Append(results, ErrRouteFamily)
+			break
+		}
+	}
+	return results
+}
+
+// validateMode ensures the mode suits the iprange's IP version. SLAAC needs a
+// /64 for guests to derive their addresses from.
+func (iprange *IPRange) validateMode() error {
+	switch iprange.mode() {
+	case IPRangeModeStatic:
+		return nil
+	case IPRangeModeDHCP:
+		if !iprange.IPv6() {
+			return nil
+		}
+	case IPRangeModeDHCPv6:
+		if iprange.IPv6() {
+			return nil
+		}
+	case IPRangeModeSLAAC:
+		if !iprange.IPv6() {
+			break
+		}
+		if ones, _ := iprange.CIDR.Mask.Size(); ones != 64 {
+			return ErrSLAACPrefixLength
+		}
+		return nil
+	}
+	return ErrBadIPRangeMode
+}
+
+// validateGeometry ensures the gateway and pool addresses are sensibly placed
+// within the cidr
+func (iprange *IPRange) validateGeometry() error {
+	var results *multierror.Error
+	family := iprange.CIDR.IP
+	if !ipSameFamily(iprange.Gateway, family) ||
+		!ipSameFamily(iprange.Start, family) ||
+		!ipSameFamily(iprange.End, family) {
+		// Nothing else can be meaningfully compared
+		return multierror.Append(results, ErrMixedIPFamilies)
+	}
+	if !iprange.CIDR.Contains(iprange.Gateway) {
+		results = multierror.Append(results, ErrGatewayNotInCIDR)
+	}
+	if !iprange.CIDR.Contains(iprange.Start) {
+		results = multierror.Append(results, ErrStartIPNotInCIDR)
+	}
+	if !iprange.CIDR.Contains(iprange.End) {
+		results = multierror.Append(results, ErrEndIPNotInCIDR)
+	}
+	if ipCompare(iprange.Start, iprange.End) > 0 {
+		results = multierror.Append(results, ErrStartIPAfterEndIP)
+	}
+	if ipInRange(iprange.Gateway, iprange.Start, iprange.End) {
+		results = multierror.Append(results, ErrGatewayInPool)
+	}
+	// IPv4 networks larger than a /31 reserve the first and last addresses
+	if ones, bits := iprange.CIDR.Mask.Size(); len(ipNormalize(family)) == net.IPv4len && bits-ones > 1 {
+		if ipCompare(iprange.Start, iprange.CIDR.IP) <= 0 {
+			results = multierror.Append(results, ErrPoolHasNetworkIP)
+		}
+		if ipCompare(iprange.End, cidrLast(iprange.CIDR)) >= 0 {
+			results = multierror.Append(results, ErrPoolHasBroadcastIP)
+		}
+	}
 	return results.ErrorOrNil()
 }
 
-// Save persists an iprange to the database
+// Save persists an iprange to the database. The pool may not be changed to
+// leave any of the iprange's exclusions or allocations outside of it.
 func (iprange *IPRange) Save() error {
 	if err := iprange.Validate(); err != nil {
 		return err
@@ -126,12 +279,82 @@ func (iprange *IPRange) Save() error {
 	if err != nil {
 		return err
 	}
+	overlaps, err := iprange.Overlaps()
+	if err != nil {
+		return err
+	}
+	if len(overlaps) > 0 {
+		return &OverlapError{IDs: overlaps}
+	}
+	conflicts, err := iprange.segmentConflicts()
+	if err != nil {
+		return err
+	}
+	if len(conflicts) > 0 {
+		return ErrSegmentInUse
+	}
+
+	// Lock the iprange row to serialize with exclusions and allocations
+	txn, err := d.Begin()
+	if err != nil {
+		return err
+	}
+	lockSQL := `
+	SELECT 1
+	FROM ipranges
+	WHERE iprange_id = $1
+	FOR UPDATE
+	`
+	if _, err := txn.Exec(lockSQL, iprange.ID); err != nil {
+		_ = txn.Rollback()
+		return err
+	}
+
+	data := iprange.exportData()
+	poolSQL := `
+	SELECT
+		EXISTS (
+			SELECT 1
+			FROM iprange_exclusions
+			WHERE iprange_id = $1
+			AND (start_ip < $2::inet OR end_ip > $3::inet)
+		),
+		EXISTS (
+			SELECT 1
+			FROM iprange_allocations
+			WHERE iprange_id = $1
+			AND (ip < $2::inet OR ip > $3::inet)
+		)
+	`
+	var excluded, allocated bool
+	if err := txn.QueryRow(poolSQL, data.ID, data.Start, data.End).Scan(&excluded, &allocated); err != nil {
+		_ = txn.Rollback()
+		return err
+	}
+	if excluded {
+		_ = txn.Rollback()
+		return ErrExclusionOutsidePool
+	}
+	if allocated {
+		_ = txn.Rollback()
+		return ErrIPAllocated
+	}
+
+	if err := iprange.save(txn); err != nil {
+		_ = txn.Rollback()
+		return segmentError(overlapError(err, iprange.Overlaps))
+	}
+	return txn.Commit()
+}
+
+// save upserts the iprange, either directly or as part of a transaction
+func (iprange *IPRange) save(e execer) error {
 	// Writable CTE for an Upsert
 	// See: http://stackoverflow.com/a/8702291
 	// And: http://dba.stackexchange.com/a/78535
 	sql := `
-	WITH new_values (iprange_id, cidr, gateway, start_ip, end_ip, metadata) as (
-		VALUES ($1::uuid, $2::cidr, $3::inet, $4::inet, $5::inet, $6::json)
+	WITH new_values (iprange_id, cidr, gateway, start_ip, end_ip, mode, segment, dns_servers, search_domain, mtu, routes, metadata) as (
+		VALUES ($1::uuid, $2::cidr, $3::inet, $4::inet, $5::inet, $6, $7, $8::json, $9, $10::integer, $11::json, $12::json)
 	),
 	upsert as (
 		UPDATE ipranges i SET
@@ -139,33 +362,119 @@ func (iprange *IPRange) Save() error {
 			gateway = nv.gateway,
 			start_ip = nv.start_ip,
 			end_ip = nv.end_ip,
+			mode = nv.mode,
+			segment = nv.segment,
+			dns_servers = nv.dns_servers,
+			search_domain = nv.search_domain,
+			mtu = nv.mtu,
+			routes = nv.routes,
 			metadata = nv.metadata
 		FROM new_values nv
 		WHERE i.iprange_id = nv.iprange_id
 		RETURNING i.iprange_id
 	)
 	INSERT INTO ipranges
-		(iprange_id, cidr, gateway, start_ip, end_ip, metadata)
-	SELECT iprange_id, cidr, gateway, start_ip, end_ip, metadata
+		(iprange_id, cidr, gateway, start_ip, end_ip, mode, segment, dns_servers, search_domain, mtu, routes, metadata)
+	SELECT iprange_id, cidr, gateway, start_ip, end_ip, mode, segment, dns_servers, search_domain, mtu, routes, metadata
 	FROM new_values nv
 	WHERE NOT EXISTS (SELECT 1 FROM upsert u WHERE nv.iprange_id = u.iprange_id)
     `
 	data := iprange.exportData()
+	dnsServers, err := json.Marshal(data.DNSServers)
+	if err != nil {
+		return err
+	}
+	routes, err := json.Marshal(data.Routes)
+	if err != nil {
+		return err
+	}
 	metadata, err := json.Marshal(data.Metadata)
 	if err != nil {
 		return err
 	}
-	_, err = d.Exec(sql,
+	_, err = e.Exec(sql,
 		data.ID,
 		data.CIDR,
 		data.Gateway,
 		data.Start,
 		data.End,
+		data.Mode,
+		data.Segment,
+		string(dnsServers),
+		data.SearchDomain,
+		nullInt(data.MTU),
+		string(routes),
 		string(metadata),
 	)
 	return err
 }
 
+// Overlaps retrieves the ids of other ipranges whose pool overlaps the
+// iprange's pool, or whose cidr overlaps the iprange's cidr within the network
+// the iprange is related to
+func (iprange *IPRange) Overlaps() ([]string, error) {
+	d, err := db.Connect(nil)
+	if err != nil {
+		return nil, err
+	}
+	sql := `
+	SELECT i.iprange_id
+	FROM ipranges i
+	LEFT JOIN iprange_networks i_n ON i.iprange_id = i_n.iprange_id
+	WHERE i.iprange_id <> $1
+	AND (
+		(
+			family(i.start_ip) = family($3::inet)
+			AND i.start_ip <= $4::inet
+			AND i.end_ip >= $3::inet
+		)
+		OR (
+			i_n.network_id = (SELECT network_id FROM iprange_networks WHERE iprange_id = $1)
+			AND i.cidr && $2::cidr
+		)
+	)
+	ORDER BY i.iprange_id asc
+	`
+	data := iprange.exportData()
+	rows, err := d.Query(sql,
+		data.ID,
+		data.CIDR,
+		data.Start,
+		data.End,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return idsFromRows(rows)
+}
+
+// segmentConflicts retrieves the ids of other ipranges of the same IP version
+// in the same segment of the network the iprange is related to
+func (iprange *IPRange) segmentConflicts() ([]string, error) {
+	if iprange.Segment == "" {
+		return nil, nil
+	}
+	d, err := db.Connect(nil)
+	if err != nil {
+		return nil, err
+	}
+	sql := `
+	SELECT i.iprange_id
+	FROM ipranges i
+	JOIN iprange_networks i_n ON i.iprange_id = i_n.iprange_id
+	WHERE i.iprange_id <> $1
+	AND i_n.network_id = (SELECT network_id FROM iprange_networks WHERE iprange_id = $1)
+	AND i.segment = $3
+	AND family(i.cidr) = family($2::cidr)
+	ORDER BY i.iprange_id asc
+	`
+	rows, err := d.Query(sql, iprange.ID, fmtString(iprange.CIDR), iprange.Segment)
+	if err != nil {
+		return nil, err
+	}
+	return idsFromRows(rows)
+}
+
 // Delete removes an iprange from the database
 func (iprange *IPRange) Delete() error {
 	d, err := db.Connect(nil)
@@ -184,7 +493,7 @@ func (iprange *IPRange) Load() error {
 		return err
 	}
 	sql := `
-	SELECT iprange_id, cidr, gateway, start_ip, end_ip, metadata
+	SELECT iprange_id, cidr, gateway, start_ip, end_ip, mode, segment, dns_servers, search_domain, mtu, routes, metadata
 	FROM ipranges
 	WHERE iprange_id = $1
 	`
@@ -202,7 +511,8 @@ func (iprange *IPRange) Load() error {
 
 // fromRows unmarshals a database query result row into the iprange object
 func (iprange *IPRange) fromRows(rows *sql.Rows) error {
-	var metadata string
+	var dnsServers, routes, metadata string
+	var mtu sql.NullInt64
 	data := &ipRangeData{}
 	err := rows.Scan(
 		&data.ID,
@@ -210,11 +520,24 @@ func (iprange *IPRange) fromRows(rows *sql.Rows) error {
 		&data.Gateway,
 		&data.Start,
 		&data.End,
+		&data.Mode,
+		&data.Segment,
+		&dnsServers,
+		&data.SearchDomain,
+		&mtu,
+		&routes,
 		&metadata,
 	)
 	if err != nil {
 		return err
 	}
+	data.MTU = int(mtu.Int64)
+	if err := json.Unmarshal([]byte(dnsServers), &data.DNSServers); err != nil {
+		return err
+	}
+	if err := json.Unmarshal([]byte(routes), &data.Routes); err != nil {
+		return err
+	}
 	if err := json.Unmarshal([]byte(metadata), &data.Metadata); err != nil {
 		return err
 	}
@@ -292,10 +615,27 @@ func (iprange *IPRange) LoadNetwork() error {
 
 // SetNetwork sets the related network
 func (iprange *IPRange) SetNetwork(network *Network) error {
+	check := func() ([]string, error) {
+		return network.overlaps([]*IPRange{iprange}, false)
+	}
+	overlaps, err := check()
+	if err != nil {
+		return err
+	}
+	if len(overlaps) > 0 {
+		return &OverlapError{IDs: overlaps}
+	}
+	conflicts, err := network.segmentConflicts([]*IPRange{iprange}, false)
+	if err != nil {
+		return err
+	}
+	if len(conflicts) > 0 {
+		return ErrSegmentInUse
+	}
 	// Only one can be set at a time
 	relatables := make([]relatable, 1)
 	relatables[0] = relatable(network)
-	return SetRelations("iprange_networks", iprange, relatables)
+	return segmentError(overlapError(SetRelations("iprange_networks", iprange, relatables), check))
 }
 
 // RemoveNetwork clears the network relation
@@ -303,6 +643,62 @@ func (iprange *IPRange) RemoveNetwork(network *Network) error {
 	return RemoveRelation("iprange_networks", iprange, network)
 }
 
+// LoadAllocations retrieves the addresses allocated from the iprange from the
+// database
+func (iprange *IPRange) LoadAllocations() error {
+	allocations, err := IPAllocationsByIPRange(iprange)
+	if err != nil {
+		return err
+	}
+	iprange.Allocations = allocations
+	return nil
+}
+
+// LoadExclusions retrieves the addresses excluded from allocation in the
+// iprange from the database
+func (iprange *IPRange) LoadExclusions() error {
+	exclusions, err := IPExclusionsByIPRange(iprange)
+	if err != nil {
+		return err
+	}
+	iprange.Exclusions = exclusions
+	return nil
+}
+
+// Allocate reserves an address from the iprange. If the allocation has no IP
+// set, the next free address is chosen. In SLAAC mode, the address is instead
+// the one the guest derives from the iprange's prefix and the allocation's
+// MAC.
+func (iprange *IPRange) Allocate(allocation *IPAllocation) error {
+	allocation.IPRangeID = iprange.ID
+	if allocation.HypervisorID != "" && uuid.Parse(allocation.HypervisorID) == nil {
+		return ErrBadHypervisorID
+	}
+	if iprange.mode() == IPRangeModeSLAAC {
+		if allocation.MAC == nil {
+			return ErrNoMAC
+		}
+		ip := eui64(iprange.CIDR.IP, allocation.MAC)
+		if ip == nil {
+			return ErrBadMAC
+		}
+		if allocation.IP != nil && !allocation.IP.Equal(ip) {
+			return ErrIPNotSLAAC
+		}
+		allocation.IP = ip
+	}
+	return allocateIP(allocation)
+}
+
+// Release returns an allocated address to the iprange
+func (iprange *IPRange) Release(ip net.IP) error {
+	allocation := &IPAllocation{
+		IPRangeID: iprange.ID,
+		IP:        ip,
+	}
+	return allocation.Delete()
+}
+
 // NewID generates a new uuid ID
 func (iprange *IPRange) NewID() string {
 	iprange.ID = uuid.New()
@@ -336,7 +732,7 @@ func ListIPRanges() ([]*IPRange, error) {
 		return nil, err
 	}
 	sql := `
-	SELECT iprange_id, cidr, gateway, start_ip, end_ip, metadata
+	SELECT iprange_id, cidr, gateway, start_ip, end_ip, mode, segment, dns_servers, search_domain, mtu, routes, metadata
 	FROM ipranges
 	ORDER BY iprange_id
 	`
@@ -358,6 +754,43 @@ func ListIPRanges() ([]*IPRange, error) {
 	return ipranges, nil
 }
 
+// IPRangesContaining retrieves an array of iprange objects whose cidr or pool
+// contains an address from the database, along with their related network and
+// hypervisors
+func IPRangesContaining(ip net.IP) ([]*IPRange, error) {
+	d, err := db.Connect(nil)
+	if err != nil {
+		return nil, err
+	}
+	sql := `
+	SELECT iprange_id, cidr, gateway, start_ip, end_ip, mode, segment, dns_servers, search_domain, mtu, routes, metadata
+	FROM ipranges
+	WHERE cidr >>= $1::inet
+	OR $1::inet BETWEEN start_ip AND end_ip
+	ORDER BY iprange_id asc
+	`
+	rows, err := d.Query(sql, fmtString(ip))
+	if err != nil {
+		return nil, err
+	}
+	ipranges, err := iprangesFromRows(rows)
+	if err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	for _, iprange := range ipranges {
+		if err := iprange.LoadNetwork(); err != nil {
+			return nil, err
+		}
+		if err := iprange.LoadHypervisors(); err != nil {
+			return nil, err
+		}
+	}
+	return ipranges, nil
+}
+
 // IPRangesByHypervisor retrieves an array of iprange objects associated with a
 // hypervisor from the database
 func IPRangesByHypervisor(hypervisor *Hypervisor) ([]*IPRange, error) {
@@ -366,7 +799,7 @@ func IPRangesByHypervisor(hypervisor *Hypervisor) ([]*IPRange, error) {
 		return nil, err
 	}
 	sql := `
-	SELECT i.iprange_id, i.cidr, i.gateway, i.start_ip, i.end_ip, i.metadata
+	SELECT i.iprange_id, i.cidr, i.gateway, i.start_ip, i.end_ip, i.mode, i.segment, i.dns_servers, i.search_domain, i.mtu, i.routes, i.metadata
 	FROM ipranges i
 	JOIN hypervisors_ipranges hi ON i.iprange_id = hi.iprange_id
 	WHERE hi.hypervisor_id = $1
@@ -394,7 +827,7 @@ func IPRangesByNetwork(network *Network) ([]*IPRange, error) {
 		return nil, err
 	}
 	sql := `
-	SELECT i.iprange_id, i.cidr, i.gateway, i.start_ip, i.end_ip, i.metadata
+	SELECT i.iprange_id, i.cidr, i.gateway, i.start_ip, i.end_ip, i.mode, i.segment, i.dns_servers, i.search_domain, i.mtu, i.routes, i.metadata
 	FROM ipranges i
 	JOIN iprange_networks i_n ON i.iprange_id = i_n.iprange_id
 	WHERE i_n.network_id = $1
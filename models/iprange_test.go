@@ -1,6 +1,7 @@
 package models_test
 
 import (
+	"encoding/json"
 	"net"
 	"strings"
 	"testing"
@@ -16,7 +17,13 @@ var iprangeJSON = `{
 	"cidr": "192.168.1.0/24",
 	"gateway": "192.168.1.1",
 	"start": "192.168.1.10",
-	"end": "192.168.1.255",
+	"end": "192.168.1.254",
+	"dns_servers": ["192.168.1.2"],
+	"search_domain": "example.com",
+	"mtu": 1500,
+	"routes": [
+		{"destination": "10.0.0.0/8", "gateway": "192.168.1.1"}
+	],
 	"metadata": {
 		"foo": "bar"
 	}
@@ -34,7 +41,13 @@ func checkIPRangeValues(t *testing.T, iprange *models.IPRange) {
 	h.Equals(t, "192.168.1.0/24", iprange.CIDR.String())
 	h.Equals(t, "192.168.1.1", iprange.Gateway.String())
 	h.Equals(t, "192.168.1.10", iprange.Start.String())
-	h.Equals(t, "192.168.1.255", iprange.End.String())
+	h.Equals(t, "192.168.1.254", iprange.End.String())
+	h.Equals(t, 1, len(iprange.DNSServers))
+	h.Equals(t, "192.168.1.2", iprange.DNSServers[0].String())
+	h.Equals(t, "example.com", iprange.SearchDomain)
+	h.Equals(t, 1500, iprange.MTU)
+	h.Equals(t, 1, len(iprange.Routes))
+	h.Equals(t, "10.0.0.0/8", iprange.Routes[0].Destination.String())
 	h.Equals(t, map[string]string{"foo": "bar"}, iprange.Metadata)
 }
 
@@ -95,7 +108,7 @@ func TestIPRangeValidate(t *testing.T) {
 	iprange.Start = net.ParseIP("192.168.1.10")
 	h.Assert(t, errDoesNotContain(models.ErrNoStartIP, iprange.Validate()), "did not expect ErrNoStartIP")
 
-	iprange.End = net.ParseIP("192.168.1.255")
+	iprange.End = net.ParseIP("192.168.1.254")
 	h.Assert(t, errDoesNotContain(models.ErrNoEndIP, iprange.Validate()), "did not expect ErrNoEndIP")
 
 	iprange.Metadata = make(map[string]string)
@@ -105,10 +118,135 @@ func TestIPRangeValidate(t *testing.T) {
 	h.Ok(t, err)
 }
 
+func TestIPRangeValidateGeometry(t *testing.T) {
+	iprange := createIPRange(t)
+	h.Ok(t, iprange.Validate())
+
+	iprange.Gateway = net.ParseIP("10.0.0.1")
+	iprange.Start = net.ParseIP("10.0.0.10")
+	iprange.End = net.ParseIP("10.0.0.20")
+	err := iprange.Validate()
+	h.Assert(t, errContains(models.ErrGatewayNotInCIDR, err), "expected ErrGatewayNotInCIDR")
+	h.Assert(t, errContains(models.ErrStartIPNotInCIDR, err), "expected ErrStartIPNotInCIDR")
+	h.Assert(t, errContains(models.ErrEndIPNotInCIDR, err), "expected ErrEndIPNotInCIDR")
+
+	iprange = createIPRange(t)
+	iprange.Start, iprange.End = iprange.End, iprange.Start
+	h.Assert(t, errContains(models.ErrStartIPAfterEndIP, iprange.Validate()), "expected ErrStartIPAfterEndIP")
+
+	iprange = createIPRange(t)
+	iprange.Gateway = net.ParseIP("192.168.1.100")
+	h.Assert(t, errContains(models.ErrGatewayInPool, iprange.Validate()), "expected ErrGatewayInPool")
+
+	iprange = createIPRange(t)
+	iprange.Start = net.ParseIP("192.168.1.0")
+	iprange.End = net.ParseIP("192.168.1.255")
+	err = iprange.Validate()
+	h.Assert(t, errContains(models.ErrPoolHasNetworkIP, err), "expected ErrPoolHasNetworkIP")
+	h.Assert(t, errContains(models.ErrPoolHasBroadcastIP, err), "expected ErrPoolHasBroadcastIP")
+
+	iprange = createIPRange(t)
+	iprange.Gateway = net.ParseIP("2001:db8::1")
+	h.Assert(t, errContains(models.ErrMixedIPFamilies, iprange.Validate()), "expected ErrMixedIPFamilies")
+
+	iprange = createIPRange(t)
+	_, cidr, err := net.ParseCIDR("2001:db8::/64")
+	h.Ok(t, err)
+	iprange.CIDR = cidr
+	iprange.Gateway = net.ParseIP("2001:db8::1")
+	iprange.Start = net.ParseIP("2001:db8::")
+	iprange.End = net.ParseIP("2001:db8::ffff:ffff:ffff:ffff")
+	iprange.DNSServers = nil
+	iprange.Routes = nil
+	h.Assert(t, errContains(models.ErrGatewayInPool, iprange.Validate()), "expected ErrGatewayInPool")
+	iprange.Start = net.ParseIP("2001:db8::100")
+	h.Ok(t, iprange.Validate())
+}
+
+func TestIPRangeValidateSettings(t *testing.T) {
+	iprange := createIPRange(t)
+	iprange.MTU = 65536
+	h.Assert(t, errContains(models.ErrBadMTU, iprange.Validate()), "expected ErrBadMTU")
+
+	iprange = createIPRange(t)
+	iprange.SearchDomain = "foo bar"
+	h.Assert(t, errContains(models.ErrBadSearchDomain, iprange.Validate()), "expected ErrBadSearchDomain")
+
+	iprange = createIPRange(t)
+	iprange.DNSServers = append(iprange.DNSServers, nil)
+	h.Assert(t, errContains(models.ErrBadDNSServer, iprange.Validate()), "expected ErrBadDNSServer")
+
+	iprange = createIPRange(t)
+	iprange.Routes[0].Gateway = nil
+	h.Assert(t, errContains(models.ErrBadRoute, iprange.Validate()), "expected ErrBadRoute")
+
+	iprange = createIPRange(t)
+	iprange.DNSServers = append(iprange.DNSServers, net.ParseIP("2001:db8::2"))
+	h.Assert(t, errContains(models.ErrDNSServerFamily, iprange.Validate()), "expected ErrDNSServerFamily")
+
+	iprange = createIPRange(t)
+	_, destination, err := net.ParseCIDR("2001:db8:1::/48")
+	h.Ok(t, err)
+	iprange.Routes = append(iprange.Routes, &models.Route{
+		Destination: destination,
+		Gateway:     net.ParseIP("2001:db8::1"),
+	})
+	h.Assert(t, errContains(models.ErrRouteFamily, iprange.Validate()), "expected ErrRouteFamily")
+
+	iprange = createIPv6Range(t, "")
+	h.Ok(t, iprange.Validate())
+	iprange.DNSServers = append(iprange.DNSServers, net.ParseIP("192.168.1.2"))
+	h.Assert(t, errContains(models.ErrDNSServerFamily, iprange.Validate()), "expected ErrDNSServerFamily")
+}
+
+func createIPv6Range(t *testing.T, mode string) *models.IPRange {
+	iprange := createIPRange(t)
+	_, cidr, err := net.ParseCIDR("2001:db8::/64")
+	h.Ok(t, err)
+	iprange.CIDR = cidr
+	iprange.Gateway = net.ParseIP("2001:db8::1")
+	iprange.Start = net.ParseIP("2001:db8::100")
+	iprange.End = net.ParseIP("2001:db8::ffff:ffff:ffff:ffff")
+	iprange.DNSServers = []net.IP{net.ParseIP("2001:db8::2")}
+	iprange.Routes = nil
+	iprange.Mode = mode
+	return iprange
+}
+
+func TestIPRangeValidateMode(t *testing.T) {
+	iprange := createIPRange(t)
+	iprange.Mode = models.IPRangeModeStatic
+	h.Ok(t, iprange.Validate())
+	iprange.Mode = models.IPRangeModeSLAAC
+	h.Assert(t, errContains(models.ErrBadIPRangeMode, iprange.Validate()), "expected ErrBadIPRangeMode")
+	iprange.Mode = "foobar"
+	h.Assert(t, errContains(models.ErrBadIPRangeMode, iprange.Validate()), "expected ErrBadIPRangeMode")
+
+	iprange = createIPv6Range(t, "")
+	h.Ok(t, iprange.Validate())
+	iprange.Mode = models.IPRangeModeDHCP
+	h.Assert(t, errContains(models.ErrBadIPRangeMode, iprange.Validate()), "expected ErrBadIPRangeMode")
+	iprange.Mode = models.IPRangeModeSLAAC
+	h.Ok(t, iprange.Validate())
+
+	_, cidr, err := net.ParseCIDR("2001:db8::/48")
+	h.Ok(t, err)
+	iprange.CIDR = cidr
+	h.Assert(t, errContains(models.ErrSLAACPrefixLength, iprange.Validate()), "expected ErrSLAACPrefixLength")
+}
+
 func TestIPRangeMarshalJSON(t *testing.T) {
 	iprange := createIPRange(t)
 	_, err := iprange.MarshalJSON()
 	h.Ok(t, err)
+
+	// Mode defaults by IP version
+	b, err := json.Marshal(iprange)
+	h.Ok(t, err)
+	h.Assert(t, strings.Contains(string(b), `"mode":"dhcp"`), "expected dhcp mode")
+	b, err = json.Marshal(createIPv6Range(t, ""))
+	h.Ok(t, err)
+	h.Assert(t, strings.Contains(string(b), `"mode":"dhcpv6"`), "expected dhcpv6 mode")
 }
 
 func TestIPRangeSave(t *testing.T) {
@@ -221,3 +359,96 @@ func TestIPRangeNetworkRelations(t *testing.T) {
 	h.Ok(t, network.Delete())
 	h.Ok(t, iprange.Delete())
 }
+
+func TestIPRangeOverlaps(t *testing.T) {
+	// Prep
+	iprange := createIPRange(t)
+	h.Ok(t, iprange.Save())
+	network := createNetwork(t)
+	h.Ok(t, network.Save())
+
+	// Overlapping pool
+	other := createIPRange(t)
+	other.NewID()
+	err := other.Save()
+	overlapErr, ok := err.(*models.OverlapError)
+	h.Assert(t, ok, "expected OverlapError")
+	h.Equals(t, []string{iprange.ID}, overlapErr.IDs)
+
+	// Disjoint pool within an overlapping cidr
+	_, cidr, err := net.ParseCIDR("192.168.1.0/28")
+	h.Ok(t, err)
+	other.CIDR = cidr
+	other.Start = net.ParseIP("192.168.1.2")
+	other.End = net.ParseIP("192.168.1.9")
+	h.Ok(t, other.Save())
+
+	// Overlapping cidrs within a network
+	h.Ok(t, network.AddIPRange(iprange))
+	_, ok = network.AddIPRange(other).(*models.OverlapError)
+	h.Assert(t, ok, "expected OverlapError")
+	_, ok = other.SetNetwork(network).(*models.OverlapError)
+	h.Assert(t, ok, "expected OverlapError")
+	_, ok = network.SetIPRanges([]*models.IPRange{iprange, other}).(*models.OverlapError)
+	h.Assert(t, ok, "expected OverlapError")
+
+	// Cleanup
+	h.Ok(t, network.RemoveIPRange(iprange))
+	h.Ok(t, network.Delete())
+	h.Ok(t, other.Delete())
+	h.Ok(t, iprange.Delete())
+}
+
+func TestIPRangesContaining(t *testing.T) {
+	// Prep
+	iprange := createIPRange(t)
+	h.Ok(t, iprange.Save())
+	hypervisor := createHypervisor(t)
+	h.Ok(t, hypervisor.Save())
+	h.Ok(t, iprange.AddHypervisor(hypervisor))
+	network := createNetwork(t)
+	h.Ok(t, network.Save())
+	h.Ok(t, iprange.SetNetwork(network))
+
+	ipranges, err := models.IPRangesContaining(net.ParseIP("192.168.1.50"))
+	h.Ok(t, err)
+	h.Equals(t, 1, len(ipranges))
+	h.Assert(t, ipranges[0].Network != nil, "nil network")
+	h.Equals(t, 1, len(ipranges[0].Hypervisors))
+
+	ipranges, err = models.IPRangesContaining(net.ParseIP("10.0.0.1"))
+	h.Ok(t, err)
+	h.Equals(t, 0, len(ipranges))
+
+	// Cleanup
+	h.Ok(t, iprange.RemoveNetwork(network))
+	h.Ok(t, network.Delete())
+	h.Ok(t, iprange.RemoveHypervisor(hypervisor))
+	h.Ok(t, hypervisor.Delete())
+	h.Ok(t, iprange.Delete())
+}
+
+func TestIPRangeSLAACAllocations(t *testing.T) {
+	// Prep
+	iprange := createIPv6Range(t, models.IPRangeModeSLAAC)
+	h.Ok(t, iprange.Save())
+
+	// A MAC is required
+	h.Equals(t, models.ErrNoMAC, iprange.Allocate(models.NewIPAllocation()))
+
+	// The address is derived from the MAC
+	allocation := models.NewIPAllocation()
+	allocation.MAC, _ = net.ParseMAC("52:54:00:12:34:56")
+	h.Ok(t, iprange.Allocate(allocation))
+	h.Equals(t, "2001:db8::5054:ff:fe12:3456", allocation.IP.String())
+
+	// Any other requested address is refused
+	other := models.NewIPAllocation()
+	other.MAC, _ = net.ParseMAC("52:54:00:12:34:57")
+	other.IP = net.ParseIP("2001:db8::200")
+	h.Equals(t, models.ErrIPNotSLAAC, iprange.Allocate(other))
+
+	// Cleanup
+	h.Ok(t, iprange.Release(allocation.IP))
+	h.Ok(t, iprange.Delete())
+}
@@ -0,0 +1,155 @@
+package models
+
+import (
+	"encoding/json"
+	"math/big"
+
+	"github.com/mistifyio/mistify-operator-admin/db"
+)
+
+type (
+	// IPUsage describes how many addresses in one or more ipranges are in use.
+	// Counts are arbitrary precision to accommodate IPv6 sized ranges.
+	IPUsage struct {
+		Total       *big.Int
+		Allocated   *big.Int
+		Reserved    *big.Int
+		Free        *big.Int
+		Hypervisors map[string]*big.Int // Allocated count by hypervisor id
+		IPRanges    map[string]*IPUsage // Usage by iprange id, for networks
+	}
+
+	// ipUsageData is a middle-man for JSON marshalling. Counts are written as
+	// decimal strings so that clients do not lose precision.
+	ipUsageData struct {
+		Total       string              `json:"total"`
+		Allocated   string              `json:"allocated"`
+		Reserved    string              `json:"reserved"`
+		Free        string              `json:"free"`
+		Hypervisors map[string]string   `json:"hypervisors"`
+		IPRanges    map[string]*IPUsage `json:"ipranges,omitempty"`
+	}
+)
+
+// exportData marshals the usage object into the middle-man structure
+func (usage *IPUsage) exportData() *ipUsageData {
+	hypervisors := make(map[string]string)
+	for id, count := range usage.Hypervisors {
+		hypervisors[id] = count.String()
+	}
+	return &ipUsageData{
+		Total:       usage.Total.String(),
+		Allocated:   usage.Allocated.String(),
+		Reserved:    usage.Reserved.String(),
+		Free:        usage.Free.String(),
+		Hypervisors: hypervisors,
+		IPRanges:    usage.IPRanges,
+	}
+}
+
+// MarshalJSON marshals a usage object into JSON
+func (usage IPUsage) MarshalJSON() ([]byte, error) {
+	return json.Marshal(usage.exportData())
+}
+
+// add sums another usage object into the usage object
+func (usage *IPUsage) add(other *IPUsage) {
+	usage.Total.Add(usage.Total, other.Total)
+	usage.Allocated.Add(usage.Allocated, other.Allocated)
+	usage.Reserved.Add(usage.Reserved, other.Reserved)
+	usage.Free.Add(usage.Free, other.Free)
+	for id, count := range other.Hypervisors {
+		if _, ok := usage.Hypervisors[id]; !ok {
+			usage.Hypervisors[id] = new(big.Int)
+		}
+		usage.Hypervisors[id].Add(usage.Hypervisors[id], count)
+	}
+}
+
+// newIPUsage creates and initializes a new, zeroed usage object
+func newIPUsage() *IPUsage {
+	return &IPUsage{
+		Total:       new(big.Int),
+		Allocated:   new(big.Int),
+		Reserved:    new(big.Int),
+		Free:        new(big.Int),
+		Hypervisors: make(map[string]*big.Int),
+	}
+}
+
+// Usage calculates how many of the iprange's addresses are allocated, reserved,
+// and free, with a breakdown of allocations by related hypervisor
+func (iprange *IPRange) Usage() (*IPUsage, error) {
+	d, err := db.Connect(nil)
+	if err != nil {
+		return nil, err
+	}
+	usage := newIPUsage()
+	usage.Total = ipCount(iprange.Start, iprange.End)
+
+	sql := `
+	SELECT count(*)
+	FROM iprange_allocations
+	WHERE iprange_id = $1
+	AND ip BETWEEN $2::inet AND $3::inet
+	`
+	startIP, endIP := fmtString(iprange.Start), fmtString(iprange.End)
+	var allocated int64
+	if err := d.QueryRow(sql, iprange.ID, startIP, endIP).Scan(&allocated); err != nil {
+		return nil, err
+	}
+	blocked, err := blockedIntervals(d, iprange.ID, startIP, endIP)
+	if err != nil {
+		return nil, err
+	}
+	// Reserved addresses that are also allocated count as allocated
+	unavailable := blockedCount(iprange.Start, iprange.End, blocked)
+	usage.Allocated.SetInt64(allocated)
+	usage.Reserved.Sub(unavailable, usage.Allocated)
+	usage.Free.Sub(usage.Total, unavailable)
+
+	sql = `
+	SELECT hi.hypervisor_id, count(a.ip)
+	FROM hypervisors_ipranges hi
+	LEFT JOIN iprange_allocations a
+		ON a.iprange_id = hi.iprange_id AND a.hypervisor_id = hi.hypervisor_id
+	WHERE hi.iprange_id = $1
+	GROUP BY hi.hypervisor_id
+	`
+	rows, err := d.Query(sql, iprange.ID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id string
+		var count int64
+		if err := rows.Scan(&id, &count); err != nil {
+			return nil, err
+		}
+		usage.Hypervisors[id] = big.NewInt(count)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return usage, nil
+}
+
+// Usage calculates the combined usage of the network's ipranges, along with
+// the usage of each iprange
+func (network *Network) Usage() (*IPUsage, error) {
+	if err := network.LoadIPRanges(); err != nil {
+		return nil, err
+	}
+	usage := newIPUsage()
+	usage.IPRanges = make(map[string]*IPUsage)
+	for _, iprange := range network.IPRanges {
+		iprangeUsage, err := iprange.Usage()
+		if err != nil {
+			return nil, err
+		}
+		usage.add(iprangeUsage)
+		usage.IPRanges[iprange.ID] = iprangeUsage
+	}
+	return usage, nil
+}
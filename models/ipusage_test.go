@@ -0,0 +1,72 @@
+package models_test
+
+import (
+	"encoding/json"
+	"math/big"
+	"net"
+	"testing"
+
+	h "github.com/bakins/test-helpers"
+	"github.com/mistifyio/mistify-operator-admin/models"
+)
+
+func TestIPUsageMarshalJSON(t *testing.T) {
+	total, _ := new(big.Int).SetString("18446744073709551616", 10)
+	usage := &models.IPUsage{
+		Total:       total,
+		Allocated:   big.NewInt(1),
+		Reserved:    big.NewInt(0),
+		Free:        new(big.Int).Sub(total, big.NewInt(1)),
+		Hypervisors: map[string]*big.Int{},
+	}
+	b, err := usage.MarshalJSON()
+	h.Ok(t, err)
+
+	var data map[string]interface{}
+	h.Ok(t, json.Unmarshal(b, &data))
+	h.Equals(t, "18446744073709551616", data["total"])
+	h.Equals(t, "18446744073709551615", data["free"])
+}
+
+func TestIPRangeUsage(t *testing.T) {
+	// Prep
+	iprange := createIPRange(t)
+	h.Ok(t, iprange.Save())
+	hypervisor := createHypervisor(t)
+	h.Ok(t, hypervisor.Save())
+	h.Ok(t, iprange.AddHypervisor(hypervisor))
+	network := createNetwork(t)
+	h.Ok(t, network.Save())
+	h.Ok(t, network.AddIPRange(iprange))
+
+	allocation := models.NewIPAllocation()
+	allocation.HypervisorID = hypervisor.ID
+	h.Ok(t, iprange.Allocate(allocation))
+
+	// The hypervisor's own address is within the pool and reserved
+	h.Equals(t, models.ErrIPReserved, iprange.Allocate(&models.IPAllocation{
+		IP:       net.ParseIP("192.168.1.20"),
+		Metadata: map[string]string{},
+	}))
+
+	usage, err := iprange.Usage()
+	h.Ok(t, err)
+	h.Equals(t, "245", usage.Total.String())
+	h.Equals(t, "1", usage.Allocated.String())
+	h.Equals(t, "1", usage.Reserved.String())
+	h.Equals(t, "243", usage.Free.String())
+	h.Equals(t, "1", usage.Hypervisors[hypervisor.ID].String())
+
+	networkUsage, err := network.Usage()
+	h.Ok(t, err)
+	h.Equals(t, usage.Free.String(), networkUsage.Free.String())
+	h.Equals(t, 1, len(networkUsage.IPRanges))
+
+	// Cleanup
+	h.Ok(t, iprange.Release(allocation.IP))
+	h.Ok(t, network.RemoveIPRange(iprange))
+	h.Ok(t, network.Delete())
+	h.Ok(t, iprange.RemoveHypervisor(hypervisor))
+	h.Ok(t, hypervisor.Delete())
+	h.Ok(t, iprange.Delete())
+}
@@ -1,6 +1,10 @@
 package models
 
-import "fmt"
+import (
+	"database/sql"
+	"fmt"
+	"net"
+)
 
 func fmtString(s fmt.Stringer) string {
 	if s != nil {
@@ -8,3 +12,33 @@ func fmtString(s fmt.Stringer) string {
 	}
 	return ""
 }
+
+// fmtIPs converts addresses to strings, returning an empty rather than nil
+// array for no addresses
+func fmtIPs(ips []net.IP) []string {
+	strs := make([]string, len(ips))
+	for i, ip := range ips {
+		strs[i] = fmtString(ip)
+	}
+	return strs
+}
+
+// parseIPs converts strings to addresses. Invalid addresses are left nil for
+// Validate to catch.
+func parseIPs(strs []string) []net.IP {
+	ips := make([]net.IP, len(strs))
+	for i, str := range strs {
+		ips[i] = net.ParseIP(str)
+	}
+	return ips
+}
+
+// nullInt converts an int into a database value, treating 0 as NULL
+func nullInt(i int) sql.NullInt64 {
+	return sql.NullInt64{Int64: int64(i), Valid: i != 0}
+}
+
+// nullString converts a string into a database value, treating "" as NULL
+func nullString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
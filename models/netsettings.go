@@ -0,0 +1,82 @@
+package models
+
+import (
+	"net"
+	"strings"
+
+	"github.com/hashicorp/go-multierror"
+)
+
+// maxDomainLength is the longest a domain name may be, not counting a
+// trailing dot
+const maxDomainLength = 253
+
+// validateNetSettings checks the guest network settings shared by networks
+// and ipranges, appending any problems to results
+func validateNetSettings(results *multierror.Error, dnsServers []net.IP, searchDomain string, mtu int, routes []*Route) *multierror.Error {
+	for _, ip := range dnsServers {
+		if ip == nil {
+			results = multierror.Append(results, ErrBadDNSServer)
+			break
+		}
+	}
+	if searchDomain != "" && !validDomainName(searchDomain) {
+		results = multierror.Append(results, ErrBadSearchDomain)
+	}
+	// 68 is the smallest MTU every IPv4 host must accept
+	if mtu != 0 && (mtu < 68 || mtu > 65535) {
+		results = multierror.Append(results, ErrBadMTU)
+	}
+	for _, route := range routes {
+		if route == nil || route.Validate() != nil {
+			results = multierror.Append(results, ErrBadRoute)
+			break
+		}
+	}
+	return results
+}
+
+// validDomainName returns whether name is a syntactically valid domain name
+func validDomainName(name string) bool {
+	name = strings.TrimSuffix(name, ".")
+	if name == "" || len(name) > maxDomainLength {
+		return false
+	}
+	for _, label := range strings.Split(name, ".") {
+		if len(label) == 0 || len(label) > 63 {
+			return false
+		}
+		if label[0] == '-' || label[len(label)-1] == '-' {
+			return false
+		}
+		for _, c := range label {
+			if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-') {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// dnsServersOfFamily returns the DNS servers of the same IP version as family
+func dnsServersOfFamily(dnsServers []net.IP, family net.IP) []net.IP {
+	var results []net.IP
+	for _, ip := range dnsServers {
+		if ipSameFamily(ip, family) {
+			results = append(results, ip)
+		}
+	}
+	return results
+}
+
+// routesOfFamily returns the routes whose destination and gateway are of the
+// same IP version as family
+func routesOfFamily(routes []*Route, family net.IP) []*Route {
+	var results []*Route
+	for _, route := range routes {
+		if route != nil && ipSameFamily(route.Destination.IP, family) && ipSameFamily(route.Gateway, family) {
+			results = append(results, route)
+		}
+	}
+	return results
+}
@@ -3,20 +3,51 @@ package models
 import (
 	"database/sql"
 	"encoding/json"
+	"fmt"
 	"io"
+	"net"
+	"sort"
+	"strings"
 
 	"code.google.com/p/go-uuid/uuid"
 	"github.com/hashicorp/go-multierror"
+	"github.com/lib/pq"
 	"github.com/mistifyio/mistify-operator-admin/db"
 )
 
-// Network describes a set of ipranges
-type Network struct {
-	ID       string            `json:"id"`
-	Name     string            `json:"name"`
-	Metadata map[string]string `json:"metadata"`
-	IPRanges []*IPRange        `json:"-"`
-}
+type (
+	// Network describes a set of ipranges
+	Network struct {
+		ID           string            `json:"id"`
+		Name         string            `json:"name"`
+		DNSServers   []net.IP          `json:"dns_servers"`
+		SearchDomain string            `json:"search_domain"`
+		VLAN         int               `json:"vlan"`
+		MTU          int               `json:"mtu"`
+		Routes       []*Route          `json:"routes"`
+		Metadata     map[string]string `json:"metadata"`
+		IPRanges     []*IPRange        `json:"-"`
+	}
+
+	// Segment is a dual-stack pair of ipranges within a network
+	Segment struct {
+		Name string   `json:"name"`
+		IPv4 *IPRange `json:"ipv4"`
+		IPv6 *IPRange `json:"ipv6"`
+	}
+
+	// networkData is a middle-man for JSON and database (un)marshalling
+	networkData struct {
+		ID           string            `json:"id"`
+		Name         string            `json:"name"`
+		DNSServers   []string          `json:"dns_servers"`
+		SearchDomain string            `json:"search_domain"`
+		VLAN         int               `json:"vlan"`
+		MTU          int               `json:"mtu"`
+		Routes       []*Route          `json:"routes"`
+		Metadata     map[string]string `json:"metadata"`
+	}
+)
 
 // id returns the id, required by the relatable interface
 func (network *Network) id() string {
@@ -29,6 +60,48 @@ func (network *Network) pkeyName() string {
 	return "network_id"
 }
 
+// importData unmarshals the middle-man structure into a network object
+func (network *Network) importData(data *networkData) {
+	network.ID = data.ID
+	network.Name = data.Name
+	network.DNSServers = parseIPs(data.DNSServers)
+	network.SearchDomain = data.SearchDomain
+	network.VLAN = data.VLAN
+	network.MTU = data.MTU
+	network.Routes = data.Routes
+	network.Metadata = data.Metadata
+}
+
+// exportData marshals the network object into the middle-man structure
+func (network *Network) exportData() *networkData {
+	return &networkData{
+		ID:           network.ID,
+		Name:         network.Name,
+		DNSServers:   fmtIPs(network.DNSServers),
+		SearchDomain: network.SearchDomain,
+		VLAN:         network.VLAN,
+		MTU:          network.MTU,
+		Routes:       nonNilRoutes(network.Routes),
+		Metadata:     network.Metadata,
+	}
+}
+
+// UnmarshalJSON unmarshals JSON into a network object. Properties missing from
+// the JSON are left as they are.
+func (network *Network) UnmarshalJSON(b []byte) error {
+	data := network.exportData()
+	if err := json.Unmarshal(b, data); err != nil {
+		return err
+	}
+	network.importData(data)
+	return nil
+}
+
+// MarshalJSON marshals a network object into JSON
+func (network Network) MarshalJSON() ([]byte, error) {
+	return json.Marshal(network.exportData())
+}
+
 // Validate ensures the network properties are set correctly
 func (network *Network) Validate() error {
 	var results *multierror.Error
@@ -41,6 +114,10 @@ func (network *Network) Validate() error {
 	if network.Name == "" {
 		results = multierror.Append(results, ErrNoName)
 	}
+	if network.VLAN != 0 && (network.VLAN < 1 || network.VLAN > 4094) {
+		results = multierror.Append(results, ErrBadVLAN)
+	}
+	results = validateNetSettings(results, network.DNSServers, network.SearchDomain, network.MTU, network.Routes)
 	if network.Metadata == nil {
 		results = multierror.Append(results, ErrNilMetadata)
 	}
@@ -60,32 +137,54 @@ func (network *Network) Save() error {
 	// See: http://stackoverflow.com/a/8702291
 	// And: http://dba.stackexchange.com/a/78535
 	sql := `
-	WITH new_values (network_id, name, metadata) as (
-		VALUES ($1::uuid, $2, $3::json)
+	WITH new_values (network_id, name, dns_servers, search_domain, vlan, mtu, routes, metadata) as (
+		VALUES ($1::uuid, $2, $3::json, $4, $5::integer, $6::integer, $7::json, $8::json)
 	),
 	upsert as (
 		UPDATE networks n SET
 			name = nv.name,
+			dns_servers = nv.dns_servers,
+			search_domain = nv.search_domain,
+			vlan = nv.vlan,
+			mtu = nv.mtu,
+			routes = nv.routes,
 			metadata = nv.metadata
 		FROM new_values nv
 		WHERE n.network_id = nv.network_id
 		RETURNING nv.network_id
 	)
 	INSERT INTO networks
-		(network_id, name, metadata)
-	SELECT network_id, name, metadata
+		(network_id, name, dns_servers, search_domain, vlan, mtu, routes, metadata)
+	SELECT network_id, name, dns_servers, search_domain, vlan, mtu, routes, metadata
 	FROM new_values nv
 	WHERE NOT EXISTS (SELECT 1 FROM upsert u WHERE nv.network_id = u.network_id)
 	`
-	metadata, err := json.Marshal(network.Metadata)
+	data := network.exportData()
+	dnsServers, err := json.Marshal(data.DNSServers)
+	if err != nil {
+		return err
+	}
+	routes, err := json.Marshal(data.Routes)
+	if err != nil {
+		return err
+	}
+	metadata, err := json.Marshal(data.Metadata)
 	if err != nil {
 		return err
 	}
 	_, err = d.Exec(sql,
-		network.ID,
-		network.Name,
+		data.ID,
+		data.Name,
+		string(dnsServers),
+		data.SearchDomain,
+		nullInt(data.VLAN),
+		nullInt(data.MTU),
+		string(routes),
 		string(metadata),
 	)
+	if pqErr, ok := err.(*pq.Error); ok && pqErr.Constraint == "networks_vlan_key" {
+		return ErrVLANInUse
+	}
 	return err
 }
 
@@ -107,7 +206,7 @@ func (network *Network) Load() error {
 		return err
 	}
 	sql := `
-	SELECT network_id, name, metadata
+	SELECT network_id, name, dns_servers, search_domain, vlan, mtu, routes, metadata
 	FROM networks
 	WHERE network_id = $1
 	`
@@ -125,16 +224,35 @@ func (network *Network) Load() error {
 
 // fromRows unmarshals a database query result row into the network object
 func (network *Network) fromRows(rows *sql.Rows) error {
-	var metadata string
+	var dnsServers, routes, metadata string
+	var vlan, mtu sql.NullInt64
+	data := &networkData{}
 	err := rows.Scan(
-		&network.ID,
-		&network.Name,
+		&data.ID,
+		&data.Name,
+		&dnsServers,
+		&data.SearchDomain,
+		&vlan,
+		&mtu,
+		&routes,
 		&metadata,
 	)
 	if err != nil {
 		return err
 	}
-	return json.Unmarshal([]byte(metadata), &network.Metadata)
+	data.VLAN = int(vlan.Int64)
+	data.MTU = int(mtu.Int64)
+	if err := json.Unmarshal([]byte(dnsServers), &data.DNSServers); err != nil {
+		return err
+	}
+	if err := json.Unmarshal([]byte(routes), &data.Routes); err != nil {
+		return err
+	}
+	if err := json.Unmarshal([]byte(metadata), &data.Metadata); err != nil {
+		return err
+	}
+	network.importData(data)
+	return nil
 }
 
 // Decode unmarshals JSON into the network object
@@ -165,9 +283,59 @@ func (network *Network) LoadIPRanges() error {
 	return nil
 }
 
+// Segments groups the network's ipranges into their dual-stack segments,
+// sorted by name. Ipranges without a segment are left out.
+func (network *Network) Segments() ([]*Segment, error) {
+	if err := network.LoadIPRanges(); err != nil {
+		return nil, err
+	}
+	byName := make(map[string]*Segment)
+	names := make([]string, 0, len(network.IPRanges))
+	for _, iprange := range network.IPRanges {
+		if iprange.Segment == "" {
+			continue
+		}
+		segment, ok := byName[iprange.Segment]
+		if !ok {
+			segment = &Segment{Name: iprange.Segment}
+			byName[iprange.Segment] = segment
+			names = append(names, iprange.Segment)
+		}
+		if iprange.IPv6() {
+			segment.IPv6 = iprange
+		} else {
+			segment.IPv4 = iprange
+		}
+	}
+	sort.Strings(names)
+	segments := make([]*Segment, len(names))
+	for i, name := range names {
+		segments[i] = byName[name]
+	}
+	return segments, nil
+}
+
 // AddIPRange adds a relation to an iprange
 func (network *Network) AddIPRange(iprange *IPRange) error {
-	return AddRelation("iprange_networks", network, iprange)
+	ipranges := []*IPRange{iprange}
+	check := func() ([]string, error) {
+		return network.overlaps(ipranges, false)
+	}
+	overlaps, err := check()
+	if err != nil {
+		return err
+	}
+	if len(overlaps) > 0 {
+		return &OverlapError{IDs: overlaps}
+	}
+	conflicts, err := network.segmentConflicts(ipranges, false)
+	if err != nil {
+		return err
+	}
+	if len(conflicts) > 0 {
+		return ErrSegmentInUse
+	}
+	return segmentError(overlapError(AddRelation("iprange_networks", network, iprange), check))
 }
 
 // RemoveIPRange removes a relation with an iprange
@@ -181,16 +349,86 @@ func (network *Network) SetIPRanges(ipranges []*IPRange) error {
 	if len(ipranges) == 0 {
 		return ClearRelations("iprange_networks", network)
 	}
+	check := func() ([]string, error) {
+		return network.overlaps(ipranges, true)
+	}
+	overlaps, err := check()
+	if err != nil {
+		return err
+	}
+	if len(overlaps) > 0 {
+		return &OverlapError{IDs: overlaps}
+	}
+	conflicts, err := network.segmentConflicts(ipranges, true)
+	if err != nil {
+		return err
+	}
+	if len(conflicts) > 0 {
+		return ErrSegmentInUse
+	}
 	relatables := make([]relatable, len(ipranges))
 	for i, iprange := range ipranges {
 		relatables[i] = relatable(iprange)
 	}
 	if err := SetRelations("iprange_networks", network, relatables); err != nil {
-		return err
+		return segmentError(overlapError(err, check))
 	}
 	return network.LoadIPRanges()
 }
 
+// overlaps retrieves the ids of ipranges whose cidr overlaps the cidr of any
+// of the given ipranges, either among the given ipranges themselves or, unless
+// they are replacing the network's current ipranges, among those already
+// related to the network
+func (network *Network) overlaps(ipranges []*IPRange, replace bool) ([]string, error) {
+	return network.conflicts(ipranges, replace, "other.cidr && i.cidr")
+}
+
+// segmentConflicts retrieves the ids of ipranges of the same IP version and
+// in the same segment as any of the given ipranges, in the same manner as
+// overlaps. A segment holds at most one IPv4 and one IPv6 iprange.
+func (network *Network) segmentConflicts(ipranges []*IPRange, replace bool) ([]string, error) {
+	return network.conflicts(ipranges, replace, "i.segment <> '' AND other.segment = i.segment AND family(other.cidr) = family(i.cidr)")
+}
+
+// conflicts retrieves the ids of ipranges that conflict with any of the given
+// ipranges, where i is one of the given ipranges and other is the conflicting
+// iprange in the condition
+func (network *Network) conflicts(ipranges []*IPRange, replace bool, condition string) ([]string, error) {
+	d, err := db.Connect(nil)
+	if err != nil {
+		return nil, err
+	}
+	placeholders := make([]string, len(ipranges))
+	values := make([]interface{}, len(ipranges)+2)
+	values[0] = network.ID
+	values[1] = replace
+	for i, iprange := range ipranges {
+		placeholders[i] = fmt.Sprintf("$%d::uuid", i+3)
+		values[i+2] = interface{}(iprange.ID)
+	}
+	sql := `
+	SELECT DISTINCT other.iprange_id
+	FROM ipranges i
+	JOIN ipranges other ON other.iprange_id <> i.iprange_id AND %s
+	WHERE i.iprange_id IN (%s)
+	AND (
+		other.iprange_id IN (%s)
+		OR (
+			NOT $2
+			AND other.iprange_id IN (SELECT iprange_id FROM iprange_networks WHERE network_id = $1)
+		)
+	)
+	ORDER BY other.iprange_id asc
+	`
+	in := strings.Join(placeholders, ",")
+	rows, err := d.Query(fmt.Sprintf(sql, condition, in, in), values...)
+	if err != nil {
+		return nil, err
+	}
+	return idsFromRows(rows)
+}
+
 // NewID generates a new uuid ID
 func (network *Network) NewID() string {
 	network.ID = uuid.New()
@@ -224,7 +462,7 @@ func ListNetworks() ([]*Network, error) {
 		return nil, err
 	}
 	sql := `
-	SELECT network_id, name, metadata
+	SELECT network_id, name, dns_servers, search_domain, vlan, mtu, routes, metadata
 	FROM networks
 	ORDER BY network_id
 	`
@@ -250,7 +488,7 @@ func NetworksByIPRange(iprange *IPRange) ([]*Network, error) {
 		return nil, err
 	}
 	sql := `
-	SELECT n.network_id, n.name, n.metadata
+	SELECT n.network_id, n.name, n.dns_servers, n.search_domain, n.vlan, n.mtu, n.routes, n.metadata
 	FROM networks n
 	JOIN iprange_networks i_n ON n.network_id = i_n.network_id
 	WHERE i_n.iprange_id = $1
@@ -1,6 +1,7 @@
 package models_test
 
 import (
+	"net"
 	"strings"
 	"testing"
 
@@ -13,6 +14,13 @@ import (
 var networkJSON = `{
 	"id": "ebf3bfd5-9915-4ed1-bcb3-117bb48b155d",
 	"name": "foobar",
+	"dns_servers": ["192.168.1.2", "192.168.1.3"],
+	"search_domain": "example.com",
+	"vlan": 100,
+	"mtu": 9000,
+	"routes": [
+		{"destination": "10.0.0.0/8", "gateway": "192.168.1.1"}
+	],
 	"metadata": {
 		"foo": "bar"
 	}
@@ -28,6 +36,14 @@ func createNetwork(t *testing.T) *models.Network {
 func checkNetworkValues(t *testing.T, network *models.Network) {
 	h.Equals(t, "ebf3bfd5-9915-4ed1-bcb3-117bb48b155d", network.ID)
 	h.Equals(t, "foobar", network.Name)
+	h.Equals(t, 2, len(network.DNSServers))
+	h.Equals(t, "192.168.1.2", network.DNSServers[0].String())
+	h.Equals(t, "example.com", network.SearchDomain)
+	h.Equals(t, 100, network.VLAN)
+	h.Equals(t, 9000, network.MTU)
+	h.Equals(t, 1, len(network.Routes))
+	h.Equals(t, "10.0.0.0/8", network.Routes[0].Destination.String())
+	h.Equals(t, "192.168.1.1", network.Routes[0].Gateway.String())
 	h.Equals(t, map[string]string{"foo": "bar"}, network.Metadata)
 }
 
@@ -78,11 +94,69 @@ func TestNetworkValidate(t *testing.T) {
 	h.Ok(t, err)
 }
 
+func TestNetworkDecodePartial(t *testing.T) {
+	network := createNetwork(t)
+	h.Ok(t, network.Decode(strings.NewReader(`{"mtu": 1500}`)))
+	h.Equals(t, 1500, network.MTU)
+	h.Equals(t, 100, network.VLAN)
+	h.Equals(t, "example.com", network.SearchDomain)
+}
+
+func TestNetworkValidateSettings(t *testing.T) {
+	network := createNetwork(t)
+	h.Ok(t, network.Validate())
+
+	for _, vlan := range []int{-1, 4095} {
+		network.VLAN = vlan
+		h.Assert(t, errContains(models.ErrBadVLAN, network.Validate()), "expected ErrBadVLAN")
+	}
+	network.VLAN = 0
+	h.Ok(t, network.Validate())
+
+	for _, mtu := range []int{67, 65536} {
+		network.MTU = mtu
+		h.Assert(t, errContains(models.ErrBadMTU, network.Validate()), "expected ErrBadMTU")
+	}
+	network.MTU = 0
+	h.Ok(t, network.Validate())
+
+	for _, domain := range []string{"-foo.com", "foo..com", "foo_bar.com", strings.Repeat("a", 64) + ".com"} {
+		network.SearchDomain = domain
+		h.Assert(t, errContains(models.ErrBadSearchDomain, network.Validate()), "expected ErrBadSearchDomain")
+	}
+	network.SearchDomain = "foo.example.com."
+	h.Ok(t, network.Validate())
+
+	h.Ok(t, network.Decode(strings.NewReader(`{"dns_servers": ["foobar"]}`)))
+	h.Assert(t, errContains(models.ErrBadDNSServer, network.Validate()), "expected ErrBadDNSServer")
+	network.DNSServers = nil
+	h.Ok(t, network.Validate())
+
+	h.Ok(t, network.Decode(strings.NewReader(`{"routes": [{"destination": "fd00::/8", "gateway": "192.168.1.1"}]}`)))
+	h.Assert(t, errContains(models.ErrBadRoute, network.Validate()), "expected ErrBadRoute")
+	h.Ok(t, network.Decode(strings.NewReader(`{"routes": [{"destination": "foobar", "gateway": "192.168.1.1"}]}`)))
+	h.Assert(t, errContains(models.ErrBadRoute, network.Validate()), "expected ErrBadRoute")
+}
+
 func TestNetworkSave(t *testing.T) {
 	network := createNetwork(t)
 	h.Ok(t, network.Save())
 }
 
+func TestNetworkVLANInUse(t *testing.T) {
+	network := createNetwork(t)
+	h.Ok(t, network.Save())
+
+	network2 := createNetwork(t)
+	network2.NewID()
+	h.Equals(t, models.ErrVLANInUse, network2.Save())
+	network2.VLAN = network.VLAN + 1
+	h.Ok(t, network2.Save())
+
+	h.Ok(t, network2.Delete())
+	h.Ok(t, network.Delete())
+}
+
 func TestNetworkDelete(t *testing.T) {
 	network := createNetwork(t)
 	h.Ok(t, network.Delete())
@@ -159,3 +233,44 @@ func TestNetworkIPRangeRelations(t *testing.T) {
 	h.Ok(t, iprange.Delete())
 	h.Ok(t, network.Delete())
 }
+
+func TestNetworkSegments(t *testing.T) {
+	// Prep
+	network := createNetwork(t)
+	h.Ok(t, network.Save())
+	ipv4 := createIPRange(t)
+	ipv4.Segment = "foo"
+	h.Ok(t, ipv4.Save())
+	ipv6 := createIPv6Range(t, "")
+	ipv6.NewID()
+	ipv6.Segment = "foo"
+	h.Ok(t, ipv6.Save())
+	h.Ok(t, network.SetIPRanges([]*models.IPRange{ipv4, ipv6}))
+
+	segments, err := network.Segments()
+	h.Ok(t, err)
+	h.Equals(t, 1, len(segments))
+	h.Equals(t, "foo", segments[0].Name)
+	h.Equals(t, ipv4.ID, segments[0].IPv4.ID)
+	h.Equals(t, ipv6.ID, segments[0].IPv6.ID)
+
+	// A segment holds one iprange of each IP version
+	_, cidr, err := net.ParseCIDR("2001:db8:1::/64")
+	h.Ok(t, err)
+	other := createIPv6Range(t, "")
+	other.NewID()
+	other.CIDR = cidr
+	other.Gateway = net.ParseIP("2001:db8:1::1")
+	other.Start = net.ParseIP("2001:db8:1::100")
+	other.End = net.ParseIP("2001:db8:1::ffff")
+	other.Segment = "foo"
+	h.Ok(t, other.Save())
+	h.Equals(t, models.ErrSegmentInUse, network.AddIPRange(other))
+
+	// Cleanup
+	h.Ok(t, network.SetIPRanges(make([]*models.IPRange, 0)))
+	h.Ok(t, other.Delete())
+	h.Ok(t, ipv6.Delete())
+	h.Ok(t, ipv4.Delete())
+	h.Ok(t, network.Delete())
+}
@@ -0,0 +1,152 @@
+package models
+
+import (
+	"math/big"
+	"sort"
+
+	"code.google.com/p/go-uuid/uuid"
+	"github.com/hashicorp/go-multierror"
+)
+
+type (
+	// PlacementConstraints narrow down the hypervisors a guest may be placed
+	// on. Unset constraints allow any hypervisor.
+	PlacementConstraints struct {
+		ZoneID       string            `json:"zone"`
+		Labels       map[string]string `json:"labels"`        // Required metadata
+		AntiAffinity []string          `json:"anti_affinity"` // Hypervisor ids to avoid
+	}
+
+	// placementCandidate is a hypervisor a guest may be placed on, along with
+	// what it is ranked by
+	placementCandidate struct {
+		hypervisor *Hypervisor
+		fit        int
+		free       *big.Int
+	}
+
+	// placementCandidates sorts candidates from most to least preferred
+	placementCandidates []*placementCandidate
+)
+
+func (candidates placementCandidates) Len() int {
+	return len(candidates)
+}
+
+func (candidates placementCandidates) Swap(i, j int) {
+	candidates[i], candidates[j] = candidates[j], candidates[i]
+}
+
+func (candidates placementCandidates) Less(i, j int) bool {
+	a, b := candidates[i], candidates[j]
+	if a.fit != b.fit {
+		return a.fit > b.fit
+	}
+	if cmp := a.free.Cmp(b.free); cmp != 0 {
+		return cmp > 0
+	}
+	return a.hypervisor.ID < b.hypervisor.ID
+}
+
+// Validate ensures the constraint properties are set correctly
+func (constraints *PlacementConstraints) Validate() error {
+	var result *multierror.Error
+	if constraints.ZoneID != "" && uuid.Parse(constraints.ZoneID) == nil {
+		result = multierror.Append(result, ErrBadZoneID)
+	}
+	for _, id := range constraints.AntiAffinity {
+		if uuid.Parse(id) == nil {
+			result = multierror.Append(result, ErrBadHypervisorID)
+			break
+		}
+	}
+	return result.ErrorOrNil()
+}
+
+// allows checks whether the constraints allow a hypervisor
+func (constraints *PlacementConstraints) allows(hypervisor *Hypervisor) bool {
+	for _, id := range constraints.AntiAffinity {
+		if id == hypervisor.ID {
+			return false
+		}
+	}
+	for key, value := range constraints.Labels {
+		if hypervisor.Metadata[key] != value {
+			return false
+		}
+	}
+	return true
+}
+
+// Place finds the hypervisors an instance of the flavor on the network may be
+// placed on, ranked from most to least preferred. Candidates are active
+// hypervisors meeting the constraints, with the capacity for at least one
+// instance of the flavor and related to an iprange of the network with free
+// addresses. They are ranked by how many instances of the flavor fit, then by
+// how many free addresses they have on the network.
+func Place(flavor *Flavor, network *Network, constraints *PlacementConstraints) ([]*Hypervisor, error) {
+	if constraints == nil {
+		constraints = &PlacementConstraints{}
+	}
+	if err := constraints.Validate(); err != nil {
+		return nil, err
+	}
+	free, err := network.freeAddresses()
+	if err != nil {
+		return nil, err
+	}
+	hypervisors, err := FilterHypervisors(&HypervisorFilter{
+		State:  HypervisorStateActive,
+		ZoneID: constraints.ZoneID,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	candidates := make(placementCandidates, 0, len(hypervisors))
+	for _, hypervisor := range hypervisors {
+		if !constraints.allows(hypervisor) {
+			continue
+		}
+		fit := hypervisor.Fit(flavor).Count
+		addresses, ok := free[hypervisor.ID]
+		if fit == 0 || !ok || addresses.Sign() == 0 {
+			continue
+		}
+		candidates = append(candidates, &placementCandidate{
+			hypervisor: hypervisor,
+			fit:        fit,
+			free:       addresses,
+		})
+	}
+	sort.Sort(candidates)
+
+	ranked := make([]*Hypervisor, len(candidates))
+	for i, candidate := range candidates {
+		ranked[i] = candidate.hypervisor
+	}
+	return ranked, nil
+}
+
+// freeAddresses sums up the free addresses of the network's ipranges by the
+// id of each hypervisor related to them
+func (network *Network) freeAddresses() (map[string]*big.Int, error) {
+	ipranges, err := IPRangesByNetwork(network)
+	if err != nil {
+		return nil, err
+	}
+	free := make(map[string]*big.Int)
+	for _, iprange := range ipranges {
+		usage, err := iprange.Usage()
+		if err != nil {
+			return nil, err
+		}
+		for id := range usage.Hypervisors {
+			if _, ok := free[id]; !ok {
+				free[id] = new(big.Int)
+			}
+			free[id].Add(free[id], usage.Free)
+		}
+	}
+	return free, nil
+}
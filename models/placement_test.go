@@ -0,0 +1,86 @@
+package models_test
+
+import (
+	"net"
+	"testing"
+
+	h "github.com/bakins/test-helpers"
+	"github.com/mistifyio/mistify-operator-admin/models"
+)
+
+func TestPlacementConstraintsValidate(t *testing.T) {
+	constraints := &models.PlacementConstraints{}
+	h.Ok(t, constraints.Validate())
+
+	constraints.ZoneID = "foobar"
+	constraints.AntiAffinity = []string{"foobar"}
+	err := constraints.Validate()
+	h.Assert(t, errContains(models.ErrBadZoneID, err), "expected ErrBadZoneID")
+	h.Assert(t, errContains(models.ErrBadHypervisorID, err), "expected ErrBadHypervisorID")
+}
+
+func TestPlace(t *testing.T) {
+	// Prep
+	flavor := createFlavor(t)
+	h.Ok(t, flavor.Save())
+	network := createNetwork(t)
+	h.Ok(t, network.Save())
+	iprange := createIPRange(t)
+	h.Ok(t, iprange.Save())
+	h.Ok(t, iprange.SetNetwork(network))
+
+	hypervisor := createHypervisor(t)
+	h.Ok(t, hypervisor.Save())
+	h.Ok(t, hypervisor.AddIPRange(iprange))
+
+	// Bigger, but not on the network
+	other := createHypervisor(t)
+	other.NewID()
+	other.MAC, _ = net.ParseMAC("01:23:45:67:89:cd")
+	other.IP = net.ParseIP("192.168.1.21")
+	other.CPU = 32
+	h.Ok(t, other.Save())
+
+	// Registered hypervisors are not candidates
+	hypervisors, err := models.Place(flavor, network, nil)
+	h.Ok(t, err)
+	h.Equals(t, 0, len(hypervisors))
+
+	h.Ok(t, hypervisor.Transition(models.HypervisorStateActive))
+	h.Ok(t, other.Transition(models.HypervisorStateActive))
+	hypervisors, err = models.Place(flavor, network, nil)
+	h.Ok(t, err)
+	h.Equals(t, 1, len(hypervisors))
+	h.Equals(t, hypervisor.ID, hypervisors[0].ID)
+
+	// Once on the network, the bigger hypervisor ranks first
+	h.Ok(t, other.AddIPRange(iprange))
+	hypervisors, err = models.Place(flavor, network, nil)
+	h.Ok(t, err)
+	h.Equals(t, 2, len(hypervisors))
+	h.Equals(t, other.ID, hypervisors[0].ID)
+
+	// Constraints
+	hypervisors, err = models.Place(flavor, network, &models.PlacementConstraints{
+		AntiAffinity: []string{other.ID},
+	})
+	h.Ok(t, err)
+	h.Equals(t, 1, len(hypervisors))
+	h.Equals(t, hypervisor.ID, hypervisors[0].ID)
+
+	hypervisors, err = models.Place(flavor, network, &models.PlacementConstraints{
+		Labels: map[string]string{"foo": "baz"},
+	})
+	h.Ok(t, err)
+	h.Equals(t, 0, len(hypervisors))
+
+	// Cleanup
+	h.Ok(t, hypervisor.SetIPRanges(make([]*models.IPRange, 0)))
+	h.Ok(t, other.SetIPRanges(make([]*models.IPRange, 0)))
+	h.Ok(t, hypervisor.Delete())
+	h.Ok(t, other.Delete())
+	h.Ok(t, iprange.RemoveNetwork(network))
+	h.Ok(t, iprange.Delete())
+	h.Ok(t, network.Delete())
+	h.Ok(t, flavor.Delete())
+}
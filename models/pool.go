@@ -0,0 +1,366 @@
+package models
+
+import (
+	"database/sql"
+	"encoding/json"
+	"io"
+	"math/big"
+	"net"
+
+	"code.google.com/p/go-uuid/uuid"
+	"github.com/hashicorp/go-multierror"
+	"github.com/mistifyio/mistify-operator-admin/db"
+)
+
+type (
+	// Pool describes a supernet that ipranges are carved out of
+	Pool struct {
+		ID       string            `json:"id"`
+		Name     string            `json:"name"`
+		CIDR     *net.IPNet        `json:"cidr"`
+		Metadata map[string]string `json:"metadata"`
+	}
+
+	// poolData is a middle-man for JSON and database (un)marshalling
+	poolData struct {
+		ID       string            `json:"id"`
+		Name     string            `json:"name"`
+		CIDR     string            `json:"cidr"`
+		Metadata map[string]string `json:"metadata"`
+	}
+)
+
+// importData unmarshals the middle-man structure into a pool object
+func (pool *Pool) importData(data *poolData) error {
+	_, cidr, err := net.ParseCIDR(data.CIDR)
+	if err != nil {
+		return err
+	}
+	pool.ID = data.ID
+	pool.Name = data.Name
+	pool.CIDR = cidr
+	pool.Metadata = data.Metadata
+	return nil
+}
+
+// exportData marshals the pool object into the middle-man structure
+func (pool *Pool) exportData() *poolData {
+	return &poolData{
+		ID:       pool.ID,
+		Name:     pool.Name,
+		CIDR:     fmtString(pool.CIDR),
+		Metadata: pool.Metadata,
+	}
+}
+
+// UnmarshalJSON unmarshals JSON into a pool object
+func (pool *Pool) UnmarshalJSON(b []byte) error {
+	data := &poolData{}
+	if err := json.Unmarshal(b, data); err != nil {
+		return err
+	}
+	return pool.importData(data)
+}
+
+// MarshalJSON marshals a pool object into JSON
+func (pool Pool) MarshalJSON() ([]byte, error) {
+	return json.Marshal(pool.exportData())
+}
+
+// Validate ensures the pool properties are set correctly
+func (pool *Pool) Validate() error {
+	var results *multierror.Error
+	if pool.ID == "" {
+		results = multierror.Append(results, ErrNoID)
+	}
+	if uuid.Parse(pool.ID) == nil {
+		results = multierror.Append(results, ErrBadID)
+	}
+	if pool.Name == "" {
+		results = multierror.Append(results, ErrNoName)
+	}
+	if pool.CIDR == nil {
+		results = multierror.Append(results, ErrNoCIDR)
+	}
+	if pool.Metadata == nil {
+		results = multierror.Append(results, ErrNilMetadata)
+	}
+	return results.ErrorOrNil()
+}
+
+// Save persists a pool to the database
+func (pool *Pool) Save() error {
+	if err := pool.Validate(); err != nil {
+		return err
+	}
+	d, err := db.Connect(nil)
+	if err != nil {
+		return err
+	}
+	// Writable CTE for an Upsert
+	// See: http://stackoverflow.com/a/8702291
+	// And: http://dba.stackexchange.com/a/78535
+	sql := `
+	WITH new_values (pool_id, name, cidr, metadata) as (
+		VALUES ($1::uuid, $2, $3::cidr, $4::json)
+	),
+	upsert as (
+		UPDATE pools p SET
+			name = nv.name,
+			cidr = nv.cidr,
+			metadata = nv.metadata
+		FROM new_values nv
+		WHERE p.pool_id = nv.pool_id
+		RETURNING p.pool_id
+	)
+	INSERT INTO pools
+		(pool_id, name, cidr, metadata)
+	SELECT pool_id, name, cidr, metadata
+	FROM new_values nv
+	WHERE NOT EXISTS (SELECT 1 FROM upsert u WHERE nv.pool_id = u.pool_id)
+	`
+	data := pool.exportData()
+	metadata, err := json.Marshal(data.Metadata)
+	if err != nil {
+		return err
+	}
+	_, err = d.Exec(sql,
+		data.ID,
+		data.Name,
+		data.CIDR,
+		string(metadata),
+	)
+	return err
+}
+
+// Delete removes a pool from the database. Ipranges carved out of the pool
+// are left as they are.
+func (pool *Pool) Delete() error {
+	d, err := db.Connect(nil)
+	if err != nil {
+		return err
+	}
+	sql := "DELETE FROM pools WHERE pool_id = $1"
+	_, err = d.Exec(sql, pool.ID)
+	return err
+}
+
+// Load retrieves a pool from the database
+func (pool *Pool) Load() error {
+	d, err := db.Connect(nil)
+	if err != nil {
+		return err
+	}
+	sql := `
+	SELECT pool_id, name, cidr, metadata
+	FROM pools
+	WHERE pool_id = $1
+	`
+	rows, err := d.Query(sql, pool.ID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	rows.Next()
+	if err := pool.fromRows(rows); err != nil {
+		return err
+	}
+	return rows.Err()
+}
+
+// fromRows unmarshals a database query result row into the pool object
+func (pool *Pool) fromRows(rows *sql.Rows) error {
+	var metadata string
+	data := &poolData{}
+	err := rows.Scan(
+		&data.ID,
+		&data.Name,
+		&data.CIDR,
+		&metadata,
+	)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal([]byte(metadata), &data.Metadata); err != nil {
+		return err
+	}
+	return pool.importData(data)
+}
+
+// Decode unmarshals JSON into the pool object
+func (pool *Pool) Decode(data io.Reader) error {
+	if err := json.NewDecoder(data).Decode(pool); err != nil {
+		return err
+	}
+	if pool.Metadata == nil {
+		pool.Metadata = make(map[string]string)
+	} else {
+		for key, value := range pool.Metadata {
+			if value == "" {
+				delete(pool.Metadata, key)
+			}
+		}
+	}
+	return nil
+}
+
+// Carve creates an iprange from the lowest subnet of the given prefix length
+// in the pool that does not overlap the cidr of any existing iprange. The
+// gateway is the first address of the subnet and the pool runs from the next
+// address to the last usable one. If a network is given, the iprange is
+// related to it. The pool row is locked for the duration of the transaction so
+// that concurrent carves are serialized.
+func (pool *Pool) Carve(prefixLength int, network *Network) (*IPRange, error) {
+	// Leave room for at least a gateway and one address in the pool
+	ones, bits := pool.CIDR.Mask.Size()
+	if prefixLength < ones || prefixLength > bits-2 {
+		return nil, ErrBadPrefixLength
+	}
+	d, err := db.Connect(nil)
+	if err != nil {
+		return nil, err
+	}
+	txn, err := d.Begin()
+	if err != nil {
+		return nil, err
+	}
+
+	var poolID string
+	lockSQL := `
+	SELECT pool_id
+	FROM pools
+	WHERE pool_id = $1
+	FOR UPDATE
+	`
+	if err := txn.QueryRow(lockSQL, pool.ID).Scan(&poolID); err != nil {
+		_ = txn.Rollback()
+		return nil, err
+	}
+
+	// Ordering by cidr also orders by starting address
+	usedSQL := `
+	SELECT cidr
+	FROM ipranges
+	WHERE cidr && $1::cidr
+	ORDER BY cidr asc
+	`
+	rows, err := txn.Query(usedSQL, fmtString(pool.CIDR))
+	if err != nil {
+		_ = txn.Rollback()
+		return nil, err
+	}
+	used := make([]*net.IPNet, 0, 1)
+	for rows.Next() {
+		var cidr string
+		if err := rows.Scan(&cidr); err != nil {
+			_ = rows.Close()
+			_ = txn.Rollback()
+			return nil, err
+		}
+		_, subnet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			_ = rows.Close()
+			_ = txn.Rollback()
+			return nil, err
+		}
+		used = append(used, subnet)
+	}
+	if err := rows.Err(); err != nil {
+		_ = txn.Rollback()
+		return nil, err
+	}
+
+	subnet := nextFreeSubnet(pool.CIDR, prefixLength, used)
+	if subnet == nil {
+		_ = txn.Rollback()
+		return nil, ErrPoolExhausted
+	}
+	iprange := NewIPRange()
+	iprange.CIDR = subnet
+	iprange.Gateway = ipNext(subnet.IP)
+	iprange.Start = ipNext(iprange.Gateway)
+	iprange.End = cidrLast(subnet)
+	if len(ipNormalize(subnet.IP)) == net.IPv4len {
+		// Leave out the broadcast address
+		iprange.End = intToIP(new(big.Int).Sub(ipToInt(iprange.End), big.NewInt(1)), net.IPv4len)
+	}
+	if err := iprange.Validate(); err != nil {
+		_ = txn.Rollback()
+		return nil, err
+	}
+	if err := iprange.save(txn); err != nil {
+		_ = txn.Rollback()
+		return nil, overlapError(err, iprange.Overlaps)
+	}
+
+	if network != nil {
+		relateSQL := `
+		INSERT INTO iprange_networks (iprange_id, network_id)
+		VALUES ($1, $2)
+		`
+		if _, err := txn.Exec(relateSQL, iprange.ID, network.ID); err != nil {
+			_ = txn.Rollback()
+			return nil, err
+		}
+		iprange.Network = network
+	}
+	if err := txn.Commit(); err != nil {
+		return nil, err
+	}
+	return iprange, nil
+}
+
+// NewID generates a new uuid ID
+func (pool *Pool) NewID() string {
+	pool.ID = uuid.New()
+	return pool.ID
+}
+
+// NewPool creates and initializes a new pool object
+func NewPool() *Pool {
+	pool := &Pool{
+		ID:       uuid.New(),
+		Metadata: make(map[string]string),
+	}
+	return pool
+}
+
+// FetchPool retrieves a pool object from the database by ID
+func FetchPool(id string) (*Pool, error) {
+	pool := &Pool{
+		ID: id,
+	}
+	if err := pool.Load(); err != nil {
+		return nil, err
+	}
+	return pool, nil
+}
+
+// ListPools retrieves an array of all pool objects from the database
+func ListPools() ([]*Pool, error) {
+	d, err := db.Connect(nil)
+	if err != nil {
+		return nil, err
+	}
+	sql := `
+	SELECT pool_id, name, cidr, metadata
+	FROM pools
+	ORDER BY pool_id
+	`
+	rows, err := d.Query(sql)
+	if err != nil {
+		return nil, err
+	}
+	pools := make([]*Pool, 0, 1)
+	for rows.Next() {
+		pool := &Pool{}
+		if err := pool.fromRows(rows); err != nil {
+			return nil, err
+		}
+		pools = append(pools, pool)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return pools, nil
+}
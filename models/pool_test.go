@@ -0,0 +1,120 @@
+package models_test
+
+import (
+	"strings"
+	"testing"
+
+	"code.google.com/p/go-uuid/uuid"
+
+	h "github.com/bakins/test-helpers"
+	"github.com/mistifyio/mistify-operator-admin/models"
+)
+
+var poolJSON = `{
+	"id": "ebf3bfd5-9915-4ed1-bcb3-117bb48b155d",
+	"name": "foobar",
+	"cidr": "10.1.0.0/16",
+	"metadata": {
+		"foo": "bar"
+	}
+}`
+
+func createPool(t *testing.T) *models.Pool {
+	r := strings.NewReader(poolJSON)
+	pool := &models.Pool{}
+	h.Ok(t, pool.Decode(r))
+	return pool
+}
+
+func checkPoolValues(t *testing.T, pool *models.Pool) {
+	h.Equals(t, "ebf3bfd5-9915-4ed1-bcb3-117bb48b155d", pool.ID)
+	h.Equals(t, "foobar", pool.Name)
+	h.Equals(t, "10.1.0.0/16", pool.CIDR.String())
+	h.Equals(t, map[string]string{"foo": "bar"}, pool.Metadata)
+}
+
+func TestNewPool(t *testing.T) {
+	pool := models.NewPool()
+	h.Assert(t, uuid.Parse(pool.ID) != nil, "missing uuid ID")
+	h.Assert(t, pool.Metadata != nil, "uninitialized metadata")
+}
+
+func TestPoolDecode(t *testing.T) {
+	pool := createPool(t)
+	checkPoolValues(t, pool)
+}
+
+func TestPoolValidate(t *testing.T) {
+	pool := &models.Pool{}
+	var err error
+
+	err = pool.Validate()
+	h.Assert(t, errContains(models.ErrNoID, err), "expected ErrNoID")
+	h.Assert(t, errContains(models.ErrBadID, err), "expected ErrBadID")
+	h.Assert(t, errContains(models.ErrNoName, err), "expected ErrNoName")
+	h.Assert(t, errContains(models.ErrNoCIDR, err), "expected ErrNoCIDR")
+	h.Assert(t, errContains(models.ErrNilMetadata, err), "expected ErrNilMetadata")
+
+	h.Ok(t, createPool(t).Validate())
+}
+
+func TestPoolMarshalJSON(t *testing.T) {
+	pool := createPool(t)
+	_, err := pool.MarshalJSON()
+	h.Ok(t, err)
+}
+
+func TestPoolLoad(t *testing.T) {
+	pool := createPool(t)
+	h.Ok(t, pool.Save())
+
+	pool2, err := models.FetchPool(pool.ID)
+	h.Ok(t, err)
+	checkPoolValues(t, pool2)
+
+	pools, err := models.ListPools()
+	h.Ok(t, err)
+	h.Equals(t, 1, len(pools))
+	h.Ok(t, pool.Delete())
+}
+
+func TestPoolCarve(t *testing.T) {
+	// Prep
+	pool := createPool(t)
+	h.Ok(t, pool.Save())
+	network := createNetwork(t)
+	h.Ok(t, network.Save())
+
+	_, err := pool.Carve(8, nil)
+	h.Equals(t, models.ErrBadPrefixLength, err)
+	_, err = pool.Carve(31, nil)
+	h.Equals(t, models.ErrBadPrefixLength, err)
+
+	first, err := pool.Carve(24, network)
+	h.Ok(t, err)
+	h.Equals(t, "10.1.0.0/24", first.CIDR.String())
+	h.Equals(t, "10.1.0.1", first.Gateway.String())
+	h.Equals(t, "10.1.0.2", first.Start.String())
+	h.Equals(t, "10.1.0.254", first.End.String())
+	h.Ok(t, first.LoadNetwork())
+	h.Equals(t, network.ID, first.Network.ID)
+
+	second, err := pool.Carve(23, nil)
+	h.Ok(t, err)
+	h.Equals(t, "10.1.2.0/23", second.CIDR.String())
+
+	third, err := pool.Carve(24, nil)
+	h.Ok(t, err)
+	h.Equals(t, "10.1.1.0/24", third.CIDR.String())
+
+	_, err = pool.Carve(16, nil)
+	h.Equals(t, models.ErrPoolExhausted, err)
+
+	// Cleanup
+	h.Ok(t, first.RemoveNetwork(network))
+	h.Ok(t, first.Delete())
+	h.Ok(t, second.Delete())
+	h.Ok(t, third.Delete())
+	h.Ok(t, network.Delete())
+	h.Ok(t, pool.Delete())
+}
@@ -326,6 +326,33 @@ func ProjectsByPermission(permission *Permission) ([]*Project, error) {
 	return projects, nil
 }
 
+// ProjectsByFlavor retrieves an array of projects related to a flavor
+func ProjectsByFlavor(flavor *Flavor) ([]*Project, error) {
+	d, err := db.Connect(nil)
+	if err != nil {
+		return nil, err
+	}
+	sql := `
+	SELECT p.project_id, p.name, p.metadata
+	FROM projects p
+	JOIN flavors_projects fp ON p.project_id = fp.project_id
+	WHERE fp.flavor_id = $1
+	ORDER BY project_id asc
+	`
+	rows, err := d.Query(sql, flavor.ID)
+	if err != nil {
+		return nil, err
+	}
+	projects, err := projectsFromRows(rows)
+	if err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return projects, nil
+}
+
 // projectsFromRows unmarshals multiple query rows into an array of projects
 func projectsFromRows(rows *sql.Rows) ([]*Project, error) {
 	projects := make([]*Project, 0, 1)
@@ -0,0 +1,258 @@
+package models
+
+import (
+	"database/sql"
+	"encoding/json"
+	"io"
+
+	"code.google.com/p/go-uuid/uuid"
+	"github.com/hashicorp/go-multierror"
+	"github.com/mistifyio/mistify-operator-admin/db"
+)
+
+// Rack describes a rack of machines within a zone, the bottom of the location
+// hierarchy that hypervisors are placed in
+type Rack struct {
+	ID       string            `json:"id"`
+	ZoneID   string            `json:"zone"`
+	Name     string            `json:"name"`
+	Metadata map[string]string `json:"metadata"`
+	Config   ConfigOverrides   `json:"config"`
+}
+
+// Validate ensures the rack properties are set correctly
+func (rack *Rack) Validate() error {
+	var results *multierror.Error
+	if rack.ID == "" {
+		results = multierror.Append(results, ErrNoID)
+	}
+	if uuid.Parse(rack.ID) == nil {
+		results = multierror.Append(results, ErrBadID)
+	}
+	if uuid.Parse(rack.ZoneID) == nil {
+		results = multierror.Append(results, ErrBadZoneID)
+	}
+	if rack.Name == "" {
+		results = multierror.Append(results, ErrNoName)
+	}
+	if rack.Metadata == nil {
+		results = multierror.Append(results, ErrNilMetadata)
+	}
+	return results.ErrorOrNil()
+}
+
+// Save persists a rack to the database
+func (rack *Rack) Save() error {
+	if err := rack.Validate(); err != nil {
+		return err
+	}
+	d, err := db.Connect(nil)
+	if err != nil {
+		return err
+	}
+	// Writable CTE for an Upsert
+	// See: http://stackoverflow.com/a/8702291
+	// And: http://dba.stackexchange.com/a/78535
+	sql := `
+	WITH new_values (rack_id, zone_id, name, metadata, config) as (
+		VALUES ($1::uuid, $2::uuid, $3, $4::json, $5::json)
+	),
+	upsert as (
+		UPDATE racks r SET
+			zone_id = nv.zone_id,
+			name = nv.name,
+			metadata = nv.metadata,
+			config = nv.config
+		FROM new_values nv
+		WHERE r.rack_id = nv.rack_id
+		RETURNING nv.rack_id
+	)
+	INSERT INTO racks
+		(rack_id, zone_id, name, metadata, config)
+	SELECT rack_id, zone_id, name, metadata, config
+	FROM new_values nv
+	WHERE NOT EXISTS (SELECT 1 FROM upsert u WHERE nv.rack_id = u.rack_id)
+	`
+	metadata, err := json.Marshal(rack.Metadata)
+	if err != nil {
+		return err
+	}
+	config, err := json.Marshal(rack.Config)
+	if err != nil {
+		return err
+	}
+	_, err = d.Exec(sql,
+		rack.ID,
+		rack.ZoneID,
+		rack.Name,
+		string(metadata),
+		string(config),
+	)
+	return locationNotFoundError(err)
+}
+
+// Delete removes a rack from the database. A rack that still has hypervisors
+// can not be deleted.
+func (rack *Rack) Delete() error {
+	d, err := db.Connect(nil)
+	if err != nil {
+		return err
+	}
+	sql := "DELETE FROM racks WHERE rack_id = $1"
+	_, err = d.Exec(sql, rack.ID)
+	return locationInUseError(err)
+}
+
+// Load retrieves a rack from the database
+func (rack *Rack) Load() error {
+	d, err := db.Connect(nil)
+	if err != nil {
+		return err
+	}
+	sql := `
+	SELECT rack_id, zone_id, name, metadata, config
+	FROM racks
+	WHERE rack_id = $1
+	`
+	rows, err := d.Query(sql, rack.ID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	rows.Next()
+	if err := rack.fromRows(rows); err != nil {
+		return err
+	}
+	return rows.Err()
+}
+
+// fromRows unmarshals a database query result row into the rack object
+func (rack *Rack) fromRows(rows *sql.Rows) error {
+	var metadata, config string
+	err := rows.Scan(
+		&rack.ID,
+		&rack.ZoneID,
+		&rack.Name,
+		&metadata,
+		&config,
+	)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal([]byte(metadata), &rack.Metadata); err != nil {
+		return err
+	}
+	return json.Unmarshal([]byte(config), &rack.Config)
+}
+
+// Decode unmarshals JSON into the rack object
+func (rack *Rack) Decode(data io.Reader) error {
+	if err := json.NewDecoder(data).Decode(rack); err != nil {
+		return err
+	}
+	if rack.Config == nil {
+		rack.Config = make(ConfigOverrides)
+	}
+	rack.Config.clean()
+	if rack.Metadata == nil {
+		rack.Metadata = make(map[string]string)
+	} else {
+		for key, value := range rack.Metadata {
+			if value == "" {
+				delete(rack.Metadata, key)
+			}
+		}
+	}
+	return nil
+}
+
+// NewID generates a new uuid ID
+func (rack *Rack) NewID() string {
+	rack.ID = uuid.New()
+	return rack.ID
+}
+
+// NewRack creates and initializes a new rack object
+func NewRack() *Rack {
+	rack := &Rack{
+		ID:       uuid.New(),
+		Metadata: make(map[string]string),
+		Config:   make(ConfigOverrides),
+	}
+	return rack
+}
+
+// FetchRack retrieves a rack object from the database by ID
+func FetchRack(id string) (*Rack, error) {
+	rack := &Rack{
+		ID: id,
+	}
+	if err := rack.Load(); err != nil {
+		return nil, err
+	}
+	return rack, nil
+}
+
+// ListRacks retrieves an array of all rack objects from the database
+func ListRacks() ([]*Rack, error) {
+	d, err := db.Connect(nil)
+	if err != nil {
+		return nil, err
+	}
+	sql := `
+	SELECT rack_id, zone_id, name, metadata, config
+	FROM racks
+	ORDER BY rack_id
+	`
+	rows, err := d.Query(sql)
+	if err != nil {
+		return nil, err
+	}
+	racks, err := racksFromRows(rows)
+	if err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return racks, nil
+}
+
+// RacksByZone retrieves an array of racks in a zone from the database
+func RacksByZone(zone *Zone) ([]*Rack, error) {
+	d, err := db.Connect(nil)
+	if err != nil {
+		return nil, err
+	}
+	sql := `
+	SELECT rack_id, zone_id, name, metadata, config
+	FROM racks
+	WHERE zone_id = $1
+	ORDER BY rack_id asc
+	`
+	rows, err := d.Query(sql, zone.ID)
+	if err != nil {
+		return nil, err
+	}
+	racks, err := racksFromRows(rows)
+	if err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return racks, nil
+}
+
+// racksFromRows unmarshals multiple query rows into an array of racks
+func racksFromRows(rows *sql.Rows) ([]*Rack, error) {
+	racks := make([]*Rack, 0, 1)
+	for rows.Next() {
+		rack := &Rack{}
+		if err := rack.fromRows(rows); err != nil {
+			return nil, err
+		}
+		racks = append(racks, rack)
+	}
+	return racks, nil
+}
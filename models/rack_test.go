@@ -0,0 +1,67 @@
+package models_test
+
+import (
+	"strings"
+	"testing"
+
+	h "github.com/bakins/test-helpers"
+	"github.com/mistifyio/mistify-operator-admin/models"
+)
+
+var rackJSON = `{
+	"id": "7b9e2d1c-3a4f-4b5e-8c6d-9e0f1a2b3c4d",
+	"zone": "0a4f3c2e-8d7b-4e6a-b5c1-2d3e4f5a6b7c",
+	"name": "foobar",
+	"metadata": {
+		"foo": "bar"
+	}
+}`
+
+func createRack(t *testing.T) *models.Rack {
+	r := strings.NewReader(rackJSON)
+	rack := &models.Rack{}
+	h.Ok(t, rack.Decode(r))
+	return rack
+}
+
+func TestRackValidate(t *testing.T) {
+	rack := &models.Rack{}
+	err := rack.Validate()
+	h.Assert(t, errContains(models.ErrNoID, err), "expected ErrNoID")
+	h.Assert(t, errContains(models.ErrBadZoneID, err), "expected ErrBadZoneID")
+	h.Assert(t, errContains(models.ErrNoName, err), "expected ErrNoName")
+	h.Assert(t, errContains(models.ErrNilMetadata, err), "expected ErrNilMetadata")
+
+	h.Ok(t, createRack(t).Validate())
+}
+
+func TestRackLoad(t *testing.T) {
+	// Prep
+	datacenter := createDatacenter(t)
+	h.Ok(t, datacenter.Save())
+	zone := createZone(t)
+	h.Ok(t, zone.Save())
+
+	rack := createRack(t)
+	h.Ok(t, rack.Save())
+
+	rack2, err := models.FetchRack(rack.ID)
+	h.Ok(t, err)
+	h.Equals(t, rack, rack2)
+
+	racks, err := models.RacksByZone(zone)
+	h.Ok(t, err)
+	h.Equals(t, 1, len(racks))
+
+	// A rack with hypervisors can not be deleted
+	hypervisor := createHypervisor(t)
+	hypervisor.RackID = rack.ID
+	h.Ok(t, hypervisor.Save())
+	h.Equals(t, models.ErrLocationInUse, rack.Delete())
+
+	// Cleanup
+	h.Ok(t, hypervisor.Delete())
+	h.Ok(t, rack.Delete())
+	h.Ok(t, zone.Delete())
+	h.Ok(t, datacenter.Delete())
+}
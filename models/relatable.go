@@ -1,12 +1,23 @@
 package models
 
 import (
+	"database/sql"
 	"fmt"
 	"strings"
 
 	"github.com/mistifyio/mistify-operator-admin/db"
 )
 
+// querier is satisfied by both database connections and transactions
+type querier interface {
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+}
+
+// execer is satisfied by both database connections and transactions
+type execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
 // relatable is an interface that allows for associations between objects
 // in a database
 type relatable interface {
@@ -68,17 +79,25 @@ func SetRelations(tableName string, r1 relatable, r2s []relatable) error {
 	if err != nil {
 		return err
 	}
+	if err := setRelations(txn, tableName, r1, r2s); err != nil {
+		_ = txn.Rollback()
+		return err
+	}
+	return txn.Commit()
+}
 
+// setRelations clears and sets the relations of SetRelations using a
+// transaction owned by the caller
+func setRelations(e execer, tableName string, r1 relatable, r2s []relatable) error {
 	r1pkey := r1.pkeyName()
 
 	deleteSQL := fmt.Sprintf("DELETE FROM %s WHERE %s = $1", tableName, r1pkey)
-	if _, err := txn.Exec(deleteSQL, r1.id()); err != nil {
-		_ = txn.Rollback()
+	if _, err := e.Exec(deleteSQL, r1.id()); err != nil {
 		return err
 	}
 
 	if len(r2s) == 0 {
-		return txn.Commit()
+		return nil
 	}
 
 	r2pkey := r2s[0].pkeyName()
@@ -99,11 +118,8 @@ func SetRelations(tableName string, r1 relatable, r2s []relatable) error {
 		tableName, r1pkey, r2pkey,
 		strings.Join(placeholders, ","),
 	)
-	if _, err = txn.Exec(sql, values...); err != nil {
-		_ = txn.Rollback()
-		return err
-	}
-	return txn.Commit()
+	_, err := e.Exec(sql, values...)
+	return err
 }
 
 // ClearRelations relations removes all relations a relatable object has with another
@@ -124,3 +140,20 @@ func ClearRelations(tableName string, r1 relatable) error {
 	_, err = d.Exec(sql, r1.id())
 	return err
 }
+
+// idsFromRows unmarshals multiple single column query rows into an array of ids
+func idsFromRows(rows *sql.Rows) ([]string, error) {
+	defer rows.Close()
+	ids := make([]string, 0, 1)
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return ids, nil
+}
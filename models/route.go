@@ -0,0 +1,75 @@
+package models
+
+import (
+	"encoding/json"
+	"net"
+)
+
+type (
+	// Route describes a static route to push to guests
+	Route struct {
+		Destination *net.IPNet `json:"destination"`
+		Gateway     net.IP     `json:"gateway"`
+	}
+
+	// routeData is a middle-man for JSON and database (un)marshalling
+	routeData struct {
+		Destination string `json:"destination"`
+		Gateway     string `json:"gateway"`
+	}
+)
+
+// importData unmarshals the middle-man structure into a route object. Invalid
+// addresses are left nil for Validate to catch.
+func (route *Route) importData(data *routeData) {
+	route.Destination = nil
+	if _, destination, err := net.ParseCIDR(data.Destination); err == nil {
+		route.Destination = destination
+	}
+	route.Gateway = net.ParseIP(data.Gateway)
+}
+
+// exportData marshals the route object into the middle-man structure
+func (route *Route) exportData() *routeData {
+	data := &routeData{
+		Gateway: fmtString(route.Gateway),
+	}
+	if route.Destination != nil {
+		data.Destination = route.Destination.String()
+	}
+	return data
+}
+
+// UnmarshalJSON unmarshals JSON into a route object
+func (route *Route) UnmarshalJSON(b []byte) error {
+	data := &routeData{}
+	if err := json.Unmarshal(b, data); err != nil {
+		return err
+	}
+	route.importData(data)
+	return nil
+}
+
+// MarshalJSON marshals a route object into JSON
+func (route Route) MarshalJSON() ([]byte, error) {
+	return json.Marshal(route.exportData())
+}
+
+// Validate ensures the route properties are set correctly
+func (route *Route) Validate() error {
+	if route.Destination == nil || route.Gateway == nil {
+		return ErrBadRoute
+	}
+	if !ipSameFamily(route.Destination.IP, route.Gateway) {
+		return ErrBadRoute
+	}
+	return nil
+}
+
+// nonNilRoutes returns an empty rather than nil array for no routes
+func nonNilRoutes(routes []*Route) []*Route {
+	if routes == nil {
+		return make([]*Route, 0)
+	}
+	return routes
+}
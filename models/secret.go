@@ -0,0 +1,63 @@
+package models
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"io"
+
+	conf "github.com/mistifyio/mistify-operator-admin/config"
+)
+
+// secretCipher creates an AES-GCM cipher from the secrets key in the config
+func secretCipher() (cipher.AEAD, error) {
+	key, err := conf.Get().Secrets.KeyBytes()
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// encryptSecret encrypts a secret for storage. The context, such as the id of
+// the owning object, is authenticated along with the secret so the encrypted
+// secret can not be moved to another object. The result is the base64 encoded
+// nonce followed by the ciphertext.
+func encryptSecret(secret, context string) (string, error) {
+	gcm, err := secretCipher()
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", err
+	}
+	sealed := gcm.Seal(nonce, nonce, []byte(secret), []byte(context))
+	return base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// decryptSecret decrypts a secret encrypted by encryptSecret with the same
+// context
+func decryptSecret(encrypted, context string) (string, error) {
+	gcm, err := secretCipher()
+	if err != nil {
+		return "", err
+	}
+	sealed, err := base64.StdEncoding.DecodeString(encrypted)
+	if err != nil {
+		return "", err
+	}
+	if len(sealed) < gcm.NonceSize() {
+		return "", ErrBadSecret
+	}
+	nonce, ciphertext := sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():]
+	secret, err := gcm.Open(nil, nonce, ciphertext, []byte(context))
+	if err != nil {
+		return "", ErrBadSecret
+	}
+	return string(secret), nil
+}
@@ -0,0 +1,259 @@
+package models
+
+import (
+	"database/sql"
+	"encoding/json"
+	"io"
+
+	"code.google.com/p/go-uuid/uuid"
+	"github.com/hashicorp/go-multierror"
+	"github.com/mistifyio/mistify-operator-admin/db"
+)
+
+// Zone describes a failure domain within a datacenter, such as a room or a
+// power feed, that holds racks
+type Zone struct {
+	ID           string            `json:"id"`
+	DatacenterID string            `json:"datacenter"`
+	Name         string            `json:"name"`
+	Metadata     map[string]string `json:"metadata"`
+	Config       ConfigOverrides   `json:"config"`
+}
+
+// Validate ensures the zone properties are set correctly
+func (zone *Zone) Validate() error {
+	var results *multierror.Error
+	if zone.ID == "" {
+		results = multierror.Append(results, ErrNoID)
+	}
+	if uuid.Parse(zone.ID) == nil {
+		results = multierror.Append(results, ErrBadID)
+	}
+	if uuid.Parse(zone.DatacenterID) == nil {
+		results = multierror.Append(results, ErrBadDatacenterID)
+	}
+	if zone.Name == "" {
+		results = multierror.Append(results, ErrNoName)
+	}
+	if zone.Metadata == nil {
+		results = multierror.Append(results, ErrNilMetadata)
+	}
+	return results.ErrorOrNil()
+}
+
+// Save persists a zone to the database
+func (zone *Zone) Save() error {
+	if err := zone.Validate(); err != nil {
+		return err
+	}
+	d, err := db.Connect(nil)
+	if err != nil {
+		return err
+	}
+	// Writable CTE for an Upsert
+	// See: http://stackoverflow.com/a/8702291
+	// And: http://dba.stackexchange.com/a/78535
+	sql := `
+	WITH new_values (zone_id, datacenter_id, name, metadata, config) as (
+		VALUES ($1::uuid, $2::uuid, $3, $4::json, $5::json)
+	),
+	upsert as (
+		UPDATE zones z SET
+			datacenter_id = nv.datacenter_id,
+			name = nv.name,
+			metadata = nv.metadata,
+			config = nv.config
+		FROM new_values nv
+		WHERE z.zone_id = nv.zone_id
+		RETURNING nv.zone_id
+	)
+	INSERT INTO zones
+		(zone_id, datacenter_id, name, metadata, config)
+	SELECT zone_id, datacenter_id, name, metadata, config
+	FROM new_values nv
+	WHERE NOT EXISTS (SELECT 1 FROM upsert u WHERE nv.zone_id = u.zone_id)
+	`
+	metadata, err := json.Marshal(zone.Metadata)
+	if err != nil {
+		return err
+	}
+	config, err := json.Marshal(zone.Config)
+	if err != nil {
+		return err
+	}
+	_, err = d.Exec(sql,
+		zone.ID,
+		zone.DatacenterID,
+		zone.Name,
+		string(metadata),
+		string(config),
+	)
+	return locationNotFoundError(err)
+}
+
+// Delete removes a zone from the database. A zone that still has racks can not
+// be deleted.
+func (zone *Zone) Delete() error {
+	d, err := db.Connect(nil)
+	if err != nil {
+		return err
+	}
+	sql := "DELETE FROM zones WHERE zone_id = $1"
+	_, err = d.Exec(sql, zone.ID)
+	return locationInUseError(err)
+}
+
+// Load retrieves a zone from the database
+func (zone *Zone) Load() error {
+	d, err := db.Connect(nil)
+	if err != nil {
+		return err
+	}
+	sql := `
+	SELECT zone_id, datacenter_id, name, metadata, config
+	FROM zones
+	WHERE zone_id = $1
+	`
+	rows, err := d.Query(sql, zone.ID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	rows.Next()
+	if err := zone.fromRows(rows); err != nil {
+		return err
+	}
+	return rows.Err()
+}
+
+// fromRows unmarshals a database query result row into the zone object
+func (zone *Zone) fromRows(rows *sql.Rows) error {
+	var metadata, config string
+	err := rows.Scan(
+		&zone.ID,
+		&zone.DatacenterID,
+		&zone.Name,
+		&metadata,
+		&config,
+	)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal([]byte(metadata), &zone.Metadata); err != nil {
+		return err
+	}
+	return json.Unmarshal([]byte(config), &zone.Config)
+}
+
+// Decode unmarshals JSON into the zone object
+func (zone *Zone) Decode(data io.Reader) error {
+	if err := json.NewDecoder(data).Decode(zone); err != nil {
+		return err
+	}
+	if zone.Config == nil {
+		zone.Config = make(ConfigOverrides)
+	}
+	zone.Config.clean()
+	if zone.Metadata == nil {
+		zone.Metadata = make(map[string]string)
+	} else {
+		for key, value := range zone.Metadata {
+			if value == "" {
+				delete(zone.Metadata, key)
+			}
+		}
+	}
+	return nil
+}
+
+// NewID generates a new uuid ID
+func (zone *Zone) NewID() string {
+	zone.ID = uuid.New()
+	return zone.ID
+}
+
+// NewZone creates and initializes a new zone object
+func NewZone() *Zone {
+	zone := &Zone{
+		ID:       uuid.New(),
+		Metadata: make(map[string]string),
+		Config:   make(ConfigOverrides),
+	}
+	return zone
+}
+
+// FetchZone retrieves a zone object from the database by ID
+func FetchZone(id string) (*Zone, error) {
+	zone := &Zone{
+		ID: id,
+	}
+	if err := zone.Load(); err != nil {
+		return nil, err
+	}
+	return zone, nil
+}
+
+// ListZones retrieves an array of all zone objects from the database
+func ListZones() ([]*Zone, error) {
+	d, err := db.Connect(nil)
+	if err != nil {
+		return nil, err
+	}
+	sql := `
+	SELECT zone_id, datacenter_id, name, metadata, config
+	FROM zones
+	ORDER BY zone_id
+	`
+	rows, err := d.Query(sql)
+	if err != nil {
+		return nil, err
+	}
+	zones, err := zonesFromRows(rows)
+	if err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return zones, nil
+}
+
+// ZonesByDatacenter retrieves an array of zones in a datacenter from the
+// database
+func ZonesByDatacenter(datacenter *Datacenter) ([]*Zone, error) {
+	d, err := db.Connect(nil)
+	if err != nil {
+		return nil, err
+	}
+	sql := `
+	SELECT zone_id, datacenter_id, name, metadata, config
+	FROM zones
+	WHERE datacenter_id = $1
+	ORDER BY zone_id asc
+	`
+	rows, err := d.Query(sql, datacenter.ID)
+	if err != nil {
+		return nil, err
+	}
+	zones, err := zonesFromRows(rows)
+	if err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return zones, nil
+}
+
+// zonesFromRows unmarshals multiple query rows into an array of zones
+func zonesFromRows(rows *sql.Rows) ([]*Zone, error) {
+	zones := make([]*Zone, 0, 1)
+	for rows.Next() {
+		zone := &Zone{}
+		if err := zone.fromRows(rows); err != nil {
+			return nil, err
+		}
+		zones = append(zones, zone)
+	}
+	return zones, nil
+}
@@ -0,0 +1,61 @@
+package models_test
+
+import (
+	"strings"
+	"testing"
+
+	h "github.com/bakins/test-helpers"
+	"github.com/mistifyio/mistify-operator-admin/models"
+)
+
+var zoneJSON = `{
+	"id": "0a4f3c2e-8d7b-4e6a-b5c1-2d3e4f5a6b7c",
+	"datacenter": "5ed4c8a4-6b1e-4a4c-9d2e-1f3a6b7c8d90",
+	"name": "foobar",
+	"metadata": {
+		"foo": "bar"
+	}
+}`
+
+func createZone(t *testing.T) *models.Zone {
+	r := strings.NewReader(zoneJSON)
+	zone := &models.Zone{}
+	h.Ok(t, zone.Decode(r))
+	return zone
+}
+
+func TestZoneValidate(t *testing.T) {
+	zone := &models.Zone{}
+	err := zone.Validate()
+	h.Assert(t, errContains(models.ErrNoID, err), "expected ErrNoID")
+	h.Assert(t, errContains(models.ErrBadDatacenterID, err), "expected ErrBadDatacenterID")
+	h.Assert(t, errContains(models.ErrNoName, err), "expected ErrNoName")
+	h.Assert(t, errContains(models.ErrNilMetadata, err), "expected ErrNilMetadata")
+
+	h.Ok(t, createZone(t).Validate())
+}
+
+func TestZoneLoad(t *testing.T) {
+	// A zone needs an existing datacenter
+	zone := createZone(t)
+	h.Equals(t, models.ErrDatacenterNotFound, zone.Save())
+
+	datacenter := createDatacenter(t)
+	h.Ok(t, datacenter.Save())
+	h.Ok(t, zone.Save())
+
+	zone2, err := models.FetchZone(zone.ID)
+	h.Ok(t, err)
+	h.Equals(t, zone, zone2)
+
+	zones, err := models.ZonesByDatacenter(datacenter)
+	h.Ok(t, err)
+	h.Equals(t, 1, len(zones))
+
+	// A datacenter with zones can not be deleted
+	h.Equals(t, models.ErrLocationInUse, datacenter.Delete())
+
+	// Cleanup
+	h.Ok(t, zone.Delete())
+	h.Ok(t, datacenter.Delete())
+}
@@ -22,6 +22,8 @@ func RegisterNetworkRoutes(prefix string, router *mux.Router) {
 	RegisterOneRoute(sub, RouteInfo{"/{networkID}/ipranges", SetNetworkIPRanges, []string{"PUT"}, "networks.ipranges.set"})
 	RegisterOneRoute(sub, RouteInfo{"/{networkID}/ipranges/{iprangeID}", AddNetworkIPRange, []string{"PUT"}, "networks.ipranges.add"})
 	RegisterOneRoute(sub, RouteInfo{"/{networkID}/ipranges/{iprangeID}", RemoveNetworkIPRange, []string{"DELETE"}, "networks.ipranges.remove"})
+	RegisterOneRoute(sub, RouteInfo{"/{networkID}/usage", GetNetworkUsage, []string{"GET"}, "networks.usage.get"})
+	RegisterOneRoute(sub, RouteInfo{"/{networkID}/segments", GetNetworkSegments, []string{"GET"}, "networks.segments.get"})
 }
 
 // ListNetworks gets a list of all networks
@@ -138,6 +140,10 @@ func SetNetworkIPRanges(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if err := network.SetIPRanges(ipranges); err != nil {
+		if _, ok := err.(*models.OverlapError); ok || err == models.ErrSegmentInUse {
+			hr.JSONMsg(http.StatusConflict, err.Error())
+			return
+		}
 		hr.JSONMsg(http.StatusInternalServerError, err.Error())
 		return
 	}
@@ -157,6 +163,10 @@ func AddNetworkIPRange(w http.ResponseWriter, r *http.Request) {
 	iprangeID, ok := vars["iprangeID"]
 
 	if err := network.AddIPRange(&models.IPRange{ID: iprangeID}); err != nil {
+		if _, ok := err.(*models.OverlapError); ok || err == models.ErrSegmentInUse {
+			hr.JSONMsg(http.StatusConflict, err.Error())
+			return
+		}
 		hr.JSONMsg(http.StatusInternalServerError, err.Error())
 		return
 	}
@@ -181,6 +191,38 @@ func RemoveNetworkIPRange(w http.ResponseWriter, r *http.Request) {
 	hr.JSON(http.StatusOK, &struct{}{})
 }
 
+// GetNetworkUsage gets the counts of allocated, reserved, and free addresses in
+// the network's ipranges
+func GetNetworkUsage(w http.ResponseWriter, r *http.Request) {
+	hr := HTTPResponse{w}
+	network, ok := getNetworkHelper(hr, r)
+	if !ok {
+		return
+	}
+	usage, err := network.Usage()
+	if err != nil {
+		hr.JSONError(http.StatusInternalServerError, err)
+		return
+	}
+	hr.JSON(http.StatusOK, usage)
+}
+
+// GetNetworkSegments gets the dual-stack segments of the network, pairing
+// the IPv4 and IPv6 ipranges of each
+func GetNetworkSegments(w http.ResponseWriter, r *http.Request) {
+	hr := HTTPResponse{w}
+	network, ok := getNetworkHelper(hr, r)
+	if !ok {
+		return
+	}
+	segments, err := network.Segments()
+	if err != nil {
+		hr.JSONError(http.StatusInternalServerError, err)
+		return
+	}
+	hr.JSON(http.StatusOK, segments)
+}
+
 // getNetworkHelper gets the network object and handles sending a response in
 // case of error
 func getNetworkHelper(hr HTTPResponse, r *http.Request) (*models.Network, bool) {
@@ -215,6 +257,10 @@ func saveNetworkHelper(hr HTTPResponse, network *models.Network) bool {
 	}
 	// Save
 	if err := network.Save(); err != nil {
+		if err == models.ErrVLANInUse {
+			hr.JSONMsg(http.StatusConflict, err.Error())
+			return false
+		}
 		hr.JSONError(http.StatusInternalServerError, err)
 		return false
 	}
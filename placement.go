@@ -0,0 +1,75 @@
+package operator
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+
+	"code.google.com/p/go-uuid/uuid"
+	"github.com/gorilla/mux"
+	"github.com/mistifyio/mistify-operator-admin/models"
+)
+
+// RegisterPlacementRoutes registers the placement routes and handlers
+func RegisterPlacementRoutes(prefix string, router *mux.Router) {
+	RegisterOneRoute(router, RouteInfo{prefix, Place, []string{"POST"}, "placement.place"})
+}
+
+// Place gets a ranked list of the hypervisors a guest of a flavor on a network
+// may be placed on, along with the heartbeat status of each
+func Place(w http.ResponseWriter, r *http.Request) {
+	hr := HTTPResponse{w}
+
+	// Parse Request
+	var params struct {
+		FlavorID  string `json:"flavor"`
+		NetworkID string `json:"network"`
+		models.PlacementConstraints
+	}
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		hr.JSONMsg(http.StatusBadRequest, err.Error())
+		return
+	}
+	if err := params.PlacementConstraints.Validate(); err != nil {
+		hr.JSONMsg(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if uuid.Parse(params.FlavorID) == nil {
+		hr.JSONMsg(http.StatusBadRequest, "invalid flavor id")
+		return
+	}
+	flavor, err := models.FetchFlavor(params.FlavorID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			hr.JSONMsg(http.StatusBadRequest, "flavor not found")
+			return
+		}
+		hr.JSONError(http.StatusInternalServerError, err)
+		return
+	}
+	if uuid.Parse(params.NetworkID) == nil {
+		hr.JSONMsg(http.StatusBadRequest, "invalid network id")
+		return
+	}
+	network, err := models.FetchNetwork(params.NetworkID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			hr.JSONMsg(http.StatusBadRequest, "network not found")
+			return
+		}
+		hr.JSONError(http.StatusInternalServerError, err)
+		return
+	}
+
+	hypervisors, err := models.Place(flavor, network, &params.PlacementConstraints)
+	if err != nil {
+		hr.JSONError(http.StatusInternalServerError, err)
+		return
+	}
+	if err := models.SetHypervisorStatuses(hypervisors); err != nil {
+		hr.JSONError(http.StatusInternalServerError, err)
+		return
+	}
+	hr.JSON(http.StatusOK, hypervisors)
+}
@@ -0,0 +1,194 @@
+package operator
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+
+	"code.google.com/p/go-uuid/uuid"
+	"github.com/gorilla/mux"
+	"github.com/mistifyio/mistify-operator-admin/models"
+)
+
+// RegisterPoolRoutes registers the pool routes and handlers
+func RegisterPoolRoutes(prefix string, router *mux.Router) {
+	RegisterOneRoute(router, RouteInfo{prefix, ListPools, []string{"GET"}, "pools.list"})
+	RegisterOneRoute(router, RouteInfo{prefix, CreatePool, []string{"POST"}, "pools.create"})
+	sub := router.PathPrefix(prefix).Subrouter()
+	RegisterOneRoute(sub, RouteInfo{"/{poolID}", GetPool, []string{"GET"}, "pools.get"})
+	RegisterOneRoute(sub, RouteInfo{"/{poolID}", UpdatePool, []string{"PATCH"}, "pools.update"})
+	RegisterOneRoute(sub, RouteInfo{"/{poolID}", DeletePool, []string{"DELETE"}, "pools.delete"})
+	RegisterOneRoute(sub, RouteInfo{"/{poolID}/carve", CarvePool, []string{"POST"}, "pools.carve"})
+}
+
+// ListPools gets a list of all pools
+func ListPools(w http.ResponseWriter, r *http.Request) {
+	hr := HTTPResponse{w}
+	pools, err := models.ListPools()
+	if err != nil {
+		hr.JSONError(http.StatusInternalServerError, err)
+		return
+	}
+	hr.JSON(http.StatusOK, pools)
+}
+
+// GetPool gets a particular pool
+func GetPool(w http.ResponseWriter, r *http.Request) {
+	hr := HTTPResponse{w}
+	pool, ok := getPoolHelper(hr, r)
+	if !ok {
+		return
+	}
+	hr.JSON(http.StatusOK, pool)
+}
+
+// CreatePool creates a new pool
+func CreatePool(w http.ResponseWriter, r *http.Request) {
+	hr := HTTPResponse{w}
+
+	// Parse Request
+	pool := &models.Pool{}
+	if err := pool.Decode(r.Body); err != nil {
+		hr.JSONMsg(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// Assign an ID
+	if pool.ID != "" {
+		hr.JSONMsg(http.StatusBadRequest, "id must not be defined")
+		return
+	}
+	pool.NewID()
+
+	if !savePoolHelper(hr, pool) {
+		return
+	}
+	hr.JSON(http.StatusCreated, pool)
+}
+
+// UpdatePool updates an existing pool
+func UpdatePool(w http.ResponseWriter, r *http.Request) {
+	hr := HTTPResponse{w}
+	pool, ok := getPoolHelper(hr, r)
+	if !ok {
+		return // Specific response handled by getPoolHelper
+	}
+
+	// Parse Request
+	if err := pool.Decode(r.Body); err != nil {
+		hr.JSONMsg(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if !savePoolHelper(hr, pool) {
+		return
+	}
+	hr.JSON(http.StatusOK, pool)
+}
+
+// DeletePool deletes an existing pool
+func DeletePool(w http.ResponseWriter, r *http.Request) {
+	hr := HTTPResponse{w}
+	pool, ok := getPoolHelper(hr, r)
+	if !ok {
+		return
+	}
+
+	if err := pool.Delete(); err != nil {
+		hr.JSONError(http.StatusInternalServerError, err)
+		return
+	}
+	hr.JSON(http.StatusOK, pool)
+}
+
+// CarvePool creates an iprange from the next free subnet of the pool,
+// optionally associating it with a network
+func CarvePool(w http.ResponseWriter, r *http.Request) {
+	hr := HTTPResponse{w}
+	pool, ok := getPoolHelper(hr, r)
+	if !ok {
+		return
+	}
+
+	// Parse Request
+	var params struct {
+		PrefixLength int    `json:"prefixLength"`
+		NetworkID    string `json:"network"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		hr.JSONMsg(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	var network *models.Network
+	if params.NetworkID != "" {
+		if uuid.Parse(params.NetworkID) == nil {
+			hr.JSONMsg(http.StatusBadRequest, "invalid network id")
+			return
+		}
+		var err error
+		if network, err = models.FetchNetwork(params.NetworkID); err != nil {
+			if err == sql.ErrNoRows {
+				hr.JSONMsg(http.StatusBadRequest, "network not found")
+				return
+			}
+			hr.JSONError(http.StatusInternalServerError, err)
+			return
+		}
+	}
+
+	iprange, err := pool.Carve(params.PrefixLength, network)
+	if err != nil {
+		if err == models.ErrBadPrefixLength {
+			hr.JSONMsg(http.StatusBadRequest, err.Error())
+			return
+		}
+		if _, ok := err.(*models.OverlapError); ok || err == models.ErrPoolExhausted {
+			hr.JSONMsg(http.StatusConflict, err.Error())
+			return
+		}
+		hr.JSONError(http.StatusInternalServerError, err)
+		return
+	}
+	hr.JSON(http.StatusCreated, iprange)
+}
+
+// getPoolHelper gets the pool object and handles sending a response in case
+// of error
+func getPoolHelper(hr HTTPResponse, r *http.Request) (*models.Pool, bool) {
+	vars := mux.Vars(r)
+	poolID, ok := vars["poolID"]
+	if !ok {
+		hr.JSONMsg(http.StatusBadRequest, "missing pool id")
+		return nil, false
+	}
+	if uuid.Parse(poolID) == nil {
+		hr.JSONMsg(http.StatusBadRequest, "invalid pool id")
+		return nil, false
+	}
+	pool, err := models.FetchPool(poolID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			hr.JSONMsg(http.StatusNotFound, "not found")
+			return nil, false
+		}
+		hr.JSONError(http.StatusInternalServerError, err)
+		return nil, false
+	}
+	return pool, true
+}
+
+// savePoolHelper saves the pool object and handles sending a response in case
+// of error
+func savePoolHelper(hr HTTPResponse, pool *models.Pool) bool {
+	if err := pool.Validate(); err != nil {
+		hr.JSONMsg(http.StatusBadRequest, err.Error())
+		return false
+	}
+	// Save
+	if err := pool.Save(); err != nil {
+		hr.JSONError(http.StatusInternalServerError, err)
+		return false
+	}
+	return true
+}
@@ -25,6 +25,7 @@ func RegisterProjectRoutes(prefix string, router *mux.Router) {
 	RegisterOneRoute(sub, RouteInfo{"/{projectID}/permissions", SetProjectPermissions, []string{"PUT"}, "projects.permissions.set"})
 	RegisterOneRoute(sub, RouteInfo{"/{projectID}/permissions/{permissionID}", AddProjectPermission, []string{"PUT"}, "projects.permissions.add"})
 	RegisterOneRoute(sub, RouteInfo{"/{projectID}/permissions/{permissionID}", RemoveProjectPermission, []string{"DELETE"}, "projects.permissions.remove"})
+	RegisterOneRoute(sub, RouteInfo{"/{projectID}/flavors", GetProjectFlavors, []string{"GET"}, "projects.flavors.get"})
 }
 
 // ListProjects gets a list of all projects
@@ -259,6 +260,22 @@ func RemoveProjectPermission(w http.ResponseWriter, r *http.Request) {
 	hr.JSON(http.StatusOK, &struct{}{})
 }
 
+// GetProjectFlavors gets a list of flavors available to the project, which are
+// the public flavors and the private flavors associated with the project
+func GetProjectFlavors(w http.ResponseWriter, r *http.Request) {
+	hr := HTTPResponse{w}
+	project, ok := getProjectHelper(hr, r)
+	if !ok {
+		return
+	}
+	flavors, err := models.FlavorsByProject(project)
+	if err != nil {
+		hr.JSONError(http.StatusInternalServerError, err)
+		return
+	}
+	hr.JSON(http.StatusOK, flavors)
+}
+
 // getProjectHelper gets the project object and handles sending a response in
 // case of error
 func getProjectHelper(hr HTTPResponse, r *http.Request) (*models.Project, bool) {
@@ -0,0 +1,169 @@
+package operator
+
+import (
+	"database/sql"
+	"net/http"
+
+	"code.google.com/p/go-uuid/uuid"
+	"github.com/gorilla/mux"
+	"github.com/mistifyio/mistify-operator-admin/models"
+)
+
+// RegisterRackRoutes registers the rack routes and handlers
+func RegisterRackRoutes(prefix string, router *mux.Router) {
+	RegisterOneRoute(router, RouteInfo{prefix, ListRacks, []string{"GET"}, "racks.list"})
+	RegisterOneRoute(router, RouteInfo{prefix, CreateRack, []string{"POST"}, "racks.create"})
+	sub := router.PathPrefix(prefix).Subrouter()
+	RegisterOneRoute(sub, RouteInfo{"/{rackID}", GetRack, []string{"GET"}, "racks.get"})
+	RegisterOneRoute(sub, RouteInfo{"/{rackID}", UpdateRack, []string{"PATCH"}, "racks.update"})
+	RegisterOneRoute(sub, RouteInfo{"/{rackID}", DeleteRack, []string{"DELETE"}, "racks.delete"})
+	RegisterOneRoute(sub, RouteInfo{"/{rackID}/hypervisors", GetRackHypervisors, []string{"GET"}, "racks.hypervisors.get"})
+}
+
+// ListRacks gets a list of all racks
+func ListRacks(w http.ResponseWriter, r *http.Request) {
+	hr := HTTPResponse{w}
+	racks, err := models.ListRacks()
+	if err != nil {
+		hr.JSONError(http.StatusInternalServerError, err)
+		return
+	}
+	hr.JSON(http.StatusOK, racks)
+}
+
+// GetRack gets a particular rack
+func GetRack(w http.ResponseWriter, r *http.Request) {
+	hr := HTTPResponse{w}
+	rack, ok := getRackHelper(hr, r)
+	if !ok {
+		return
+	}
+	hr.JSON(http.StatusOK, rack)
+}
+
+// CreateRack creates a new rack
+func CreateRack(w http.ResponseWriter, r *http.Request) {
+	hr := HTTPResponse{w}
+
+	// Parse Request
+	rack := &models.Rack{}
+	if err := rack.Decode(r.Body); err != nil {
+		hr.JSONMsg(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// Assign an ID
+	if rack.ID != "" {
+		hr.JSONMsg(http.StatusBadRequest, "id must not be defined")
+		return
+	}
+	rack.NewID()
+
+	if !saveRackHelper(hr, rack) {
+		return
+	}
+	hr.JSON(http.StatusCreated, rack)
+}
+
+// UpdateRack updates an existing rack
+func UpdateRack(w http.ResponseWriter, r *http.Request) {
+	hr := HTTPResponse{w}
+	rack, ok := getRackHelper(hr, r)
+	if !ok {
+		return // Specific response handled by getRackHelper
+	}
+
+	// Parse Request
+	if err := rack.Decode(r.Body); err != nil {
+		hr.JSONMsg(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if !saveRackHelper(hr, rack) {
+		return
+	}
+	hr.JSON(http.StatusOK, rack)
+}
+
+// DeleteRack deletes an existing rack that has no hypervisors
+func DeleteRack(w http.ResponseWriter, r *http.Request) {
+	hr := HTTPResponse{w}
+	rack, ok := getRackHelper(hr, r)
+	if !ok {
+		return
+	}
+
+	if err := rack.Delete(); err != nil {
+		if err == models.ErrLocationInUse {
+			hr.JSONMsg(http.StatusConflict, err.Error())
+			return
+		}
+		hr.JSONError(http.StatusInternalServerError, err)
+		return
+	}
+	hr.JSON(http.StatusOK, rack)
+}
+
+// GetRackHypervisors gets a list of hypervisors in the rack, along with the
+// heartbeat status of each
+func GetRackHypervisors(w http.ResponseWriter, r *http.Request) {
+	hr := HTTPResponse{w}
+	rack, ok := getRackHelper(hr, r)
+	if !ok {
+		return
+	}
+	hypervisors, err := models.FilterHypervisors(&models.HypervisorFilter{RackID: rack.ID})
+	if err != nil {
+		hr.JSONError(http.StatusInternalServerError, err)
+		return
+	}
+	if err := models.SetHypervisorStatuses(hypervisors); err != nil {
+		hr.JSONError(http.StatusInternalServerError, err)
+		return
+	}
+	hr.JSON(http.StatusOK, hypervisors)
+}
+
+// getRackHelper gets the rack object and handles sending a response in case of
+// error
+func getRackHelper(hr HTTPResponse, r *http.Request) (*models.Rack, bool) {
+	vars := mux.Vars(r)
+	rackID, ok := vars["rackID"]
+	if !ok {
+		hr.JSONMsg(http.StatusBadRequest, "missing rack id")
+		return nil, false
+	}
+	if uuid.Parse(rackID) == nil {
+		hr.JSONMsg(http.StatusBadRequest, "invalid rack id")
+		return nil, false
+	}
+	rack, err := models.FetchRack(rackID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			hr.JSONMsg(http.StatusNotFound, "not found")
+			return nil, false
+		}
+		hr.JSONError(http.StatusInternalServerError, err)
+		return nil, false
+	}
+	return rack, true
+}
+
+// saveRackHelper saves the rack object and handles sending a response in case
+// of error
+func saveRackHelper(hr HTTPResponse, rack *models.Rack) bool {
+	if err := rack.Validate(); err != nil {
+		hr.JSONMsg(http.StatusBadRequest, err.Error())
+		return false
+	}
+	// Save
+	if err := rack.Save(); err != nil {
+		if err == models.ErrZoneNotFound {
+			hr.JSONMsg(http.StatusBadRequest, err.Error())
+			return false
+		}
+		hr.JSONError(http.StatusInternalServerError, err)
+		return false
+	}
+	return true
+}
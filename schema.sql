@@ -25,10 +25,227 @@ COMMENT ON EXTENSION plpgsql IS 'PL/pgSQL procedural language';
 
 SET search_path = public, pg_catalog;
 
+--
+-- Name: inetrange; Type: TYPE; Schema: public; Owner: operator
+--
+
+CREATE TYPE inetrange AS RANGE (
+    subtype = inet
+);
+
+
+ALTER TYPE public.inetrange OWNER TO operator;
+
+--
+-- Name: hypervisor_interfaces_check_mac(); Type: FUNCTION; Schema: public; Owner: operator
+--
+
+CREATE FUNCTION hypervisor_interfaces_check_mac() RETURNS trigger
+    LANGUAGE plpgsql
+    AS $$
+DECLARE
+    conflict uuid;
+BEGIN
+    -- Serialize changes to a MAC across hypervisors and their interfaces
+    PERFORM pg_advisory_xact_lock(hashtext(NEW.mac::text));
+
+    -- A MAC may be shared within a hypervisor, such as by a bond and its
+    -- members, but not with another hypervisor
+    SELECT hypervisor_id INTO conflict
+    FROM hypervisors
+    WHERE mac = NEW.mac
+    AND hypervisor_id <> NEW.hypervisor_id;
+
+    IF conflict IS NULL THEN
+        SELECT hypervisor_id INTO conflict
+        FROM hypervisor_interfaces
+        WHERE mac = NEW.mac
+        AND hypervisor_id <> NEW.hypervisor_id
+        LIMIT 1;
+    END IF;
+
+    IF conflict IS NOT NULL THEN
+        RAISE EXCEPTION 'interface % mac % is already used by hypervisor %', NEW.interface_id, NEW.mac, conflict
+            USING ERRCODE = 'unique_violation', CONSTRAINT = 'hypervisor_interfaces_mac_key';
+    END IF;
+    RETURN NEW;
+END;
+$$;
+
+
+ALTER FUNCTION public.hypervisor_interfaces_check_mac() OWNER TO operator;
+
+--
+-- Name: hypervisors_check_interface_mac(); Type: FUNCTION; Schema: public; Owner: operator
+--
+
+CREATE FUNCTION hypervisors_check_interface_mac() RETURNS trigger
+    LANGUAGE plpgsql
+    AS $$
+DECLARE
+    conflict uuid;
+BEGIN
+    -- Serialize changes to a MAC across hypervisors and their interfaces
+    PERFORM pg_advisory_xact_lock(hashtext(NEW.mac::text));
+
+    -- A hypervisor's management interface may be bonded, sharing its MAC
+    SELECT hypervisor_id INTO conflict
+    FROM hypervisor_interfaces
+    WHERE mac = NEW.mac
+    AND hypervisor_id <> NEW.hypervisor_id
+    LIMIT 1;
+
+    IF conflict IS NOT NULL THEN
+        RAISE EXCEPTION 'hypervisor % mac % is already used by an interface of hypervisor %', NEW.hypervisor_id, NEW.mac, conflict
+            USING ERRCODE = 'unique_violation', CONSTRAINT = 'hypervisors_mac_key';
+    END IF;
+    RETURN NEW;
+END;
+$$;
+
+
+ALTER FUNCTION public.hypervisors_check_interface_mac() OWNER TO operator;
+
+--
+-- Name: iprange_networks_check_overlap(); Type: FUNCTION; Schema: public; Owner: operator
+--
+
+CREATE FUNCTION iprange_networks_check_overlap() RETURNS trigger
+    LANGUAGE plpgsql
+    AS $$
+DECLARE
+    conflicts text;
+BEGIN
+    -- Serialize changes to the ipranges of a network
+    PERFORM 1 FROM networks WHERE network_id = NEW.network_id FOR UPDATE;
+
+    SELECT string_agg(other.iprange_id::text, ', ' ORDER BY other.iprange_id) INTO conflicts
+    FROM ipranges i
+    JOIN iprange_networks i_n ON i_n.network_id = NEW.network_id AND i_n.iprange_id <> NEW.iprange_id
+    JOIN ipranges other ON other.iprange_id = i_n.iprange_id
+    WHERE i.iprange_id = NEW.iprange_id
+    AND other.cidr && i.cidr;
+
+    IF conflicts IS NOT NULL THEN
+        RAISE EXCEPTION 'iprange % cidr overlaps ipranges in network %: %', NEW.iprange_id, NEW.network_id, conflicts
+            USING ERRCODE = 'exclusion_violation';
+    END IF;
+
+    SELECT string_agg(other.iprange_id::text, ', ' ORDER BY other.iprange_id) INTO conflicts
+    FROM ipranges i
+    JOIN iprange_networks i_n ON i_n.network_id = NEW.network_id AND i_n.iprange_id <> NEW.iprange_id
+    JOIN ipranges other ON other.iprange_id = i_n.iprange_id
+    WHERE i.iprange_id = NEW.iprange_id
+    AND i.segment <> ''
+    AND other.segment = i.segment
+    AND family(other.cidr) = family(i.cidr);
+
+    IF conflicts IS NOT NULL THEN
+        RAISE EXCEPTION 'iprange % segment already has an iprange of its family in network %: %', NEW.iprange_id, NEW.network_id, conflicts
+            USING ERRCODE = 'unique_violation', CONSTRAINT = 'iprange_networks_segment_family';
+    END IF;
+    RETURN NEW;
+END;
+$$;
+
+
+ALTER FUNCTION public.iprange_networks_check_overlap() OWNER TO operator;
+
+--
+-- Name: ipranges_check_network_overlap(); Type: FUNCTION; Schema: public; Owner: operator
+--
+
+CREATE FUNCTION ipranges_check_network_overlap() RETURNS trigger
+    LANGUAGE plpgsql
+    AS $$
+DECLARE
+    conflicts text;
+BEGIN
+    -- Serialize changes to the ipranges of a network
+    PERFORM 1
+    FROM networks n
+    JOIN iprange_networks i_n ON n.network_id = i_n.network_id
+    WHERE i_n.iprange_id = NEW.iprange_id
+    FOR UPDATE OF n;
+
+    SELECT string_agg(i_n.iprange_id::text, ', ' ORDER BY i_n.iprange_id) INTO conflicts
+    FROM iprange_networks mine
+    JOIN iprange_networks i_n ON i_n.network_id = mine.network_id AND i_n.iprange_id <> mine.iprange_id
+    JOIN ipranges other ON other.iprange_id = i_n.iprange_id
+    WHERE mine.iprange_id = NEW.iprange_id
+    AND other.cidr && NEW.cidr;
+
+    IF conflicts IS NOT NULL THEN
+        RAISE EXCEPTION 'iprange % cidr overlaps ipranges in its network: %', NEW.iprange_id, conflicts
+            USING ERRCODE = 'exclusion_violation';
+    END IF;
+
+    SELECT string_agg(i_n.iprange_id::text, ', ' ORDER BY i_n.iprange_id) INTO conflicts
+    FROM iprange_networks mine
+    JOIN iprange_networks i_n ON i_n.network_id = mine.network_id AND i_n.iprange_id <> mine.iprange_id
+    JOIN ipranges other ON other.iprange_id = i_n.iprange_id
+    WHERE mine.iprange_id = NEW.iprange_id
+    AND NEW.segment <> ''
+    AND other.segment = NEW.segment
+    AND family(other.cidr) = family(NEW.cidr);
+
+    IF conflicts IS NOT NULL THEN
+        RAISE EXCEPTION 'iprange % segment already has an iprange of its family in its network: %', NEW.iprange_id, conflicts
+            USING ERRCODE = 'unique_violation', CONSTRAINT = 'iprange_networks_segment_family';
+    END IF;
+    RETURN NEW;
+END;
+$$;
+
+
+ALTER FUNCTION public.ipranges_check_network_overlap() OWNER TO operator;
+
 SET default_tablespace = '';
 
 SET default_with_oids = false;
 
+--
+-- Name: bootstrap_token_registrations; Type: TABLE; Schema: public; Owner: operator; Tablespace: 
+--
+
+CREATE TABLE bootstrap_token_registrations (
+    bootstrap_token_id uuid NOT NULL,
+    hypervisor_id uuid,
+    registered timestamp with time zone DEFAULT now() NOT NULL
+);
+
+
+ALTER TABLE public.bootstrap_token_registrations OWNER TO operator;
+
+--
+-- Name: bootstrap_tokens; Type: TABLE; Schema: public; Owner: operator; Tablespace: 
+--
+
+CREATE TABLE bootstrap_tokens (
+    bootstrap_token_id uuid NOT NULL,
+    token_hash text NOT NULL,
+    single_use boolean DEFAULT false NOT NULL,
+    expires timestamp with time zone,
+    metadata json DEFAULT '{}'::json NOT NULL,
+    created timestamp with time zone DEFAULT now() NOT NULL,
+    CONSTRAINT bootstrap_tokens_limit_check CHECK ((single_use OR (expires IS NOT NULL)))
+);
+
+
+ALTER TABLE public.bootstrap_tokens OWNER TO operator;
+
+--
+-- Name: bootstrap_tokens_ipranges; Type: TABLE; Schema: public; Owner: operator; Tablespace: 
+--
+
+CREATE TABLE bootstrap_tokens_ipranges (
+    bootstrap_token_id uuid,
+    iprange_id uuid
+);
+
+
+ALTER TABLE public.bootstrap_tokens_ipranges OWNER TO operator;
+
 --
 -- Name: config; Type: TABLE; Schema: public; Owner: operator; Tablespace: 
 --
@@ -41,6 +258,20 @@ CREATE TABLE config (
 
 ALTER TABLE public.config OWNER TO operator;
 
+--
+-- Name: datacenters; Type: TABLE; Schema: public; Owner: operator; Tablespace: 
+--
+
+CREATE TABLE datacenters (
+    datacenter_id uuid NOT NULL,
+    name text NOT NULL,
+    metadata json DEFAULT '{}'::json NOT NULL,
+    config json DEFAULT '{}'::json NOT NULL
+);
+
+
+ALTER TABLE public.datacenters OWNER TO operator;
+
 --
 -- Name: flavors; Type: TABLE; Schema: public; Owner: operator; Tablespace: 
 --
@@ -51,12 +282,82 @@ CREATE TABLE flavors (
     cpu integer NOT NULL,
     memory integer NOT NULL,
     disk integer NOT NULL,
+    private boolean DEFAULT false NOT NULL,
+    extra_specs json DEFAULT '{}'::json NOT NULL,
     metadata json DEFAULT '{}'::json NOT NULL
 );
 
 
 ALTER TABLE public.flavors OWNER TO operator;
 
+--
+-- Name: flavors_projects; Type: TABLE; Schema: public; Owner: operator; Tablespace: 
+--
+
+CREATE TABLE flavors_projects (
+    flavor_id uuid,
+    project_id uuid
+);
+
+
+ALTER TABLE public.flavors_projects OWNER TO operator;
+
+--
+-- Name: hypervisor_bmcs; Type: TABLE; Schema: public; Owner: operator; Tablespace: 
+--
+
+CREATE TABLE hypervisor_bmcs (
+    hypervisor_id uuid NOT NULL,
+    address text NOT NULL,
+    protocol text NOT NULL,
+    username text DEFAULT ''::text NOT NULL,
+    password text DEFAULT ''::text NOT NULL,
+    metadata json DEFAULT '{}'::json NOT NULL,
+    CONSTRAINT hypervisor_bmcs_protocol_check CHECK ((protocol = ANY (ARRAY['ipmi'::text, 'redfish'::text])))
+);
+
+
+ALTER TABLE public.hypervisor_bmcs OWNER TO operator;
+
+--
+-- Name: COLUMN hypervisor_bmcs.password; Type: COMMENT; Schema: public; Owner: operator
+--
+
+COMMENT ON COLUMN hypervisor_bmcs.password IS 'Encrypted with the secrets key from the config file';
+
+
+--
+-- Name: hypervisor_facts; Type: TABLE; Schema: public; Owner: operator; Tablespace: 
+--
+
+CREATE TABLE hypervisor_facts (
+    hypervisor_id uuid NOT NULL,
+    version integer NOT NULL,
+    reported timestamp with time zone DEFAULT now() NOT NULL,
+    facts json NOT NULL
+);
+
+
+ALTER TABLE public.hypervisor_facts OWNER TO operator;
+
+--
+-- Name: hypervisor_interfaces; Type: TABLE; Schema: public; Owner: operator; Tablespace: 
+--
+
+CREATE TABLE hypervisor_interfaces (
+    interface_id uuid NOT NULL,
+    hypervisor_id uuid NOT NULL,
+    name text NOT NULL,
+    mac macaddr NOT NULL,
+    ip inet,
+    bond text DEFAULT ''::text NOT NULL,
+    network_id uuid,
+    metadata json DEFAULT '{}'::json NOT NULL
+);
+
+
+ALTER TABLE public.hypervisor_interfaces OWNER TO operator;
+
 --
 -- Name: hypervisors; Type: TABLE; Schema: public; Owner: operator; Tablespace: 
 --
@@ -65,7 +366,21 @@ CREATE TABLE hypervisors (
     hypervisor_id uuid NOT NULL,
     mac macaddr NOT NULL,
     ip inet NOT NULL,
-    metadata json DEFAULT '{}'::json NOT NULL
+    state text DEFAULT 'registered'::text NOT NULL,
+    cpu integer DEFAULT 0 NOT NULL,
+    memory integer DEFAULT 0 NOT NULL,
+    disk integer DEFAULT 0 NOT NULL,
+    cpu_overcommit double precision DEFAULT 1 NOT NULL,
+    memory_overcommit double precision DEFAULT 1 NOT NULL,
+    disk_overcommit double precision DEFAULT 1 NOT NULL,
+    metadata json DEFAULT '{}'::json NOT NULL,
+    last_seen timestamp with time zone,
+    agent_facts json DEFAULT '{}'::json NOT NULL,
+    rack_id uuid,
+    config json DEFAULT '{}'::json NOT NULL,
+    CONSTRAINT hypervisors_capacity_check CHECK ((((cpu >= 0) AND (memory >= 0)) AND (disk >= 0))),
+    CONSTRAINT hypervisors_state_check CHECK ((state = ANY (ARRAY['registered'::text, 'active'::text, 'maintenance'::text, 'draining'::text, 'decommissioned'::text]))),
+    CONSTRAINT hypervisors_overcommit_check CHECK ((((cpu_overcommit > (0)::double precision) AND (memory_overcommit > (0)::double precision)) AND (disk_overcommit > (0)::double precision)))
 );
 
 
@@ -83,6 +398,37 @@ CREATE TABLE hypervisors_ipranges (
 
 ALTER TABLE public.hypervisors_ipranges OWNER TO operator;
 
+--
+-- Name: iprange_allocations; Type: TABLE; Schema: public; Owner: operator; Tablespace: 
+--
+
+CREATE TABLE iprange_allocations (
+    iprange_id uuid NOT NULL,
+    ip inet NOT NULL,
+    mac macaddr,
+    hypervisor_id uuid,
+    metadata json DEFAULT '{}'::json NOT NULL,
+    created timestamp with time zone DEFAULT now() NOT NULL
+);
+
+
+ALTER TABLE public.iprange_allocations OWNER TO operator;
+
+--
+-- Name: iprange_exclusions; Type: TABLE; Schema: public; Owner: operator; Tablespace: 
+--
+
+CREATE TABLE iprange_exclusions (
+    exclusion_id uuid NOT NULL,
+    iprange_id uuid NOT NULL,
+    start_ip inet NOT NULL,
+    end_ip inet NOT NULL,
+    metadata json DEFAULT '{}'::json NOT NULL
+);
+
+
+ALTER TABLE public.iprange_exclusions OWNER TO operator;
+
 --
 -- Name: iprange_networks; Type: TABLE; Schema: public; Owner: operator; Tablespace: 
 --
@@ -105,7 +451,15 @@ CREATE TABLE ipranges (
     gateway inet NOT NULL,
     start_ip inet NOT NULL,
     end_ip inet NOT NULL,
-    metadata json DEFAULT '{}'::json NOT NULL
+    dns_servers json DEFAULT '[]'::json NOT NULL,
+    search_domain text DEFAULT ''::text NOT NULL,
+    mtu integer,
+    routes json DEFAULT '[]'::json NOT NULL,
+    mode text DEFAULT 'dhcp'::text NOT NULL,
+    segment text DEFAULT ''::text NOT NULL,
+    metadata json DEFAULT '{}'::json NOT NULL,
+    CONSTRAINT ipranges_mode_check CHECK ((mode = ANY (ARRAY['dhcp'::text, 'dhcpv6'::text, 'slaac'::text, 'static'::text]))),
+    CONSTRAINT ipranges_mtu_check CHECK (((mtu >= 68) AND (mtu <= 65535)))
 );
 
 
@@ -118,7 +472,14 @@ ALTER TABLE public.ipranges OWNER TO operator;
 CREATE TABLE networks (
     network_id uuid NOT NULL,
     name text NOT NULL,
-    metadata json DEFAULT '{}'::json NOT NULL
+    dns_servers json DEFAULT '[]'::json NOT NULL,
+    search_domain text DEFAULT ''::text NOT NULL,
+    vlan integer,
+    mtu integer,
+    routes json DEFAULT '[]'::json NOT NULL,
+    metadata json DEFAULT '{}'::json NOT NULL,
+    CONSTRAINT networks_mtu_check CHECK (((mtu >= 68) AND (mtu <= 65535))),
+    CONSTRAINT networks_vlan_check CHECK (((vlan >= 1) AND (vlan <= 4094)))
 );
 
 
@@ -142,6 +503,20 @@ CREATE TABLE permissions (
 
 ALTER TABLE public.permissions OWNER TO operator;
 
+--
+-- Name: pools; Type: TABLE; Schema: public; Owner: operator; Tablespace: 
+--
+
+CREATE TABLE pools (
+    pool_id uuid NOT NULL,
+    name text NOT NULL,
+    cidr cidr NOT NULL,
+    metadata json DEFAULT '{}'::json NOT NULL
+);
+
+
+ALTER TABLE public.pools OWNER TO operator;
+
 --
 -- Name: projects; Type: TABLE; Schema: public; Owner: operator; Tablespace: 
 --
@@ -179,6 +554,21 @@ CREATE TABLE projects_users (
 
 ALTER TABLE public.projects_users OWNER TO operator;
 
+--
+-- Name: racks; Type: TABLE; Schema: public; Owner: operator; Tablespace: 
+--
+
+CREATE TABLE racks (
+    rack_id uuid NOT NULL,
+    zone_id uuid NOT NULL,
+    name text NOT NULL,
+    metadata json DEFAULT '{}'::json NOT NULL,
+    config json DEFAULT '{}'::json NOT NULL
+);
+
+
+ALTER TABLE public.racks OWNER TO operator;
+
 --
 -- Name: users; Type: TABLE; Schema: public; Owner: operator; Tablespace: 
 --
@@ -193,6 +583,37 @@ CREATE TABLE users (
 
 ALTER TABLE public.users OWNER TO operator;
 
+--
+-- Name: zones; Type: TABLE; Schema: public; Owner: operator; Tablespace: 
+--
+
+CREATE TABLE zones (
+    zone_id uuid NOT NULL,
+    datacenter_id uuid NOT NULL,
+    name text NOT NULL,
+    metadata json DEFAULT '{}'::json NOT NULL,
+    config json DEFAULT '{}'::json NOT NULL
+);
+
+
+ALTER TABLE public.zones OWNER TO operator;
+
+--
+-- Name: bootstrap_tokens_pkey; Type: CONSTRAINT; Schema: public; Owner: operator; Tablespace: 
+--
+
+ALTER TABLE ONLY bootstrap_tokens
+    ADD CONSTRAINT bootstrap_tokens_pkey PRIMARY KEY (bootstrap_token_id);
+
+
+--
+-- Name: bootstrap_tokens_token_hash_key; Type: CONSTRAINT; Schema: public; Owner: operator; Tablespace: 
+--
+
+ALTER TABLE ONLY bootstrap_tokens
+    ADD CONSTRAINT bootstrap_tokens_token_hash_key UNIQUE (token_hash);
+
+
 --
 -- Name: config_pkey; Type: CONSTRAINT; Schema: public; Owner: operator; Tablespace: 
 --
@@ -201,6 +622,22 @@ ALTER TABLE ONLY config
     ADD CONSTRAINT config_pkey PRIMARY KEY (namespace);
 
 
+--
+-- Name: datacenters_pkey; Type: CONSTRAINT; Schema: public; Owner: operator; Tablespace: 
+--
+
+ALTER TABLE ONLY datacenters
+    ADD CONSTRAINT datacenters_pkey PRIMARY KEY (datacenter_id);
+
+
+--
+-- Name: flavors_name_key; Type: CONSTRAINT; Schema: public; Owner: operator; Tablespace: 
+--
+
+ALTER TABLE ONLY flavors
+    ADD CONSTRAINT flavors_name_key UNIQUE (name);
+
+
 --
 -- Name: flavors_pkey; Type: CONSTRAINT; Schema: public; Owner: operator; Tablespace: 
 --
@@ -209,6 +646,38 @@ ALTER TABLE ONLY flavors
     ADD CONSTRAINT flavors_pkey PRIMARY KEY (flavor_id);
 
 
+--
+-- Name: hypervisor_bmcs_pkey; Type: CONSTRAINT; Schema: public; Owner: operator; Tablespace: 
+--
+
+ALTER TABLE ONLY hypervisor_bmcs
+    ADD CONSTRAINT hypervisor_bmcs_pkey PRIMARY KEY (hypervisor_id);
+
+
+--
+-- Name: hypervisor_facts_pkey; Type: CONSTRAINT; Schema: public; Owner: operator; Tablespace: 
+--
+
+ALTER TABLE ONLY hypervisor_facts
+    ADD CONSTRAINT hypervisor_facts_pkey PRIMARY KEY (hypervisor_id, version);
+
+
+--
+-- Name: hypervisor_interfaces_hypervisor_id_name_key; Type: CONSTRAINT; Schema: public; Owner: operator; Tablespace: 
+--
+
+ALTER TABLE ONLY hypervisor_interfaces
+    ADD CONSTRAINT hypervisor_interfaces_hypervisor_id_name_key UNIQUE (hypervisor_id, name);
+
+
+--
+-- Name: hypervisor_interfaces_pkey; Type: CONSTRAINT; Schema: public; Owner: operator; Tablespace: 
+--
+
+ALTER TABLE ONLY hypervisor_interfaces
+    ADD CONSTRAINT hypervisor_interfaces_pkey PRIMARY KEY (interface_id);
+
+
 --
 -- Name: hypervisors_pkey; Type: CONSTRAINT; Schema: public; Owner: operator; Tablespace: 
 --
@@ -217,6 +686,38 @@ ALTER TABLE ONLY hypervisors
     ADD CONSTRAINT hypervisors_pkey PRIMARY KEY (hypervisor_id);
 
 
+--
+-- Name: hypervisors_ip_key; Type: CONSTRAINT; Schema: public; Owner: operator; Tablespace: 
+--
+
+ALTER TABLE ONLY hypervisors
+    ADD CONSTRAINT hypervisors_ip_key UNIQUE (ip);
+
+
+--
+-- Name: hypervisors_mac_key; Type: CONSTRAINT; Schema: public; Owner: operator; Tablespace: 
+--
+
+ALTER TABLE ONLY hypervisors
+    ADD CONSTRAINT hypervisors_mac_key UNIQUE (mac);
+
+
+--
+-- Name: iprange_allocations_pkey; Type: CONSTRAINT; Schema: public; Owner: operator; Tablespace: 
+--
+
+ALTER TABLE ONLY iprange_allocations
+    ADD CONSTRAINT iprange_allocations_pkey PRIMARY KEY (iprange_id, ip);
+
+
+--
+-- Name: iprange_exclusions_pkey; Type: CONSTRAINT; Schema: public; Owner: operator; Tablespace: 
+--
+
+ALTER TABLE ONLY iprange_exclusions
+    ADD CONSTRAINT iprange_exclusions_pkey PRIMARY KEY (exclusion_id);
+
+
 --
 -- Name: iprange_networks_iprange_id_key; Type: CONSTRAINT; Schema: public; Owner: operator; Tablespace: 
 --
@@ -233,6 +734,14 @@ ALTER TABLE ONLY ipranges
     ADD CONSTRAINT ipranges_pkey PRIMARY KEY (iprange_id);
 
 
+--
+-- Name: ipranges_pool_excl; Type: CONSTRAINT; Schema: public; Owner: operator; Tablespace: 
+--
+
+ALTER TABLE ONLY ipranges
+    ADD CONSTRAINT ipranges_pool_excl EXCLUDE USING gist (inetrange(start_ip, end_ip, '[]'::text) WITH &&);
+
+
 --
 -- Name: networks_pkey; Type: CONSTRAINT; Schema: public; Owner: operator; Tablespace: 
 --
@@ -241,6 +750,14 @@ ALTER TABLE ONLY networks
     ADD CONSTRAINT networks_pkey PRIMARY KEY (network_id);
 
 
+--
+-- Name: networks_vlan_key; Type: CONSTRAINT; Schema: public; Owner: operator; Tablespace: 
+--
+
+ALTER TABLE ONLY networks
+    ADD CONSTRAINT networks_vlan_key UNIQUE (vlan);
+
+
 --
 -- Name: permissions_pkey; Type: CONSTRAINT; Schema: public; Owner: operator; Tablespace: 
 --
@@ -249,6 +766,14 @@ ALTER TABLE ONLY permissions
     ADD CONSTRAINT permissions_pkey PRIMARY KEY (permission_id);
 
 
+--
+-- Name: pools_pkey; Type: CONSTRAINT; Schema: public; Owner: operator; Tablespace: 
+--
+
+ALTER TABLE ONLY pools
+    ADD CONSTRAINT pools_pkey PRIMARY KEY (pool_id);
+
+
 --
 -- Name: projects_pkey; Type: CONSTRAINT; Schema: public; Owner: operator; Tablespace: 
 --
@@ -257,6 +782,14 @@ ALTER TABLE ONLY projects
     ADD CONSTRAINT projects_pkey PRIMARY KEY (project_id);
 
 
+--
+-- Name: racks_pkey; Type: CONSTRAINT; Schema: public; Owner: operator; Tablespace: 
+--
+
+ALTER TABLE ONLY racks
+    ADD CONSTRAINT racks_pkey PRIMARY KEY (rack_id);
+
+
 --
 -- Name: users_pkey; Type: CONSTRAINT; Schema: public; Owner: operator; Tablespace: 
 --
@@ -265,6 +798,49 @@ ALTER TABLE ONLY users
     ADD CONSTRAINT users_pkey PRIMARY KEY (user_id);
 
 
+--
+-- Name: zones_pkey; Type: CONSTRAINT; Schema: public; Owner: operator; Tablespace: 
+--
+
+ALTER TABLE ONLY zones
+    ADD CONSTRAINT zones_pkey PRIMARY KEY (zone_id);
+
+
+--
+-- Name: bootstrap_token_registrations_uidx; Type: INDEX; Schema: public; Owner: operator; Tablespace: 
+--
+
+CREATE UNIQUE INDEX bootstrap_token_registrations_uidx ON bootstrap_token_registrations USING btree (bootstrap_token_id, hypervisor_id);
+
+
+--
+-- Name: bootstrap_tokens_ipranges_uidx; Type: INDEX; Schema: public; Owner: operator; Tablespace: 
+--
+
+CREATE UNIQUE INDEX bootstrap_tokens_ipranges_uidx ON bootstrap_tokens_ipranges USING btree (bootstrap_token_id, iprange_id);
+
+
+--
+-- Name: flavors_projects_uidx; Type: INDEX; Schema: public; Owner: operator; Tablespace: 
+--
+
+CREATE UNIQUE INDEX flavors_projects_uidx ON flavors_projects USING btree (flavor_id, project_id);
+
+
+--
+-- Name: hypervisor_interfaces_mac_idx; Type: INDEX; Schema: public; Owner: operator; Tablespace: 
+--
+
+CREATE INDEX hypervisor_interfaces_mac_idx ON hypervisor_interfaces USING btree (mac);
+
+
+--
+-- Name: hypervisor_interfaces_network_id_idx; Type: INDEX; Schema: public; Owner: operator; Tablespace: 
+--
+
+CREATE INDEX hypervisor_interfaces_network_id_idx ON hypervisor_interfaces USING btree (network_id);
+
+
 --
 -- Name: hypervisors_ipranges_uidx; Type: INDEX; Schema: public; Owner: operator; Tablespace: 
 --
@@ -272,6 +848,27 @@ ALTER TABLE ONLY users
 CREATE UNIQUE INDEX hypervisors_ipranges_uidx ON hypervisors_ipranges USING btree (hypervisor_id, iprange_id);
 
 
+--
+-- Name: hypervisors_rack_id_idx; Type: INDEX; Schema: public; Owner: operator; Tablespace: 
+--
+
+CREATE INDEX hypervisors_rack_id_idx ON hypervisors USING btree (rack_id);
+
+
+--
+-- Name: hypervisors_state_idx; Type: INDEX; Schema: public; Owner: operator; Tablespace: 
+--
+
+CREATE INDEX hypervisors_state_idx ON hypervisors USING btree (state);
+
+
+--
+-- Name: iprange_exclusions_iprange_id_idx; Type: INDEX; Schema: public; Owner: operator; Tablespace: 
+--
+
+CREATE INDEX iprange_exclusions_iprange_id_idx ON iprange_exclusions USING btree (iprange_id, start_ip);
+
+
 --
 -- Name: iprange_networks_ukey; Type: INDEX; Schema: public; Owner: operator; Tablespace: 
 --
@@ -293,6 +890,128 @@ CREATE UNIQUE INDEX projects_permissions_uidx ON projects_permissions USING btre
 CREATE UNIQUE INDEX projects_users_uidx ON projects_users USING btree (project_id, user_id);
 
 
+--
+-- Name: racks_zone_id_idx; Type: INDEX; Schema: public; Owner: operator; Tablespace: 
+--
+
+CREATE INDEX racks_zone_id_idx ON racks USING btree (zone_id);
+
+
+--
+-- Name: zones_datacenter_id_idx; Type: INDEX; Schema: public; Owner: operator; Tablespace: 
+--
+
+CREATE INDEX zones_datacenter_id_idx ON zones USING btree (datacenter_id);
+
+
+--
+-- Name: hypervisor_interfaces_check_mac; Type: TRIGGER; Schema: public; Owner: operator
+--
+
+CREATE TRIGGER hypervisor_interfaces_check_mac BEFORE INSERT OR UPDATE OF mac ON hypervisor_interfaces FOR EACH ROW EXECUTE PROCEDURE hypervisor_interfaces_check_mac();
+
+
+--
+-- Name: hypervisors_check_interface_mac; Type: TRIGGER; Schema: public; Owner: operator
+--
+
+CREATE TRIGGER hypervisors_check_interface_mac BEFORE INSERT OR UPDATE OF mac ON hypervisors FOR EACH ROW EXECUTE PROCEDURE hypervisors_check_interface_mac();
+
+
+--
+-- Name: iprange_networks_check_overlap; Type: TRIGGER; Schema: public; Owner: operator
+--
+
+CREATE TRIGGER iprange_networks_check_overlap BEFORE INSERT OR UPDATE ON iprange_networks FOR EACH ROW EXECUTE PROCEDURE iprange_networks_check_overlap();
+
+
+--
+-- Name: ipranges_check_network_overlap; Type: TRIGGER; Schema: public; Owner: operator
+--
+
+CREATE TRIGGER ipranges_check_network_overlap BEFORE UPDATE OF cidr, segment ON ipranges FOR EACH ROW EXECUTE PROCEDURE ipranges_check_network_overlap();
+
+
+--
+-- Name: bootstrap_token_registrations_bootstrap_token_id_fkey; Type: FK CONSTRAINT; Schema: public; Owner: operator
+--
+
+ALTER TABLE ONLY bootstrap_token_registrations
+    ADD CONSTRAINT bootstrap_token_registrations_bootstrap_token_id_fkey FOREIGN KEY (bootstrap_token_id) REFERENCES bootstrap_tokens(bootstrap_token_id) ON DELETE CASCADE;
+
+
+--
+-- Name: bootstrap_token_registrations_hypervisor_id_fkey; Type: FK CONSTRAINT; Schema: public; Owner: operator
+--
+
+ALTER TABLE ONLY bootstrap_token_registrations
+    ADD CONSTRAINT bootstrap_token_registrations_hypervisor_id_fkey FOREIGN KEY (hypervisor_id) REFERENCES hypervisors(hypervisor_id) ON DELETE SET NULL;
+
+
+--
+-- Name: bootstrap_tokens_ipranges_bootstrap_token_id_fkey; Type: FK CONSTRAINT; Schema: public; Owner: operator
+--
+
+ALTER TABLE ONLY bootstrap_tokens_ipranges
+    ADD CONSTRAINT bootstrap_tokens_ipranges_bootstrap_token_id_fkey FOREIGN KEY (bootstrap_token_id) REFERENCES bootstrap_tokens(bootstrap_token_id) ON DELETE CASCADE;
+
+
+--
+-- Name: bootstrap_tokens_ipranges_iprange_id_fkey; Type: FK CONSTRAINT; Schema: public; Owner: operator
+--
+
+ALTER TABLE ONLY bootstrap_tokens_ipranges
+    ADD CONSTRAINT bootstrap_tokens_ipranges_iprange_id_fkey FOREIGN KEY (iprange_id) REFERENCES ipranges(iprange_id) ON DELETE CASCADE;
+
+
+--
+-- Name: flavors_projects_flavor_id_fkey; Type: FK CONSTRAINT; Schema: public; Owner: operator
+--
+
+ALTER TABLE ONLY flavors_projects
+    ADD CONSTRAINT flavors_projects_flavor_id_fkey FOREIGN KEY (flavor_id) REFERENCES flavors(flavor_id) ON DELETE CASCADE;
+
+
+--
+-- Name: flavors_projects_project_id_fkey; Type: FK CONSTRAINT; Schema: public; Owner: operator
+--
+
+ALTER TABLE ONLY flavors_projects
+    ADD CONSTRAINT flavors_projects_project_id_fkey FOREIGN KEY (project_id) REFERENCES projects(project_id) ON DELETE CASCADE;
+
+
+--
+-- Name: hypervisor_bmcs_hypervisor_id_fkey; Type: FK CONSTRAINT; Schema: public; Owner: operator
+--
+
+ALTER TABLE ONLY hypervisor_bmcs
+    ADD CONSTRAINT hypervisor_bmcs_hypervisor_id_fkey FOREIGN KEY (hypervisor_id) REFERENCES hypervisors(hypervisor_id) ON DELETE CASCADE;
+
+
+--
+-- Name: hypervisor_facts_hypervisor_id_fkey; Type: FK CONSTRAINT; Schema: public; Owner: operator
+--
+
+ALTER TABLE ONLY hypervisor_facts
+    ADD CONSTRAINT hypervisor_facts_hypervisor_id_fkey FOREIGN KEY (hypervisor_id) REFERENCES hypervisors(hypervisor_id) ON DELETE CASCADE;
+
+
+--
+-- Name: hypervisor_interfaces_hypervisor_id_fkey; Type: FK CONSTRAINT; Schema: public; Owner: operator
+--
+
+ALTER TABLE ONLY hypervisor_interfaces
+    ADD CONSTRAINT hypervisor_interfaces_hypervisor_id_fkey FOREIGN KEY (hypervisor_id) REFERENCES hypervisors(hypervisor_id) ON DELETE CASCADE;
+
+
+--
+-- Name: hypervisor_interfaces_network_id_fkey; Type: FK CONSTRAINT; Schema: public; Owner: operator
+--
+
+ALTER TABLE ONLY hypervisor_interfaces
+    ADD CONSTRAINT hypervisor_interfaces_network_id_fkey FOREIGN KEY (network_id) REFERENCES networks(network_id) ON DELETE SET NULL;
+
+
 --
 -- Name: hypervisors_ipranges_hypervisor_id_fkey; Type: FK CONSTRAINT; Schema: public; Owner: operator
 --
@@ -309,6 +1028,38 @@ ALTER TABLE ONLY hypervisors_ipranges
     ADD CONSTRAINT hypervisors_ipranges_iprange_id_fkey FOREIGN KEY (iprange_id) REFERENCES ipranges(iprange_id);
 
 
+--
+-- Name: hypervisors_rack_id_fkey; Type: FK CONSTRAINT; Schema: public; Owner: operator
+--
+
+ALTER TABLE ONLY hypervisors
+    ADD CONSTRAINT hypervisors_rack_id_fkey FOREIGN KEY (rack_id) REFERENCES racks(rack_id);
+
+
+--
+-- Name: iprange_allocations_hypervisor_id_fkey; Type: FK CONSTRAINT; Schema: public; Owner: operator
+--
+
+ALTER TABLE ONLY iprange_allocations
+    ADD CONSTRAINT iprange_allocations_hypervisor_id_fkey FOREIGN KEY (hypervisor_id) REFERENCES hypervisors(hypervisor_id) ON DELETE SET NULL;
+
+
+--
+-- Name: iprange_allocations_iprange_id_fkey; Type: FK CONSTRAINT; Schema: public; Owner: operator
+--
+
+ALTER TABLE ONLY iprange_allocations
+    ADD CONSTRAINT iprange_allocations_iprange_id_fkey FOREIGN KEY (iprange_id) REFERENCES ipranges(iprange_id) ON DELETE CASCADE;
+
+
+--
+-- Name: iprange_exclusions_iprange_id_fkey; Type: FK CONSTRAINT; Schema: public; Owner: operator
+--
+
+ALTER TABLE ONLY iprange_exclusions
+    ADD CONSTRAINT iprange_exclusions_iprange_id_fkey FOREIGN KEY (iprange_id) REFERENCES ipranges(iprange_id) ON DELETE CASCADE;
+
+
 --
 -- Name: iprange_networks_iprange_id_fkey; Type: FK CONSTRAINT; Schema: public; Owner: operator
 --
@@ -357,6 +1108,22 @@ ALTER TABLE ONLY projects_users
     ADD CONSTRAINT projects_users_user_id_fkey FOREIGN KEY (user_id) REFERENCES users(user_id);
 
 
+--
+-- Name: racks_zone_id_fkey; Type: FK CONSTRAINT; Schema: public; Owner: operator
+--
+
+ALTER TABLE ONLY racks
+    ADD CONSTRAINT racks_zone_id_fkey FOREIGN KEY (zone_id) REFERENCES zones(zone_id);
+
+
+--
+-- Name: zones_datacenter_id_fkey; Type: FK CONSTRAINT; Schema: public; Owner: operator
+--
+
+ALTER TABLE ONLY zones
+    ADD CONSTRAINT zones_datacenter_id_fkey FOREIGN KEY (datacenter_id) REFERENCES datacenters(datacenter_id);
+
+
 --
 -- Name: public; Type: ACL; Schema: -; Owner: postgres
 --
@@ -367,6 +1134,33 @@ GRANT ALL ON SCHEMA public TO postgres;
 GRANT ALL ON SCHEMA public TO PUBLIC;
 
 
+--
+-- Name: bootstrap_token_registrations; Type: ACL; Schema: public; Owner: operator
+--
+
+REVOKE ALL ON TABLE bootstrap_token_registrations FROM PUBLIC;
+REVOKE ALL ON TABLE bootstrap_token_registrations FROM operator;
+GRANT ALL ON TABLE bootstrap_token_registrations TO operator;
+
+
+--
+-- Name: bootstrap_tokens; Type: ACL; Schema: public; Owner: operator
+--
+
+REVOKE ALL ON TABLE bootstrap_tokens FROM PUBLIC;
+REVOKE ALL ON TABLE bootstrap_tokens FROM operator;
+GRANT ALL ON TABLE bootstrap_tokens TO operator;
+
+
+--
+-- Name: bootstrap_tokens_ipranges; Type: ACL; Schema: public; Owner: operator
+--
+
+REVOKE ALL ON TABLE bootstrap_tokens_ipranges FROM PUBLIC;
+REVOKE ALL ON TABLE bootstrap_tokens_ipranges FROM operator;
+GRANT ALL ON TABLE bootstrap_tokens_ipranges TO operator;
+
+
 --
 -- Name: config; Type: ACL; Schema: public; Owner: operator
 --
@@ -376,6 +1170,15 @@ REVOKE ALL ON TABLE config FROM operator;
 GRANT ALL ON TABLE config TO operator;
 
 
+--
+-- Name: datacenters; Type: ACL; Schema: public; Owner: operator
+--
+
+REVOKE ALL ON TABLE datacenters FROM PUBLIC;
+REVOKE ALL ON TABLE datacenters FROM operator;
+GRANT ALL ON TABLE datacenters TO operator;
+
+
 --
 -- Name: flavors; Type: ACL; Schema: public; Owner: operator
 --
@@ -385,6 +1188,42 @@ REVOKE ALL ON TABLE flavors FROM operator;
 GRANT ALL ON TABLE flavors TO operator;
 
 
+--
+-- Name: flavors_projects; Type: ACL; Schema: public; Owner: operator
+--
+
+REVOKE ALL ON TABLE flavors_projects FROM PUBLIC;
+REVOKE ALL ON TABLE flavors_projects FROM operator;
+GRANT ALL ON TABLE flavors_projects TO operator;
+
+
+--
+-- Name: hypervisor_bmcs; Type: ACL; Schema: public; Owner: operator
+--
+
+REVOKE ALL ON TABLE hypervisor_bmcs FROM PUBLIC;
+REVOKE ALL ON TABLE hypervisor_bmcs FROM operator;
+GRANT ALL ON TABLE hypervisor_bmcs TO operator;
+
+
+--
+-- Name: hypervisor_facts; Type: ACL; Schema: public; Owner: operator
+--
+
+REVOKE ALL ON TABLE hypervisor_facts FROM PUBLIC;
+REVOKE ALL ON TABLE hypervisor_facts FROM operator;
+GRANT ALL ON TABLE hypervisor_facts TO operator;
+
+
+--
+-- Name: hypervisor_interfaces; Type: ACL; Schema: public; Owner: operator
+--
+
+REVOKE ALL ON TABLE hypervisor_interfaces FROM PUBLIC;
+REVOKE ALL ON TABLE hypervisor_interfaces FROM operator;
+GRANT ALL ON TABLE hypervisor_interfaces TO operator;
+
+
 --
 -- Name: hypervisors; Type: ACL; Schema: public; Owner: operator
 --
@@ -403,6 +1242,24 @@ REVOKE ALL ON TABLE hypervisors_ipranges FROM operator;
 GRANT ALL ON TABLE hypervisors_ipranges TO operator;
 
 
+--
+-- Name: iprange_allocations; Type: ACL; Schema: public; Owner: operator
+--
+
+REVOKE ALL ON TABLE iprange_allocations FROM PUBLIC;
+REVOKE ALL ON TABLE iprange_allocations FROM operator;
+GRANT ALL ON TABLE iprange_allocations TO operator;
+
+
+--
+-- Name: iprange_exclusions; Type: ACL; Schema: public; Owner: operator
+--
+
+REVOKE ALL ON TABLE iprange_exclusions FROM PUBLIC;
+REVOKE ALL ON TABLE iprange_exclusions FROM operator;
+GRANT ALL ON TABLE iprange_exclusions TO operator;
+
+
 --
 -- Name: iprange_networks; Type: ACL; Schema: public; Owner: operator
 --
@@ -439,6 +1296,15 @@ REVOKE ALL ON TABLE permissions FROM operator;
 GRANT ALL ON TABLE permissions TO operator;
 
 
+--
+-- Name: pools; Type: ACL; Schema: public; Owner: operator
+--
+
+REVOKE ALL ON TABLE pools FROM PUBLIC;
+REVOKE ALL ON TABLE pools FROM operator;
+GRANT ALL ON TABLE pools TO operator;
+
+
 --
 -- Name: projects; Type: ACL; Schema: public; Owner: operator
 --
@@ -466,6 +1332,15 @@ REVOKE ALL ON TABLE projects_users FROM operator;
 GRANT ALL ON TABLE projects_users TO operator;
 
 
+--
+-- Name: racks; Type: ACL; Schema: public; Owner: operator
+--
+
+REVOKE ALL ON TABLE racks FROM PUBLIC;
+REVOKE ALL ON TABLE racks FROM operator;
+GRANT ALL ON TABLE racks TO operator;
+
+
 --
 -- Name: users; Type: ACL; Schema: public; Owner: operator
 --
@@ -475,6 +1350,15 @@ REVOKE ALL ON TABLE users FROM operator;
 GRANT ALL ON TABLE users TO operator;
 
 
+--
+-- Name: zones; Type: ACL; Schema: public; Owner: operator
+--
+
+REVOKE ALL ON TABLE zones FROM PUBLIC;
+REVOKE ALL ON TABLE zones FROM operator;
+GRANT ALL ON TABLE zones TO operator;
+
+
 --
 -- PostgreSQL database dump complete
 --
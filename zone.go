@@ -0,0 +1,164 @@
+package operator
+
+import (
+	"database/sql"
+	"net/http"
+
+	"code.google.com/p/go-uuid/uuid"
+	"github.com/gorilla/mux"
+	"github.com/mistifyio/mistify-operator-admin/models"
+)
+
+// RegisterZoneRoutes registers the zone routes and handlers
+func RegisterZoneRoutes(prefix string, router *mux.Router) {
+	RegisterOneRoute(router, RouteInfo{prefix, ListZones, []string{"GET"}, "zones.list"})
+	RegisterOneRoute(router, RouteInfo{prefix, CreateZone, []string{"POST"}, "zones.create"})
+	sub := router.PathPrefix(prefix).Subrouter()
+	RegisterOneRoute(sub, RouteInfo{"/{zoneID}", GetZone, []string{"GET"}, "zones.get"})
+	RegisterOneRoute(sub, RouteInfo{"/{zoneID}", UpdateZone, []string{"PATCH"}, "zones.update"})
+	RegisterOneRoute(sub, RouteInfo{"/{zoneID}", DeleteZone, []string{"DELETE"}, "zones.delete"})
+	RegisterOneRoute(sub, RouteInfo{"/{zoneID}/racks", GetZoneRacks, []string{"GET"}, "zones.racks.get"})
+}
+
+// ListZones gets a list of all zones
+func ListZones(w http.ResponseWriter, r *http.Request) {
+	hr := HTTPResponse{w}
+	zones, err := models.ListZones()
+	if err != nil {
+		hr.JSONError(http.StatusInternalServerError, err)
+		return
+	}
+	hr.JSON(http.StatusOK, zones)
+}
+
+// GetZone gets a particular zone
+func GetZone(w http.ResponseWriter, r *http.Request) {
+	hr := HTTPResponse{w}
+	zone, ok := getZoneHelper(hr, r)
+	if !ok {
+		return
+	}
+	hr.JSON(http.StatusOK, zone)
+}
+
+// CreateZone creates a new zone
+func CreateZone(w http.ResponseWriter, r *http.Request) {
+	hr := HTTPResponse{w}
+
+	// Parse Request
+	zone := &models.Zone{}
+	if err := zone.Decode(r.Body); err != nil {
+		hr.JSONMsg(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// Assign an ID
+	if zone.ID != "" {
+		hr.JSONMsg(http.StatusBadRequest, "id must not be defined")
+		return
+	}
+	zone.NewID()
+
+	if !saveZoneHelper(hr, zone) {
+		return
+	}
+	hr.JSON(http.StatusCreated, zone)
+}
+
+// UpdateZone updates an existing zone
+func UpdateZone(w http.ResponseWriter, r *http.Request) {
+	hr := HTTPResponse{w}
+	zone, ok := getZoneHelper(hr, r)
+	if !ok {
+		return // Specific response handled by getZoneHelper
+	}
+
+	// Parse Request
+	if err := zone.Decode(r.Body); err != nil {
+		hr.JSONMsg(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if !saveZoneHelper(hr, zone) {
+		return
+	}
+	hr.JSON(http.StatusOK, zone)
+}
+
+// DeleteZone deletes an existing zone that has no racks
+func DeleteZone(w http.ResponseWriter, r *http.Request) {
+	hr := HTTPResponse{w}
+	zone, ok := getZoneHelper(hr, r)
+	if !ok {
+		return
+	}
+
+	if err := zone.Delete(); err != nil {
+		if err == models.ErrLocationInUse {
+			hr.JSONMsg(http.StatusConflict, err.Error())
+			return
+		}
+		hr.JSONError(http.StatusInternalServerError, err)
+		return
+	}
+	hr.JSON(http.StatusOK, zone)
+}
+
+// GetZoneRacks gets a list of racks in the zone
+func GetZoneRacks(w http.ResponseWriter, r *http.Request) {
+	hr := HTTPResponse{w}
+	zone, ok := getZoneHelper(hr, r)
+	if !ok {
+		return
+	}
+	racks, err := models.RacksByZone(zone)
+	if err != nil {
+		hr.JSONError(http.StatusInternalServerError, err)
+		return
+	}
+	hr.JSON(http.StatusOK, racks)
+}
+
+// getZoneHelper gets the zone object and handles sending a response in case of
+// error
+func getZoneHelper(hr HTTPResponse, r *http.Request) (*models.Zone, bool) {
+	vars := mux.Vars(r)
+	zoneID, ok := vars["zoneID"]
+	if !ok {
+		hr.JSONMsg(http.StatusBadRequest, "missing zone id")
+		return nil, false
+	}
+	if uuid.Parse(zoneID) == nil {
+		hr.JSONMsg(http.StatusBadRequest, "invalid zone id")
+		return nil, false
+	}
+	zone, err := models.FetchZone(zoneID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			hr.JSONMsg(http.StatusNotFound, "not found")
+			return nil, false
+		}
+		hr.JSONError(http.StatusInternalServerError, err)
+		return nil, false
+	}
+	return zone, true
+}
+
+// saveZoneHelper saves the zone object and handles sending a response in case
+// of error
+func saveZoneHelper(hr HTTPResponse, zone *models.Zone) bool {
+	if err := zone.Validate(); err != nil {
+		hr.JSONMsg(http.StatusBadRequest, err.Error())
+		return false
+	}
+	// Save
+	if err := zone.Save(); err != nil {
+		if err == models.ErrDatacenterNotFound {
+			hr.JSONMsg(http.StatusBadRequest, err.Error())
+			return false
+		}
+		hr.JSONError(http.StatusInternalServerError, err)
+		return false
+	}
+	return true
+}